@@ -6,11 +6,20 @@ import (
 	"strconv"
 )
 
+// Store backends, chosen with the STORE environment variable.
+const (
+	StoreMongo  = "mongo"
+	StoreMemory = "memory"
+)
+
 type Config struct {
 	BotToken     string
 	AdminID      int64
 	MongoURL     string
 	AdminGroupID int64
+	// Store is StoreMongo unless STORE=memory, which keeps everything in
+	// memory and needs no MONGO_URL; nothing survives a restart.
+	Store string
 }
 
 func LoadConfig() *Config {
@@ -18,9 +27,21 @@ func LoadConfig() *Config {
 	adminIDStr := os.Getenv("ADMIN_ID")
 	mongoURL := os.Getenv("MONGO_URL")
 	adminGroupIDStr := os.Getenv("ADMIN_GROUP_ID")
+	store := os.Getenv("STORE")
 
-	if botToken == "" || adminIDStr == "" || mongoURL == "" || adminGroupIDStr == "" {
-		log.Fatal("Error: Environment variables (BOT_TOKEN, ADMIN_ID, MONGO_URL, ADMIN_GROUP_ID) are required")
+	switch store {
+	case "":
+		store = StoreMongo
+	case StoreMongo, StoreMemory:
+	default:
+		log.Fatalf("Error: Invalid STORE %q (want %q or %q)", store, StoreMongo, StoreMemory)
+	}
+
+	if botToken == "" || adminIDStr == "" || adminGroupIDStr == "" {
+		log.Fatal("Error: Environment variables (BOT_TOKEN, ADMIN_ID, ADMIN_GROUP_ID) are required")
+	}
+	if store == StoreMongo && mongoURL == "" {
+		log.Fatal("Error: Environment variable MONGO_URL is required unless STORE=memory")
 	}
 
 	adminID, err := strconv.ParseInt(adminIDStr, 10, 64)
@@ -38,5 +59,6 @@ func LoadConfig() *Config {
 		AdminID:      adminID,
 		MongoURL:     mongoURL,
 		AdminGroupID: adminGroupID,
+		Store:        store,
 	}
 }
@@ -2,8 +2,8 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,20 +13,42 @@ import (
 	"mlbbtopup/models"
 )
 
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrOrderChanged        = errors.New("order was changed by someone else")
+	ErrTopupNotApproved    = errors.New("topup is not approved")
+	ErrAlreadyCredited     = errors.New("commission already credited")
+)
+
 type DBManager struct {
-	client                *mongo.Client
-	db                    *mongo.Database
-	usersCollection       *mongo.Collection
-	pricesCollection      *mongo.Collection
-	pubgPricesCollection  *mongo.Collection
-	authCollection        *mongo.Collection
-	adminsCollection      *mongo.Collection
-	settingsCollection    *mongo.Collection
-	autoDeleteCollection  *mongo.Collection
-	allGroupsCollection   *mongo.Collection
+	client                  *mongo.Client
+	db                      *mongo.Database
+	usersCollection         *mongo.Collection
+	pricesCollection        *mongo.Collection
+	pubgPricesCollection    *mongo.Collection
+	productsCollection      *mongo.Collection
+	authCollection          *mongo.Collection
+	adminsCollection        *mongo.Collection
+	settingsCollection      *mongo.Collection
+	autoDeleteCollection    *mongo.Collection
+	allGroupsCollection     *mongo.Collection
+	ledgerCollection        *mongo.Collection
+	ordersCollection        *mongo.Collection
+	topupsCollection        *mongo.Collection
+	countersCollection      *mongo.Collection
+	callbacksCollection     *mongo.Collection
+	userStatesCollection    *mongo.Collection
+	referralFlagsCollection *mongo.Collection
+	auditCollection         *mongo.Collection
 }
 
 func NewDBManager(mongoURL string) (*DBManager, error) {
+	return newDBManager(mongoURL, "mlbb_bot_db")
+}
+
+// newDBManager connects to the named database; tests use it to work in a
+// throwaway database.
+func newDBManager(mongoURL, dbName string) (*DBManager, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -40,20 +62,253 @@ func NewDBManager(mongoURL string) (*DBManager, error) {
 		return nil, fmt.Errorf("failed to ping MongoDB: %v", err)
 	}
 
-	db := client.Database("mlbb_bot_db")
+	// Balance changes and their ledger entries are written in transactions,
+	// which a standalone mongod does not support
+	if err := requireTransactions(ctx, client); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+
+	db := client.Database(dbName)
 
-	return &DBManager{
-		client:               client,
-		db:                   db,
-		usersCollection:      db.Collection("users"),
-		pricesCollection:     db.Collection("prices"),
-		pubgPricesCollection: db.Collection("pubg_prices"),
-		authCollection:       db.Collection("authorized_users"),
-		adminsCollection:     db.Collection("admins"),
-		settingsCollection:   db.Collection("settings"),
-		autoDeleteCollection: db.Collection("auto_delete_messages"),
-		allGroupsCollection:  db.Collection("all_groups"),
-	}, nil
+	manager := &DBManager{
+		client:                  client,
+		db:                      db,
+		usersCollection:         db.Collection("users"),
+		pricesCollection:        db.Collection("prices"),
+		pubgPricesCollection:    db.Collection("pubg_prices"),
+		productsCollection:      db.Collection("products"),
+		authCollection:          db.Collection("authorized_users"),
+		adminsCollection:        db.Collection("admins"),
+		settingsCollection:      db.Collection("settings"),
+		autoDeleteCollection:    db.Collection("auto_delete_messages"),
+		allGroupsCollection:     db.Collection("all_groups"),
+		ledgerCollection:        db.Collection("ledger"),
+		ordersCollection:        db.Collection("orders"),
+		topupsCollection:        db.Collection("topups"),
+		countersCollection:      db.Collection("counters"),
+		callbacksCollection:     db.Collection("processed_callbacks"),
+		userStatesCollection:    db.Collection("user_states"),
+		referralFlagsCollection: db.Collection("referral_flags"),
+		auditCollection:         db.Collection("audit_log"),
+	}
+
+	// The unique indexes back the once-only guarantees, so refuse to run
+	// without them
+	if err := manager.EnsureIndexes(); err != nil {
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("failed to create indexes: %v", err)
+	}
+
+	return manager, nil
+}
+
+func (db *DBManager) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The plain {reason, reference_id} index had the same key pattern as
+	// referral_commission_once, which serves every lookup on those fields
+	if err := dropIndexIfExists(ctx, db.ledgerCollection, "reason_1_reference_id_1"); err != nil {
+		return err
+	}
+
+	_, err := db.ledgerCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		// One commission per topup, even if two credits race past the count check
+		{
+			Keys: bson.D{{Key: "reason", Value: 1}, {Key: "reference_id", Value: 1}},
+			Options: options.Index().
+				SetName("referral_commission_once").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"reason": models.LedgerReasonReferralCommission}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = db.ensureUniqueIndex(ctx, db.ordersCollection, "order_id"); err != nil {
+		return err
+	}
+
+	_, err = db.ordersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = db.ensureUniqueIndex(ctx, db.topupsCollection, "topup_id"); err != nil {
+		return err
+	}
+
+	_, err = db.topupsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.callbacksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// MongoDB removes expired states itself; expires_at holds the exact time
+	_, err = db.userStatesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.referralFlagsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.adminsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.productsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "game", Value: 1}, {Key: "sku", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "game", Value: 1}, {Key: "sort_order", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.auditCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "target_user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// dropIndexIfExists drops a named index left over from an older version.
+func dropIndexIfExists(ctx context.Context, collection *mongo.Collection, name string) error {
+	indexes, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if index.Name == name {
+			_, err = collection.Indexes().DropOne(ctx, name)
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureUniqueIndex replaces an older non-unique index on field with a unique
+// one, renaming any duplicate IDs left over from the timestamp-based generator.
+func (db *DBManager) ensureUniqueIndex(ctx context.Context, collection *mongo.Collection, field string) error {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var indexes []struct {
+		Name   string `bson:"name"`
+		Unique bool   `bson:"unique"`
+	}
+	if err = cursor.All(ctx, &indexes); err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if index.Name == field+"_1" {
+			if index.Unique {
+				return nil
+			}
+			if _, err := collection.Indexes().DropOne(ctx, index.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := db.dedupeIDs(ctx, collection, field); err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// NextSequence returns the next value of a named counter. Values are never
+// reused, which makes them safe to build order and topup IDs from.
+func (db *DBManager) NextSequence(name string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := db.countersCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Seq, nil
+}
+
+// requireTransactions fails unless the server is a replica set member or a
+// mongos, the deployments that support multi-document transactions.
+func requireTransactions(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return fmt.Errorf("failed to check MongoDB deployment: %v", err)
+	}
+
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return errors.New("MongoDB is a standalone server, but balance updates need transactions: " +
+			"run it as a replica set (a single-node set is enough, e.g. mongod --replSet rs0 then rs.initiate())")
+	}
+	return nil
+}
+
+// withTransaction runs fn inside a MongoDB transaction so that balance
+// changes and their ledger entries are committed together.
+func (db *DBManager) withTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
 }
 
 func (db *DBManager) Close() error {
@@ -104,8 +359,6 @@ func (db *DBManager) CreateUser(userID, name, username string, referrerID *strin
 		"name":              name,
 		"username":          username,
 		"balance":           0,
-		"orders":            []bson.M{},
-		"topups":            []bson.M{},
 		"joined_at":         time.Now(),
 		"referral_earnings": 0,
 	}
@@ -136,183 +389,594 @@ func (db *DBManager) UpdateUserProfile(userID, name, username string) error {
 	return err
 }
 
-func (db *DBManager) UpdateBalance(userID string, amountChange int) error {
+// UpdateBalance applies amountChange and returns its ledger entry. A debit
+// only matches while balance >= the amount, like PlaceOrder, and returns
+// ErrInsufficientBalance otherwise.
+func (db *DBManager) UpdateBalance(userID string, amountChange int, reason string, referenceID string) (*models.LedgerEntry, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.usersCollection.UpdateOne(
-		ctx,
-		bson.M{"user_id": userID},
-		bson.M{"$inc": bson.M{"balance": amountChange}},
-	)
-	return err
+	var entry *models.LedgerEntry
+	err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		filter := bson.M{"user_id": userID}
+		if amountChange < 0 {
+			filter["balance"] = bson.M{"$gte": -amountChange}
+		}
+
+		var user models.User
+		err := db.usersCollection.FindOneAndUpdate(
+			sc,
+			filter,
+			bson.M{"$inc": bson.M{"balance": amountChange}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			count, countErr := db.usersCollection.CountDocuments(sc, bson.M{"user_id": userID})
+			if countErr != nil {
+				return countErr
+			}
+			if count > 0 {
+				return ErrInsufficientBalance
+			}
+			return fmt.Errorf("user %s not found", userID)
+		}
+		if err != nil {
+			return err
+		}
+
+		entry, err = db.recordLedgerEntry(sc, userID, amountChange, reason, referenceID, user.Balance)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
 }
 
 func (db *DBManager) SetBalance(userID string, amount int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.usersCollection.UpdateOne(
-		ctx,
-		bson.M{"user_id": userID},
-		bson.M{"$set": bson.M{"balance": amount}},
-	)
-	return err
+	return db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		var user models.User
+		err := db.usersCollection.FindOne(sc, bson.M{"user_id": userID}).Decode(&user)
+		if err != nil {
+			return err
+		}
+
+		change := amount - user.Balance
+		if change == 0 {
+			return nil
+		}
+		_, err = db.postLedgerEntry(sc, userID, change, models.LedgerReasonAdjustment, "")
+		return err
+	})
 }
 
-func (db *DBManager) UpdateReferralEarnings(userID string, commissionAmount int) error {
+// UpdateReferralEarnings credits a referral commission for referenceID. It
+// returns ErrAlreadyCredited if that reference was already paid out, so a
+// topup can only ever earn one commission.
+func (db *DBManager) UpdateReferralEarnings(userID string, commissionAmount int, referenceID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.usersCollection.UpdateOne(
-		ctx,
-		bson.M{"user_id": userID},
-		bson.M{"$inc": bson.M{
-			"balance":          commissionAmount,
-			"referral_earnings": commissionAmount,
-		}},
-	)
+	err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		count, err := db.ledgerCollection.CountDocuments(sc, bson.M{
+			"reason":       models.LedgerReasonReferralCommission,
+			"reference_id": referenceID,
+		})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyCredited
+		}
+
+		_, err = db.postLedgerEntry(sc, userID, commissionAmount, models.LedgerReasonReferralCommission, referenceID)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.usersCollection.UpdateOne(
+			sc,
+			bson.M{"user_id": userID},
+			bson.M{"$inc": bson.M{"referral_earnings": commissionAmount}},
+		)
+		return err
+	})
+	// A concurrent credit that got past the count hits the unique index instead
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyCredited
+	}
 	return err
 }
 
-func (db *DBManager) AddOrder(userID string, orderData bson.M) error {
+func (db *DBManager) AddOrder(order models.Order) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.usersCollection.UpdateOne(
-		ctx,
-		bson.M{"user_id": userID},
-		bson.M{"$push": bson.M{"orders": orderData}},
-	)
+	_, err := db.ordersCollection.InsertOne(ctx, order)
 	return err
 }
 
-func (db *DBManager) AddTopup(userID string, topupData bson.M) error {
+// PlaceOrder debits the order price and stores the order in one transaction.
+// The debit only matches while balance >= price, so concurrent orders can
+// never push the balance below zero. It returns the balance after the debit.
+func (db *DBManager) PlaceOrder(order models.Order) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var newBalance int
+	err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		var user models.User
+		err := db.usersCollection.FindOneAndUpdate(
+			sc,
+			bson.M{"user_id": order.UserID, "balance": bson.M{"$gte": order.Price}},
+			bson.M{"$inc": bson.M{"balance": -order.Price}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrInsufficientBalance
+			}
+			return err
+		}
+
+		if _, err = db.ordersCollection.InsertOne(sc, order); err != nil {
+			return err
+		}
+
+		_, err = db.recordLedgerEntry(sc, order.UserID, -order.Price, models.LedgerReasonOrderDebit, order.OrderID, user.Balance)
+		if err != nil {
+			return err
+		}
+
+		newBalance = user.Balance
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return newBalance, nil
+}
+
+func (db *DBManager) AddTopup(topup models.Topup) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.usersCollection.UpdateOne(
-		ctx,
-		bson.M{"user_id": userID},
-		bson.M{"$push": bson.M{"topups": topupData}},
-	)
+	_, err := db.topupsCollection.InsertOne(ctx, topup)
 	return err
 }
 
-func (db *DBManager) FindAndUpdateOrder(orderID string, updates bson.M) (string, error) {
+// FindAndUpdateOrder moves an order to a new status through Order.Transition.
+// The update only applies if the order is still in the status it was read in.
+func (db *DBManager) FindAndUpdateOrder(orderID string, to models.OrderStatus, actor string) (*models.Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	setFields := bson.M{}
-	for key, value := range updates {
-		setFields["orders.$."+key] = value
+	return db.transitionOrder(ctx, orderID, to, actor)
+}
+
+func (db *DBManager) transitionOrder(ctx context.Context, orderID string, to models.OrderStatus, actor string) (*models.Order, error) {
+	var order models.Order
+	err := db.ordersCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("order %s not found", orderID)
+		}
+		return nil, err
 	}
 
-	var result struct {
-		UserID string `bson:"user_id"`
+	from := order.Status
+	transition, err := order.Transition(to, actor, time.Now())
+	if err != nil {
+		return nil, err
 	}
 
-	err := db.usersCollection.FindOneAndUpdate(
+	setFields := bson.M{
+		"status":     order.Status,
+		"updated_by": order.UpdatedBy,
+		"updated_at": order.UpdatedAt,
+	}
+	if to == models.OrderCompleted {
+		setFields["confirmed_by"] = order.ConfirmedBy
+		setFields["confirmed_at"] = order.ConfirmedAt
+	}
+
+	result, err := db.ordersCollection.UpdateOne(
 		ctx,
-		bson.M{"orders.order_id": orderID, "orders.status": "pending"},
-		bson.M{"$set": setFields},
-		options.FindOneAndUpdate().SetReturnDocument(options.After),
-	).Decode(&result)
+		bson.M{"order_id": orderID, "status": from},
+		bson.M{"$set": setFields, "$push": bson.M{"history": transition}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrOrderChanged
+	}
+	return &order, nil
+}
+
+// CancelOrder cancels an order and refunds its price in one transaction.
+func (db *DBManager) CancelOrder(orderID string, actor string) (*models.Order, error) {
+	return db.refundOrder(orderID, models.OrderCancelled, actor)
+}
+
+// RefundOrder refunds a completed or failed order. The status change and the
+// refund ledger entry share one transaction.
+func (db *DBManager) RefundOrder(orderID string, actor string) (*models.Order, error) {
+	return db.refundOrder(orderID, models.OrderRefunded, actor)
+}
+
+func (db *DBManager) refundOrder(orderID string, to models.OrderStatus, actor string) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order *models.Order
+	err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		var err error
+		order, err = db.transitionOrder(sc, orderID, to, actor)
+		if err != nil {
+			return err
+		}
 
+		_, err = db.postLedgerEntry(sc, order.UserID, order.Price, models.LedgerReasonOrderRefund, orderID)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return result.UserID, nil
+	return order, nil
 }
 
+// FindAndUpdateTopup applies updates to a pending topup. When the new status
+// is approved, the status flip and the balance credit share one transaction,
+// so a topup can only ever be credited once.
 func (db *DBManager) FindAndUpdateTopup(topupID string, updates bson.M) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var topup models.Topup
+	err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		err := db.topupsCollection.FindOneAndUpdate(
+			sc,
+			bson.M{"topup_id": topupID, "status": "pending"},
+			bson.M{"$set": updates},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&topup)
+		if err != nil {
+			return err
+		}
+
+		// If topup is approved, update balance
+		if status, ok := updates["status"]; ok && status == "approved" && topup.Amount > 0 {
+			_, err = db.postLedgerEntry(sc, topup.UserID, topup.Amount, models.LedgerReasonTopupApproval, topupID)
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return topup.UserID, nil
+}
+
+// ReverseTopup marks an approved topup reversed, debits its amount from the
+// owner and takes back any referral commission paid on it, all in one
+// transaction. Balances are allowed to go negative. It returns
+// ErrTopupNotApproved if the topup is not currently approved.
+func (db *DBManager) ReverseTopup(topupID, reversedBy, reason string) (*models.TopupReversal, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var reversal *models.TopupReversal
+	err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		reversal = &models.TopupReversal{}
+		err := db.topupsCollection.FindOneAndUpdate(
+			sc,
+			bson.M{"topup_id": topupID, "status": "approved"},
+			bson.M{"$set": bson.M{
+				"status":          "reversed",
+				"reversed_by":     reversedBy,
+				"reversed_at":     time.Now(),
+				"reversal_reason": reason,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&reversal.Topup)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrTopupNotApproved
+			}
+			return err
+		}
+
+		entry, err := db.postLedgerEntry(sc, reversal.Topup.UserID, -reversal.Topup.Amount, models.LedgerReasonTopupReversal, topupID)
+		if err != nil {
+			return err
+		}
+		reversal.UserBalance = entry.BalanceAfter
+
+		// Claw back the commission, if one was paid
+		var commission models.LedgerEntry
+		err = db.ledgerCollection.FindOne(sc, bson.M{
+			"reason":       models.LedgerReasonReferralCommission,
+			"reference_id": topupID,
+		}).Decode(&commission)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry, err = db.postLedgerEntry(sc, commission.UserID, -commission.Change, models.LedgerReasonCommissionClawback, topupID)
+		if err != nil {
+			return err
+		}
+		reversal.ReferrerID = commission.UserID
+		reversal.Commission = commission.Change
+		reversal.ReferrerBalance = entry.BalanceAfter
+
+		_, err = db.usersCollection.UpdateOne(
+			sc,
+			bson.M{"user_id": commission.UserID},
+			bson.M{"$inc": bson.M{"referral_earnings": -commission.Change}},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+func (db *DBManager) GetOrder(orderID string) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var order models.Order
+	err := db.ordersCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// SetOrderAdminMessage remembers the admin group message for an order, so
+// it can be updated when the order changes.
+func (db *DBManager) SetOrderAdminMessage(orderID string, chatID int64, messageID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// First find the user and topup to get the amount
-	var user struct {
-		UserID string        `bson:"user_id"`
-		Topups []models.Topup `bson:"topups"`
+	_, err := db.ordersCollection.UpdateOne(
+		ctx,
+		bson.M{"order_id": orderID},
+		bson.M{"$set": bson.M{"admin_chat_id": chatID, "admin_message_id": messageID}},
+	)
+	return err
+}
+
+func (db *DBManager) GetUserOrders(userID string, limit int64) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := db.ordersCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err = cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// GetUserTopups returns the user's topups, newest first. An empty status
+// matches every topup.
+func (db *DBManager) GetUserTopups(userID string, status string, limit int64) ([]models.Topup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
 	}
 
-	err := db.usersCollection.FindOne(
+	cursor, err := db.topupsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var topups []models.Topup
+	if err = cursor.All(ctx, &topups); err != nil {
+		return nil, err
+	}
+	return topups, nil
+}
+
+func (db *DBManager) FindPendingTopup(userID string, amount int) (*models.Topup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var topup models.Topup
+	err := db.topupsCollection.FindOne(
 		ctx,
-		bson.M{"topups.topup_id": topupID},
-	).Decode(&user)
+		bson.M{"user_id": userID, "amount": amount, "status": "pending"},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
+	).Decode(&topup)
 	if err != nil {
-		return "", err
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
 	}
+	return &topup, nil
+}
 
-	// Update the topup
-	setFields := bson.M{}
-	for key, value := range updates {
-		setFields["topups.$."+key] = value
+func (db *DBManager) GetTopup(topupID string) (*models.Topup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var topup models.Topup
+	err := db.topupsCollection.FindOne(ctx, bson.M{"topup_id": topupID}).Decode(&topup)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
 	}
+	return &topup, nil
+}
+
+// SetTopupAdminMessage remembers the admin group message for a topup.
+func (db *DBManager) SetTopupAdminMessage(topupID string, chatID int64, messageID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	updateResult := db.usersCollection.FindOneAndUpdate(
+	_, err := db.topupsCollection.UpdateOne(
 		ctx,
-		bson.M{"topups.topup_id": topupID, "topups.status": "pending"},
-		bson.M{"$set": setFields},
-		options.FindOneAndUpdate().SetReturnDocument(options.After),
+		bson.M{"topup_id": topupID},
+		bson.M{"$set": bson.M{"admin_chat_id": chatID, "admin_message_id": messageID}},
 	)
+	return err
+}
 
-	var updatedUser struct {
-		UserID string `bson:"user_id"`
-	}
-	if err := updateResult.Decode(&updatedUser); err != nil {
-		return "", err
+// History Functions
+
+// GetUserHistory returns one page of the user's orders and topups, newest
+// first, and how many entries match the filter in total.
+func (db *DBManager) GetUserHistory(filter models.HistoryFilter) ([]models.HistoryEntry, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The page can only hold entries from the newest (page+1)*size of each
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetLimit(int64((filter.Page + 1) * models.HistoryPageSize))
+
+	total := 0
+	var orders []models.Order
+	if filter.Kind != models.HistoryTopups {
+		query := bson.M{"user_id": filter.UserID}
+		if statuses := filter.Status.OrderStatuses(); statuses != nil {
+			query["status"] = bson.M{"$in": statuses}
+		}
+
+		count, err := db.ordersCollection.CountDocuments(ctx, query)
+		if err != nil {
+			return nil, 0, err
+		}
+		total += int(count)
+
+		cursor, err := db.ordersCollection.Find(ctx, query, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err = cursor.All(ctx, &orders); err != nil {
+			return nil, 0, err
+		}
 	}
 
-	// If topup is approved, update balance
-	if status, ok := updates["status"]; ok && status == "approved" {
-		// Find the topup amount
-		var topupAmount int
-		for _, topup := range user.Topups {
-			if topup.TopupID == topupID {
-				topupAmount = topup.Amount
-				break
-			}
+	var topups []models.Topup
+	if filter.Kind != models.HistoryOrders {
+		query := bson.M{"user_id": filter.UserID}
+		if statuses := filter.Status.TopupStatuses(); statuses != nil {
+			query["status"] = bson.M{"$in": statuses}
 		}
-		if topupAmount > 0 {
-			err = db.UpdateBalance(updatedUser.UserID, topupAmount)
-			if err != nil {
-				return updatedUser.UserID, err
-			}
+
+		count, err := db.topupsCollection.CountDocuments(ctx, query)
+		if err != nil {
+			return nil, 0, err
+		}
+		total += int(count)
+
+		cursor, err := db.topupsCollection.Find(ctx, query, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err = cursor.All(ctx, &topups); err != nil {
+			return nil, 0, err
 		}
 	}
 
-	return updatedUser.UserID, nil
+	return filter.PageOf(models.NewHistory(orders, topups)), total, nil
 }
 
-// Price Functions
-func (db *DBManager) LoadPrices() (map[string]interface{}, error) {
+// Product Functions
+
+// GetProducts returns a game's products in catalog order.
+func (db *DBManager) GetProducts(game string, activeOnly bool) ([]models.Product, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var result struct {
-		Prices map[string]interface{} `bson:"prices"`
+	filter := bson.M{"game": game}
+	if activeOnly {
+		filter["active"] = true
 	}
-	
-	err := db.pricesCollection.FindOne(ctx, bson.M{"_id": "custom_prices"}).Decode(&result)
+
+	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}})
+	cursor, err := db.productsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []models.Product
+	if err = cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (db *DBManager) GetProduct(game, sku string) (*models.Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var product models.Product
+	err := db.productsCollection.FindOne(ctx, bson.M{"game": game, "sku": sku}).Decode(&product)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return make(map[string]interface{}), nil
+			return nil, nil
 		}
 		return nil, err
 	}
-	return result.Prices, nil
+	return &product, nil
 }
 
-func (db *DBManager) SavePrices(prices map[string]interface{}) error {
+// SaveProducts writes the products, adding any that do not exist yet.
+func (db *DBManager) SaveProducts(products []models.Product) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.pricesCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": "custom_prices"},
-		bson.M{"$set": bson.M{"prices": prices}},
-		options.Update().SetUpsert(true),
-	)
+	if len(products) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(products))
+	for _, product := range products {
+		product.UpdatedAt = time.Now()
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"game": product.Game, "sku": product.SKU}).
+			SetReplacement(product).
+			SetUpsert(true))
+	}
+
+	_, err := db.productsCollection.BulkWrite(ctx, writes)
 	return err
 }
 
@@ -365,6 +1029,109 @@ func (db *DBManager) RemoveAuthorizedUser(userID string) error {
 	return err
 }
 
+// Admin Functions
+func (db *DBManager) GetAdmin(userID string) (*models.Admin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var admin models.Admin
+	err := db.adminsCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&admin)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (db *DBManager) GetAdmins() ([]models.Admin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "added_at", Value: 1}})
+	cursor, err := db.adminsCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var admins []models.Admin
+	if err = cursor.All(ctx, &admins); err != nil {
+		return nil, err
+	}
+	return admins, nil
+}
+
+// SetAdmin adds an admin, or changes the role of an existing one.
+func (db *DBManager) SetAdmin(admin models.Admin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.adminsCollection.ReplaceOne(
+		ctx,
+		bson.M{"user_id": admin.UserID},
+		admin,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// RemoveAdmin returns false if the user was not an admin.
+func (db *DBManager) RemoveAdmin(userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.adminsCollection.DeleteOne(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// Audit Functions
+func (db *DBManager) AddAuditEntry(entry models.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.auditCollection.InsertOne(ctx, entry)
+	return err
+}
+
+// GetAuditLog returns matching entries, newest first.
+func (db *DBManager) GetAuditLog(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := bson.M{}
+	if filter.ActorID != "" {
+		query["actor_id"] = filter.ActorID
+	}
+	if filter.UserID != "" {
+		query["target_user_id"] = filter.UserID
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+
+	cursor, err := db.auditCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []models.AuditEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
 // Settings Functions
 func (db *DBManager) LoadSettings(defaultPayment, defaultMaintenance, defaultAffiliate, defaultAutoDelete map[string]interface{}) (map[string]interface{}, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -405,3 +1172,113 @@ func (db *DBManager) UpdateSetting(key string, value interface{}) error {
 	)
 	return err
 }
+
+// LoadPaymentMethods returns the configured payment methods. Settings saved
+// before the list existed fall back to KBZ Pay and Wave Money built from
+// payment_info.
+func (db *DBManager) LoadPaymentMethods() ([]models.PaymentMethod, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var config struct {
+		PaymentInfo    map[string]interface{} `bson:"payment_info"`
+		PaymentMethods []models.PaymentMethod `bson:"payment_methods"`
+	}
+	err := db.settingsCollection.FindOne(ctx, bson.M{"_id": "global_config"}).Decode(&config)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if config.PaymentMethods == nil {
+		return models.LegacyPaymentMethods(config.PaymentInfo), nil
+	}
+	return config.PaymentMethods, nil
+}
+
+func (db *DBManager) SavePaymentMethods(methods []models.PaymentMethod) error {
+	return db.UpdateSetting("payment_methods", methods)
+}
+
+// Callback Functions
+
+// ClaimCallback records that key is being handled by the given admin. It
+// returns false and the existing record if someone already claimed it.
+func (db *DBManager) ClaimCallback(key, action, handledByID, handledBy string) (bool, *models.ProcessedCallback, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claim := models.ProcessedCallback{
+		Key:         key,
+		Action:      action,
+		HandledByID: handledByID,
+		HandledBy:   handledBy,
+		HandledAt:   time.Now(),
+	}
+
+	_, err := db.callbacksCollection.InsertOne(ctx, claim)
+	if err == nil {
+		return true, &claim, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, nil, err
+	}
+
+	var existing models.ProcessedCallback
+	if err := db.callbacksCollection.FindOne(ctx, bson.M{"key": key}).Decode(&existing); err != nil {
+		return false, nil, err
+	}
+	return false, &existing, nil
+}
+
+// ReleaseCallback removes a claim whose action failed, so it can be retried.
+func (db *DBManager) ReleaseCallback(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.callbacksCollection.DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
+
+// User State Functions
+
+// GetUserState returns the user's conversation state, or nil if there is
+// none or it has expired. The TTL monitor only runs once a minute, so expired
+// states are filtered out here as well.
+func (db *DBManager) GetUserState(userID string) (*models.UserState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var state models.UserState
+	err := db.userStatesCollection.FindOne(ctx, bson.M{
+		"user_id":    userID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&state)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (db *DBManager) SetUserState(state models.UserState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.userStatesCollection.ReplaceOne(
+		ctx,
+		bson.M{"user_id": state.UserID},
+		state,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (db *DBManager) ClearUserState(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.userStatesCollection.DeleteOne(ctx, bson.M{"user_id": userID})
+	return err
+}
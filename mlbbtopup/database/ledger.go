@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mlbbtopup/models"
+)
+
+// postLedgerEntry applies change to the user's balance and records the
+// matching ledger entry. It must run inside withTransaction.
+func (db *DBManager) postLedgerEntry(ctx context.Context, userID string, change int, reason string, referenceID string) (*models.LedgerEntry, error) {
+	var user models.User
+	err := db.usersCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$inc": bson.M{"balance": change}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("user %s not found", userID)
+		}
+		return nil, err
+	}
+
+	return db.recordLedgerEntry(ctx, userID, change, reason, referenceID, user.Balance)
+}
+
+// recordLedgerEntry inserts the ledger entry for a balance change that has
+// already been applied by the caller in the same transaction.
+func (db *DBManager) recordLedgerEntry(ctx context.Context, userID string, change int, reason string, referenceID string, balanceAfter int) (*models.LedgerEntry, error) {
+	entry := models.NewLedgerEntry(primitive.NewObjectID().Hex(), userID, change, reason, referenceID, balanceAfter)
+	if _, err := db.ledgerCollection.InsertOne(ctx, entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Ledger Functions
+func (db *DBManager) GetLedger(userID string, limit int64) ([]models.LedgerEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := db.ledgerCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []models.LedgerEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// LedgerBalance sums every ledger entry for the user. It is the source of
+// truth that users.balance is projected from.
+func (db *DBManager) LedgerBalance(userID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return db.ledgerBalance(ctx, userID)
+}
+
+func (db *DBManager) ledgerBalance(ctx context.Context, userID string) (int, error) {
+	cursor, err := db.ledgerCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$change"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Total int `bson:"total"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].Total, nil
+}
+
+// VerifyBalance returns the stored balance and the balance rebuilt from the ledger.
+func (db *DBManager) VerifyBalance(userID string) (int, int, error) {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if user == nil {
+		return 0, 0, fmt.Errorf("user %s not found", userID)
+	}
+
+	ledgerBalance, err := db.LedgerBalance(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return user.Balance, ledgerBalance, nil
+}
+
+// RebuildBalance overwrites users.balance with the ledger total.
+func (db *DBManager) RebuildBalance(userID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var balance int
+	err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		total, err := db.ledgerBalance(sc, userID)
+		if err != nil {
+			return err
+		}
+
+		balance = total
+		_, err = db.usersCollection.UpdateOne(
+			sc,
+			bson.M{"user_id": userID},
+			bson.M{"$set": bson.M{"balance": total}},
+		)
+		return err
+	})
+	return balance, err
+}
+
+// BackfillOpeningBalances records an opening entry for users whose balance
+// predates the ledger, so that every balance can be rebuilt from entries.
+// The opening entry is whatever the ledger does not account for yet, read in
+// the same transaction as the balance, so a balance change made while the
+// backfill runs is neither missed nor counted twice. Each user gets at most
+// one opening entry; a user who already has one but whose balance has since
+// drifted from the ledger gets an adjustment entry for the difference instead.
+// It returns how many opening and adjustment entries were recorded.
+func (db *DBManager) BackfillOpeningBalances() (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	userIDs, err := db.usersCollection.Distinct(ctx, "user_id", bson.M{})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	opened, adjusted := 0, 0
+	for _, value := range userIDs {
+		userID, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var reason string
+		err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+			reason = ""
+
+			var user models.User
+			if err := db.usersCollection.FindOne(sc, bson.M{"user_id": userID}).Decode(&user); err != nil {
+				return err
+			}
+
+			total, err := db.ledgerBalance(sc, userID)
+			if err != nil {
+				return err
+			}
+			difference := user.Balance - total
+			if difference == 0 {
+				return nil
+			}
+
+			entry := models.NewLedgerEntry(primitive.NewObjectID().Hex(), userID, difference,
+				models.LedgerReasonOpeningBalance, "", user.Balance)
+			result, err := db.ledgerCollection.UpdateOne(
+				sc,
+				bson.M{"user_id": userID, "reason": models.LedgerReasonOpeningBalance},
+				bson.M{"$setOnInsert": entry},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				return err
+			}
+			if result.UpsertedCount > 0 {
+				reason = models.LedgerReasonOpeningBalance
+				return nil
+			}
+
+			// The opening entry is already there, so the balance moved
+			// without a ledger entry since
+			if _, err := db.recordLedgerEntry(sc, userID, difference, models.LedgerReasonAdjustment, "backfill", user.Balance); err != nil {
+				return err
+			}
+			reason = models.LedgerReasonAdjustment
+			return nil
+		})
+		if err != nil {
+			return opened, adjusted, err
+		}
+
+		switch reason {
+		case models.LedgerReasonOpeningBalance:
+			opened++
+		case models.LedgerReasonAdjustment:
+			adjusted++
+		}
+	}
+	return opened, adjusted, nil
+}
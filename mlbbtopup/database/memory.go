@@ -0,0 +1,987 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mlbbtopup/models"
+)
+
+// MemoryStore is an in-memory Store for running the bot and its flows
+// without MongoDB. It mirrors the DBManager semantics, including the guarded
+// order debit and the one-shot callback claims, but keeps nothing on restart.
+type MemoryStore struct {
+	mu         sync.Mutex
+	users      map[string]*models.User
+	orders     []*models.Order
+	topups     []*models.Topup
+	ledger     []models.LedgerEntry
+	products   map[string]models.Product
+	authorized map[string]bool
+	settings   map[string]interface{}
+	counters   map[string]int64
+	callbacks  map[string]models.ProcessedCallback
+	states     map[string]models.UserState
+	flags      map[string]*models.ReferralFlag
+	admins     map[string]models.Admin
+	audit      []models.AuditEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		users:      make(map[string]*models.User),
+		products:   make(map[string]models.Product),
+		authorized: make(map[string]bool),
+		counters:   make(map[string]int64),
+		callbacks:  make(map[string]models.ProcessedCallback),
+		states:     make(map[string]models.UserState),
+		flags:      make(map[string]*models.ReferralFlag),
+		admins:     make(map[string]models.Admin),
+	}
+	for _, product := range models.DefaultProducts() {
+		m.products[productKey(product.Game, product.SKU)] = product
+	}
+	return m
+}
+
+// Sequence Functions
+func (m *MemoryStore) NextSequence(name string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counters[name]++
+	return m.counters[name], nil
+}
+
+// User Functions
+func (m *MemoryStore) GetUser(userID string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *MemoryStore) GetAllUsers() ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make([]models.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].JoinedAt.Before(users[j].JoinedAt) })
+	return users, nil
+}
+
+func (m *MemoryStore) CreateUser(userID, name, username string, referrerID *string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; ok {
+		return nil
+	}
+
+	user := &models.User{
+		UserID:   userID,
+		Name:     name,
+		Username: username,
+		JoinedAt: time.Now(),
+	}
+	if referrerID != nil {
+		user.ReferredBy = *referrerID
+	}
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserProfile(userID, name, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.Name = name
+		user.Username = username
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateBalance(userID string, amountChange int, reason string, referenceID string) (*models.LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok && amountChange < 0 && user.Balance < -amountChange {
+		return nil, ErrInsufficientBalance
+	}
+	return m.postLedgerEntry(userID, amountChange, reason, referenceID)
+}
+
+func (m *MemoryStore) SetBalance(userID string, amount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+
+	change := amount - user.Balance
+	if change == 0 {
+		return nil
+	}
+	_, err := m.postLedgerEntry(userID, change, models.LedgerReasonAdjustment, "")
+	return err
+}
+
+func (m *MemoryStore) UpdateReferralEarnings(userID string, commissionAmount int, referenceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range m.ledger {
+		if entry.Reason == models.LedgerReasonReferralCommission && entry.ReferenceID == referenceID {
+			return ErrAlreadyCredited
+		}
+	}
+
+	if _, err := m.postLedgerEntry(userID, commissionAmount, models.LedgerReasonReferralCommission, referenceID); err != nil {
+		return err
+	}
+	m.users[userID].ReferralEarnings += commissionAmount
+	return nil
+}
+
+// postLedgerEntry must be called with m.mu held.
+func (m *MemoryStore) postLedgerEntry(userID string, change int, reason string, referenceID string) (*models.LedgerEntry, error) {
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+
+	user.Balance += change
+	m.counters["ledger"]++
+	entry := models.NewLedgerEntry(fmt.Sprintf("L%d", m.counters["ledger"]), userID, change, reason, referenceID, user.Balance)
+	m.ledger = append(m.ledger, entry)
+	return &entry, nil
+}
+
+// Ledger Functions
+func (m *MemoryStore) GetLedger(userID string, limit int64) ([]models.LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []models.LedgerEntry
+	for i := len(m.ledger) - 1; i >= 0; i-- {
+		if m.ledger[i].UserID != userID {
+			continue
+		}
+		entries = append(entries, m.ledger[i])
+		if limit > 0 && int64(len(entries)) == limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) LedgerBalance(userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ledgerBalance(userID), nil
+}
+
+func (m *MemoryStore) ledgerBalance(userID string) int {
+	total := 0
+	for _, entry := range m.ledger {
+		if entry.UserID == userID {
+			total += entry.Change
+		}
+	}
+	return total
+}
+
+func (m *MemoryStore) VerifyBalance(userID string) (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return 0, 0, fmt.Errorf("user %s not found", userID)
+	}
+	return user.Balance, m.ledgerBalance(userID), nil
+}
+
+func (m *MemoryStore) RebuildBalance(userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := m.ledgerBalance(userID)
+	if user, ok := m.users[userID]; ok {
+		user.Balance = total
+	}
+	return total, nil
+}
+
+// Order Functions
+func (m *MemoryStore) AddOrder(order models.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findOrder(order.OrderID) != nil {
+		return fmt.Errorf("duplicate order_id %s", order.OrderID)
+	}
+	m.orders = append(m.orders, &order)
+	return nil
+}
+
+func (m *MemoryStore) PlaceOrder(order models.Order) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[order.UserID]
+	if !ok || user.Balance < order.Price {
+		return 0, ErrInsufficientBalance
+	}
+	if m.findOrder(order.OrderID) != nil {
+		return 0, fmt.Errorf("duplicate order_id %s", order.OrderID)
+	}
+
+	if _, err := m.postLedgerEntry(order.UserID, -order.Price, models.LedgerReasonOrderDebit, order.OrderID); err != nil {
+		return 0, err
+	}
+	m.orders = append(m.orders, &order)
+	return user.Balance, nil
+}
+
+func (m *MemoryStore) GetOrder(orderID string) (*models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order := m.findOrder(orderID)
+	if order == nil {
+		return nil, nil
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (m *MemoryStore) SetOrderAdminMessage(orderID string, chatID int64, messageID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if order := m.findOrder(orderID); order != nil {
+		order.AdminChatID = chatID
+		order.AdminMessageID = messageID
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetUserOrders(userID string, limit int64) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders []models.Order
+	for _, order := range m.orders {
+		if order.UserID == userID {
+			orders = append(orders, *order)
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].Timestamp.After(orders[j].Timestamp) })
+	if limit > 0 && int64(len(orders)) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (m *MemoryStore) FindAndUpdateOrder(orderID string, to models.OrderStatus, actor string) (*models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transitionOrder(orderID, to, actor)
+}
+
+func (m *MemoryStore) CancelOrder(orderID string, actor string) (*models.Order, error) {
+	return m.refundOrder(orderID, models.OrderCancelled, actor)
+}
+
+func (m *MemoryStore) RefundOrder(orderID string, actor string) (*models.Order, error) {
+	return m.refundOrder(orderID, models.OrderRefunded, actor)
+}
+
+func (m *MemoryStore) refundOrder(orderID string, to models.OrderStatus, actor string) (*models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.transitionOrder(orderID, to, actor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.postLedgerEntry(order.UserID, order.Price, models.LedgerReasonOrderRefund, orderID); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// transitionOrder must be called with m.mu held.
+func (m *MemoryStore) transitionOrder(orderID string, to models.OrderStatus, actor string) (*models.Order, error) {
+	order := m.findOrder(orderID)
+	if order == nil {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+
+	if _, err := order.Transition(to, actor, time.Now()); err != nil {
+		return nil, err
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (m *MemoryStore) findOrder(orderID string) *models.Order {
+	for _, order := range m.orders {
+		if order.OrderID == orderID {
+			return order
+		}
+	}
+	return nil
+}
+
+// Topup Functions
+func (m *MemoryStore) AddTopup(topup models.Topup) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findTopup(topup.TopupID) != nil {
+		return fmt.Errorf("duplicate topup_id %s", topup.TopupID)
+	}
+	m.topups = append(m.topups, &topup)
+	return nil
+}
+
+func (m *MemoryStore) FindAndUpdateTopup(topupID string, updates bson.M) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	topup := m.findTopup(topupID)
+	if topup == nil || topup.Status != "pending" {
+		return "", mongo.ErrNoDocuments
+	}
+
+	updated, err := applyTopupUpdates(*topup, updates)
+	if err != nil {
+		return "", err
+	}
+
+	if status, ok := updates["status"]; ok && status == "approved" && updated.Amount > 0 {
+		if _, err := m.postLedgerEntry(updated.UserID, updated.Amount, models.LedgerReasonTopupApproval, topupID); err != nil {
+			return "", err
+		}
+	}
+
+	*topup = updated
+	return topup.UserID, nil
+}
+
+func (m *MemoryStore) ReverseTopup(topupID, reversedBy, reason string) (*models.TopupReversal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	topup := m.findTopup(topupID)
+	if topup == nil || topup.Status != "approved" {
+		return nil, ErrTopupNotApproved
+	}
+
+	var commission *models.LedgerEntry
+	for i := range m.ledger {
+		if m.ledger[i].Reason == models.LedgerReasonReferralCommission && m.ledger[i].ReferenceID == topupID {
+			commission = &m.ledger[i]
+			break
+		}
+	}
+	if commission != nil && m.users[commission.UserID] == nil {
+		return nil, fmt.Errorf("user %s not found", commission.UserID)
+	}
+
+	entry, err := m.postLedgerEntry(topup.UserID, -topup.Amount, models.LedgerReasonTopupReversal, topupID)
+	if err != nil {
+		return nil, err
+	}
+
+	topup.Status = "reversed"
+	topup.ReversedBy = reversedBy
+	topup.ReversedAt = time.Now()
+	topup.ReversalReason = reason
+
+	reversal := &models.TopupReversal{Topup: *topup, UserBalance: entry.BalanceAfter}
+	if commission != nil {
+		referrerID, amount := commission.UserID, commission.Change
+		entry, err := m.postLedgerEntry(referrerID, -amount, models.LedgerReasonCommissionClawback, topupID)
+		if err != nil {
+			return nil, err
+		}
+		m.users[referrerID].ReferralEarnings -= amount
+		reversal.ReferrerID = referrerID
+		reversal.Commission = amount
+		reversal.ReferrerBalance = entry.BalanceAfter
+	}
+	return reversal, nil
+}
+
+func (m *MemoryStore) GetUserTopups(userID string, status string, limit int64) ([]models.Topup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var topups []models.Topup
+	for _, topup := range m.topups {
+		if topup.UserID == userID && (status == "" || topup.Status == status) {
+			topups = append(topups, *topup)
+		}
+	}
+	sort.SliceStable(topups, func(i, j int) bool { return topups[i].Timestamp.After(topups[j].Timestamp) })
+	if limit > 0 && int64(len(topups)) > limit {
+		topups = topups[:limit]
+	}
+	return topups, nil
+}
+
+func (m *MemoryStore) FindPendingTopup(userID string, amount int) (*models.Topup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, topup := range m.topups {
+		if topup.UserID == userID && topup.Amount == amount && topup.Status == "pending" {
+			copied := *topup
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) GetTopup(topupID string) (*models.Topup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	topup := m.findTopup(topupID)
+	if topup == nil {
+		return nil, nil
+	}
+	copied := *topup
+	return &copied, nil
+}
+
+func (m *MemoryStore) SetTopupAdminMessage(topupID string, chatID int64, messageID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if topup := m.findTopup(topupID); topup != nil {
+		topup.AdminChatID = chatID
+		topup.AdminMessageID = messageID
+	}
+	return nil
+}
+
+func (m *MemoryStore) findTopup(topupID string) *models.Topup {
+	for _, topup := range m.topups {
+		if topup.TopupID == topupID {
+			return topup
+		}
+	}
+	return nil
+}
+
+// Referral Functions
+func (m *MemoryStore) GetReferralStats(userID string, since time.Time, recent int64) (*models.ReferralStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := &models.ReferralStats{}
+	for _, user := range m.users {
+		if user.ReferredBy != userID {
+			continue
+		}
+		stats.Signups++
+		for _, topup := range m.topups {
+			if topup.UserID == user.UserID && topup.Status == "approved" {
+				stats.Active++
+				break
+			}
+		}
+	}
+
+	months := make(map[string]*models.MonthlyCommission)
+	for i := len(m.ledger) - 1; i >= 0; i-- {
+		entry := m.ledger[i]
+		if entry.UserID != userID || !isCommissionReason(entry.Reason) {
+			continue
+		}
+
+		if recent <= 0 || int64(len(stats.RecentCommissions)) < recent {
+			stats.RecentCommissions = append(stats.RecentCommissions, entry)
+		}
+
+		if entry.CreatedAt.Before(since) {
+			continue
+		}
+		month := entry.CreatedAt.UTC().Format("2006-01")
+		if months[month] == nil {
+			months[month] = &models.MonthlyCommission{Month: month}
+		}
+		months[month].Amount += entry.Change
+		if entry.Reason == models.LedgerReasonReferralCommission {
+			months[month].Count++
+		}
+	}
+
+	for _, month := range months {
+		stats.MonthlyCommission = append(stats.MonthlyCommission, *month)
+	}
+	sort.Slice(stats.MonthlyCommission, func(i, j int) bool {
+		return stats.MonthlyCommission[i].Month > stats.MonthlyCommission[j].Month
+	})
+	return stats, nil
+}
+
+func (m *MemoryStore) GetTopReferrers(from, to time.Time, limit int) ([]models.ReferrerRank, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inRange := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+
+	ranks := make(map[string]*models.ReferrerRank)
+	rankFor := func(referrerID string) *models.ReferrerRank {
+		if ranks[referrerID] == nil {
+			ranks[referrerID] = &models.ReferrerRank{ReferrerID: referrerID}
+		}
+		return ranks[referrerID]
+	}
+
+	for _, user := range m.users {
+		if user.ReferredBy == "" {
+			continue
+		}
+		if inRange(user.JoinedAt) {
+			rankFor(user.ReferredBy).Signups++
+		}
+		for _, topup := range m.topups {
+			if topup.UserID == user.UserID && topup.Status == "approved" && inRange(topup.ApprovedAt) {
+				rankFor(user.ReferredBy).Active++
+				break
+			}
+		}
+	}
+
+	for _, entry := range m.ledger {
+		if isCommissionReason(entry.Reason) && inRange(entry.CreatedAt) {
+			rankFor(entry.UserID).Commission += entry.Change
+		}
+	}
+
+	return sortReferrerRanks(ranks, limit), nil
+}
+
+func (m *MemoryStore) FindReferralTopups(referrerID string, amount int, payerKey string, since time.Time) ([]models.Topup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var topups []models.Topup
+	for _, topup := range m.topups {
+		user := m.users[topup.UserID]
+		if user == nil || user.ReferredBy != referrerID {
+			continue
+		}
+		if topup.Status == "approved" && topup.Amount == amount && topup.PayerKey == payerKey && !topup.ApprovedAt.Before(since) {
+			topups = append(topups, *topup)
+		}
+	}
+	return topups, nil
+}
+
+func (m *MemoryStore) FlagReferral(flag models.ReferralFlag) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.flags[flag.Key]
+	if !ok {
+		copied := flag
+		copied.UserIDs = appendMissing(nil, flag.UserIDs)
+		copied.TopupIDs = appendMissing(nil, flag.TopupIDs)
+		m.flags[flag.Key] = &copied
+		return true, nil
+	}
+
+	existing.UserIDs = appendMissing(existing.UserIDs, flag.UserIDs)
+	existing.TopupIDs = appendMissing(existing.TopupIDs, flag.TopupIDs)
+	existing.UpdatedAt = flag.UpdatedAt
+	return false, nil
+}
+
+// appendMissing mirrors $addToSet with $each.
+func appendMissing(values []string, add []string) []string {
+	for _, value := range add {
+		if !containsString(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+// History Functions
+func (m *MemoryStore) GetUserHistory(filter models.HistoryFilter) ([]models.HistoryEntry, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders []models.Order
+	if filter.Kind != models.HistoryTopups {
+		statuses := filter.Status.OrderStatuses()
+		for _, order := range m.orders {
+			if order.UserID == filter.UserID && (statuses == nil || containsString(statuses, string(order.Status))) {
+				orders = append(orders, *order)
+			}
+		}
+	}
+
+	var topups []models.Topup
+	if filter.Kind != models.HistoryOrders {
+		statuses := filter.Status.TopupStatuses()
+		for _, topup := range m.topups {
+			if topup.UserID == filter.UserID && (statuses == nil || containsString(statuses, topup.Status)) {
+				topups = append(topups, *topup)
+			}
+		}
+	}
+
+	entries := models.NewHistory(orders, topups)
+	return filter.PageOf(entries), len(entries), nil
+}
+
+// Product Functions
+func (m *MemoryStore) GetProducts(game string, activeOnly bool) ([]models.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var products []models.Product
+	for _, product := range m.products {
+		if product.Game == game && (product.Active || !activeOnly) {
+			products = append(products, product)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].SortOrder < products[j].SortOrder
+	})
+	return products, nil
+}
+
+func (m *MemoryStore) GetProduct(game, sku string) (*models.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	product, ok := m.products[productKey(game, sku)]
+	if !ok {
+		return nil, nil
+	}
+	return &product, nil
+}
+
+func (m *MemoryStore) SaveProducts(products []models.Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, product := range products {
+		product.UpdatedAt = time.Now()
+		m.products[productKey(product.Game, product.SKU)] = product
+	}
+	return nil
+}
+
+func productKey(game, sku string) string {
+	return game + "/" + sku
+}
+
+// Authorization Functions
+func (m *MemoryStore) LoadAuthorizedUsers() (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make(map[string]bool, len(m.authorized))
+	for userID := range m.authorized {
+		users[userID] = true
+	}
+	return users, nil
+}
+
+func (m *MemoryStore) AddAuthorizedUser(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.authorized[userID] = true
+	return nil
+}
+
+func (m *MemoryStore) RemoveAuthorizedUser(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.authorized, userID)
+	return nil
+}
+
+// Admin Functions
+func (m *MemoryStore) GetAdmin(userID string) (*models.Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admin, ok := m.admins[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &admin, nil
+}
+
+func (m *MemoryStore) GetAdmins() ([]models.Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admins := make([]models.Admin, 0, len(m.admins))
+	for _, admin := range m.admins {
+		admins = append(admins, admin)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].AddedAt.Before(admins[j].AddedAt) })
+	return admins, nil
+}
+
+func (m *MemoryStore) SetAdmin(admin models.Admin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.admins[admin.UserID] = admin
+	return nil
+}
+
+func (m *MemoryStore) RemoveAdmin(userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.admins[userID]; !ok {
+		return false, nil
+	}
+	delete(m.admins, userID)
+	return true, nil
+}
+
+// Audit Functions
+func (m *MemoryStore) AddAuditEntry(entry models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+func (m *MemoryStore) GetAuditLog(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []models.AuditEntry
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		entry := m.audit[i]
+		if filter.ActorID != "" && entry.ActorID != filter.ActorID {
+			continue
+		}
+		if filter.UserID != "" && entry.TargetUserID != filter.UserID {
+			continue
+		}
+		if filter.Action != "" && entry.Action != filter.Action {
+			continue
+		}
+		entries = append(entries, entry)
+		if filter.Limit > 0 && int64(len(entries)) == filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// Settings Functions
+func (m *MemoryStore) LoadSettings(defaultPayment, defaultMaintenance, defaultAffiliate, defaultAutoDelete map[string]interface{}) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.settings == nil {
+		m.settings = map[string]interface{}{
+			"_id":          "global_config",
+			"payment_info": copySettings(defaultPayment),
+			"maintenance":  copySettings(defaultMaintenance),
+			"affiliate":    copySettings(defaultAffiliate),
+			"auto_delete":  copySettings(defaultAutoDelete),
+		}
+	}
+	return copySettings(m.settings), nil
+}
+
+// UpdateSetting supports the same dotted keys as the MongoDB $set it mirrors,
+// e.g. "maintenance.orders".
+func (m *MemoryStore) UpdateSetting(key string, value interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.settings == nil {
+		m.settings = map[string]interface{}{"_id": "global_config"}
+	}
+
+	parts := strings.Split(key, ".")
+	current := m.settings
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+	return nil
+}
+
+func (m *MemoryStore) LoadPaymentMethods() ([]models.PaymentMethod, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Round-trip through BSON so both saved structs and plain maps decode
+	var config struct {
+		PaymentInfo    map[string]interface{} `bson:"payment_info"`
+		PaymentMethods []models.PaymentMethod `bson:"payment_methods"`
+	}
+	if m.settings != nil {
+		raw, err := bson.Marshal(m.settings)
+		if err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(raw, &config); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.PaymentMethods == nil {
+		return models.LegacyPaymentMethods(config.PaymentInfo), nil
+	}
+	return config.PaymentMethods, nil
+}
+
+func (m *MemoryStore) SavePaymentMethods(methods []models.PaymentMethod) error {
+	return m.UpdateSetting("payment_methods", methods)
+}
+
+// Callback Functions
+func (m *MemoryStore) ClaimCallback(key, action, handledByID, handledBy string) (bool, *models.ProcessedCallback, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.callbacks[key]; ok {
+		return false, &existing, nil
+	}
+
+	claim := models.ProcessedCallback{
+		Key:         key,
+		Action:      action,
+		HandledByID: handledByID,
+		HandledBy:   handledBy,
+		HandledAt:   time.Now(),
+	}
+	m.callbacks[key] = claim
+	return true, &claim, nil
+}
+
+func (m *MemoryStore) ReleaseCallback(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.callbacks, key)
+	return nil
+}
+
+// User State Functions
+func (m *MemoryStore) GetUserState(userID string) (*models.UserState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.states[userID]
+	if !ok {
+		return nil, nil
+	}
+	if !state.ExpiresAt.After(time.Now()) {
+		delete(m.states, userID)
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (m *MemoryStore) SetUserState(state models.UserState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.states[state.UserID] = state
+	return nil
+}
+
+func (m *MemoryStore) ClearUserState(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states, userID)
+	return nil
+}
+
+// applyTopupUpdates applies a $set-style update to a topup by round-tripping
+// it through BSON, so field names match the bson tags used by DBManager.
+func applyTopupUpdates(topup models.Topup, updates bson.M) (models.Topup, error) {
+	var updated models.Topup
+
+	raw, err := bson.Marshal(topup)
+	if err != nil {
+		return updated, err
+	}
+
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return updated, err
+	}
+	for key, value := range updates {
+		fields[key] = value
+	}
+
+	raw, err = bson.Marshal(fields)
+	if err != nil {
+		return updated, err
+	}
+	err = bson.Unmarshal(raw, &updated)
+	return updated, err
+}
+
+func copySettings(settings map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if nested, ok := value.(map[string]interface{}); ok {
+			copied[key] = copySettings(nested)
+		} else {
+			copied[key] = value
+		}
+	}
+	return copied
+}
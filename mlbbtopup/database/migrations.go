@@ -0,0 +1,266 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mlbbtopup/models"
+)
+
+// MigrateEmbeddedHistory moves orders and topups that are still embedded in
+// user documents into the orders and topups collections. Each user is moved
+// in its own transaction and the embedded arrays are removed afterwards, so
+// running it again only picks up users that have not been migrated yet.
+func (db *DBManager) MigrateEmbeddedHistory() (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cursor, err := db.usersCollection.Find(ctx, bson.M{"$or": []bson.M{
+		{"orders": bson.M{"$exists": true}},
+		{"topups": bson.M{"$exists": true}},
+	}})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	movedOrders, movedTopups := 0, 0
+	for cursor.Next(ctx) {
+		var legacy struct {
+			UserID string         `bson:"user_id"`
+			Orders []models.Order `bson:"orders"`
+			Topups []models.Topup `bson:"topups"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return movedOrders, movedTopups, err
+		}
+
+		err := db.withTransaction(ctx, func(sc mongo.SessionContext) error {
+			for _, order := range legacy.Orders {
+				if order.UserID == "" {
+					order.UserID = legacy.UserID
+				}
+
+				orderID, err := db.freeLegacyID(sc, db.ordersCollection, "order_id", order.OrderID)
+				if err != nil {
+					return err
+				}
+				order.OrderID = orderID
+
+				if _, err := db.ordersCollection.InsertOne(sc, order); err != nil {
+					return err
+				}
+			}
+
+			for _, topup := range legacy.Topups {
+				if topup.UserID == "" {
+					topup.UserID = legacy.UserID
+				}
+
+				topupID, err := db.freeLegacyID(sc, db.topupsCollection, "topup_id", topup.TopupID)
+				if err != nil {
+					return err
+				}
+				topup.TopupID = topupID
+
+				if _, err := db.topupsCollection.InsertOne(sc, topup); err != nil {
+					return err
+				}
+			}
+
+			_, err := db.usersCollection.UpdateOne(
+				sc,
+				bson.M{"user_id": legacy.UserID},
+				bson.M{"$unset": bson.M{"orders": "", "topups": ""}},
+			)
+			return err
+		})
+		if err != nil {
+			return movedOrders, movedTopups, err
+		}
+
+		movedOrders += len(legacy.Orders)
+		movedTopups += len(legacy.Topups)
+	}
+	return movedOrders, movedTopups, cursor.Err()
+}
+
+// MigrateOrderStatuses renames statuses written before the order lifecycle
+// was introduced.
+func (db *DBManager) MigrateOrderStatuses() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := db.ordersCollection.UpdateMany(
+		ctx,
+		bson.M{"status": "confirmed"},
+		bson.M{"$set": bson.M{"status": models.OrderCompleted}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// SeedProducts adds every catalog product that is not in the products
+// collection yet. Custom prices from the old per-game price documents are
+// carried over, along with items that only ever had a custom price. Products
+// that already exist are left as admins set them.
+func (db *DBManager) SeedProducts() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	added := 0
+	for _, game := range models.Games {
+		legacy, err := db.legacyPrices(ctx, game.Code)
+		if err != nil {
+			return added, err
+		}
+
+		products := make([]models.Product, 0, len(game.SKUs))
+		for i, sku := range game.SKUs {
+			products = append(products, game.Product(sku, i+1))
+		}
+
+		extra := make([]string, 0)
+		for code := range legacy {
+			if game.FindSKU(code) == nil {
+				extra = append(extra, code)
+			}
+		}
+		sort.Strings(extra)
+		for _, code := range extra {
+			products = append(products, models.Product{
+				Game:      game.Code,
+				SKU:       code,
+				Name:      code,
+				Category:  models.CategoryNormal,
+				SortOrder: len(products) + 1,
+				Active:    true,
+			})
+		}
+
+		for _, product := range products {
+			if price, ok := legacyPrice(legacy[product.SKU]); ok {
+				product.Price = price
+			} else if product.Price == 0 {
+				continue
+			}
+			product.UpdatedAt = time.Now()
+
+			result, err := db.productsCollection.UpdateOne(
+				ctx,
+				bson.M{"game": product.Game, "sku": product.SKU},
+				bson.M{"$setOnInsert": product},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				return added, err
+			}
+			if result.UpsertedCount > 0 {
+				added++
+			}
+		}
+	}
+	return added, nil
+}
+
+// legacyPrices reads a game's custom_prices document from before the
+// products collection. MLBB and PUBG had documents of their own; any other
+// game's lived in the prices collection under its own ID.
+func (db *DBManager) legacyPrices(ctx context.Context, game string) (map[string]interface{}, error) {
+	collection, docID := db.pricesCollection, game+"_prices"
+	switch game {
+	case models.GameMLBB:
+		docID = "custom_prices"
+	case models.GamePUBG:
+		collection, docID = db.pubgPricesCollection, "custom_prices"
+	}
+
+	var result struct {
+		Prices map[string]interface{} `bson:"prices"`
+	}
+	err := collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result.Prices, nil
+}
+
+// legacyPrice reads one custom price. MongoDB hands these back as int32,
+// int64 or float64 depending on how they were written, never as int.
+func legacyPrice(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// freeLegacyID returns id, or id with a numeric suffix if a migrated document
+// already uses it. Old IDs were built from Unix seconds and can collide.
+func (db *DBManager) freeLegacyID(ctx context.Context, collection *mongo.Collection, field string, id string) (string, error) {
+	candidate := id
+	for n := 2; ; n++ {
+		count, err := collection.CountDocuments(ctx, bson.M{field: candidate})
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", id, n)
+	}
+}
+
+// dedupeIDs gives every document that shares an ID with an older document a
+// suffixed ID, so that a unique index can be built on field.
+func (db *DBManager) dedupeIDs(ctx context.Context, collection *mongo.Collection, field string) error {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"timestamp": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$" + field,
+			"docs":  bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var duplicates []struct {
+		ID   string        `bson:"_id"`
+		Docs []interface{} `bson:"docs"`
+	}
+	if err = cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		for i, docID := range duplicate.Docs[1:] {
+			newID := fmt.Sprintf("%s-%d", duplicate.ID, i+2)
+			_, err := collection.UpdateOne(ctx, bson.M{"_id": docID}, bson.M{"$set": bson.M{field: newID}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mlbbtopup/models"
+)
+
+// Referral Functions
+
+// commissionReasons are the ledger entries that make up a referrer's
+// commission: credits, and the clawbacks posted when a topup is reversed.
+var commissionReasons = []string{
+	models.LedgerReasonReferralCommission,
+	models.LedgerReasonCommissionClawback,
+}
+
+// GetReferralStats returns the referrer's signups, how many of them have
+// topped up, net commission per month since the given time and the latest
+// commission and clawback entries.
+func (db *DBManager) GetReferralStats(userID string, since time.Time, recent int64) (*models.ReferralStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stats := &models.ReferralStats{}
+
+	referred, err := db.usersCollection.Distinct(ctx, "user_id", bson.M{"referred_by": userID})
+	if err != nil {
+		return nil, err
+	}
+	stats.Signups = len(referred)
+
+	if len(referred) > 0 {
+		active, err := db.topupsCollection.Distinct(ctx, "user_id", bson.M{
+			"user_id": bson.M{"$in": referred},
+			"status":  "approved",
+		})
+		if err != nil {
+			return nil, err
+		}
+		stats.Active = len(active)
+	}
+
+	cursor, err := db.ledgerCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id":    userID,
+			"reason":     bson.M{"$in": commissionReasons},
+			"created_at": bson.M{"$gte": since},
+		}}},
+		// Clawbacks are negative, so the sum is what the referrer kept
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$created_at"}},
+			"amount": bson.M{"$sum": "$change"},
+			"count": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$reason", models.LedgerReasonReferralCommission}}, 1, 0,
+			}}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": -1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &stats.MonthlyCommission); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(recent)
+	cursor, err = db.ledgerCollection.Find(ctx, bson.M{
+		"user_id": userID,
+		"reason":  bson.M{"$in": commissionReasons},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &stats.RecentCommissions); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetTopReferrers ranks referrers by net commission earned in [from, to), along
+// with the users they signed up and how many of those topped up in that time.
+func (db *DBManager) GetTopReferrers(from, to time.Time, limit int) ([]models.ReferrerRank, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ranks := make(map[string]*models.ReferrerRank)
+	rankFor := func(referrerID string) *models.ReferrerRank {
+		if ranks[referrerID] == nil {
+			ranks[referrerID] = &models.ReferrerRank{ReferrerID: referrerID}
+		}
+		return ranks[referrerID]
+	}
+
+	var counts []struct {
+		ReferrerID string `bson:"_id"`
+		Count      int    `bson:"count"`
+		Amount     int    `bson:"amount"`
+	}
+
+	// Signups in the range
+	cursor, err := db.usersCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"referred_by": bson.M{"$exists": true, "$ne": ""},
+			"joined_at":   bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$referred_by", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		rankFor(count.ReferrerID).Signups = count.Count
+	}
+
+	// Referred users with an approved topup in the range
+	cursor, err = db.usersCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"referred_by": bson.M{"$exists": true, "$ne": ""}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "topups",
+			"let":  bson.M{"uid": "$user_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"$expr":       bson.M{"$eq": bson.A{"$user_id", "$$uid"}},
+					"status":      "approved",
+					"approved_at": bson.M{"$gte": from, "$lt": to},
+				}},
+				bson.M{"$limit": 1},
+			},
+			"as": "topups",
+		}}},
+		{{Key: "$match", Value: bson.M{"topups.0": bson.M{"$exists": true}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$referred_by", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts = nil
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		rankFor(count.ReferrerID).Active = count.Count
+	}
+
+	// Commission paid in the range
+	cursor, err = db.ledgerCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"reason":     bson.M{"$in": commissionReasons},
+			"created_at": bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "amount": bson.M{"$sum": "$change"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts = nil
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		rankFor(count.ReferrerID).Commission = count.Amount
+	}
+
+	return sortReferrerRanks(ranks, limit), nil
+}
+
+// FindReferralTopups returns approved topups since the given time made by
+// users the referrer signed up, for one amount and payer.
+func (db *DBManager) FindReferralTopups(referrerID string, amount int, payerKey string, since time.Time) ([]models.Topup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	referred, err := db.usersCollection.Distinct(ctx, "user_id", bson.M{"referred_by": referrerID})
+	if err != nil {
+		return nil, err
+	}
+	if len(referred) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := db.topupsCollection.Find(ctx, bson.M{
+		"user_id":     bson.M{"$in": referred},
+		"status":      "approved",
+		"amount":      amount,
+		"payer_key":   payerKey,
+		"approved_at": bson.M{"$gte": since},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var topups []models.Topup
+	if err = cursor.All(ctx, &topups); err != nil {
+		return nil, err
+	}
+	return topups, nil
+}
+
+// FlagReferral records a suspicious pattern, merging users and topups into
+// an existing flag with the same key. It returns true for a new flag.
+func (db *DBManager) FlagReferral(flag models.ReferralFlag) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.referralFlagsCollection.UpdateOne(
+		ctx,
+		bson.M{"key": flag.Key},
+		bson.M{
+			"$setOnInsert": bson.M{
+				"referrer_id": flag.ReferrerID,
+				"reason":      flag.Reason,
+				"amount":      flag.Amount,
+				"payer_name":  flag.PayerName,
+				"created_at":  flag.CreatedAt,
+			},
+			"$set": bson.M{"updated_at": flag.UpdatedAt},
+			"$addToSet": bson.M{
+				"user_ids":  bson.M{"$each": flag.UserIDs},
+				"topup_ids": bson.M{"$each": flag.TopupIDs},
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+func isCommissionReason(reason string) bool {
+	return reason == models.LedgerReasonReferralCommission || reason == models.LedgerReasonCommissionClawback
+}
+
+// sortReferrerRanks orders by commission, then active referrals, then signups.
+func sortReferrerRanks(ranks map[string]*models.ReferrerRank, limit int) []models.ReferrerRank {
+	result := make([]models.ReferrerRank, 0, len(ranks))
+	for _, rank := range ranks {
+		result = append(result, *rank)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Commission != b.Commission {
+			return a.Commission > b.Commission
+		}
+		if a.Active != b.Active {
+			return a.Active > b.Active
+		}
+		if a.Signups != b.Signups {
+			return a.Signups > b.Signups
+		}
+		return a.ReferrerID < b.ReferrerID
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
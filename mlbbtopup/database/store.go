@@ -0,0 +1,129 @@
+package database
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"mlbbtopup/models"
+)
+
+// The handlers depend on these interfaces rather than on *DBManager, so the
+// bot can also run against MemoryStore without a MongoDB server.
+
+type UserStore interface {
+	GetUser(userID string) (*models.User, error)
+	GetAllUsers() ([]models.User, error)
+	CreateUser(userID, name, username string, referrerID *string) error
+	UpdateUserProfile(userID, name, username string) error
+	UpdateBalance(userID string, amountChange int, reason string, referenceID string) (*models.LedgerEntry, error)
+	SetBalance(userID string, amount int) error
+	UpdateReferralEarnings(userID string, commissionAmount int, referenceID string) error
+}
+
+type LedgerStore interface {
+	GetLedger(userID string, limit int64) ([]models.LedgerEntry, error)
+	LedgerBalance(userID string) (int, error)
+	VerifyBalance(userID string) (int, int, error)
+	RebuildBalance(userID string) (int, error)
+}
+
+type OrderStore interface {
+	AddOrder(order models.Order) error
+	PlaceOrder(order models.Order) (int, error)
+	GetOrder(orderID string) (*models.Order, error)
+	SetOrderAdminMessage(orderID string, chatID int64, messageID int) error
+	GetUserOrders(userID string, limit int64) ([]models.Order, error)
+	FindAndUpdateOrder(orderID string, to models.OrderStatus, actor string) (*models.Order, error)
+	CancelOrder(orderID string, actor string) (*models.Order, error)
+	RefundOrder(orderID string, actor string) (*models.Order, error)
+}
+
+type TopupStore interface {
+	AddTopup(topup models.Topup) error
+	FindAndUpdateTopup(topupID string, updates bson.M) (string, error)
+	GetTopup(topupID string) (*models.Topup, error)
+	SetTopupAdminMessage(topupID string, chatID int64, messageID int) error
+	GetUserTopups(userID string, status string, limit int64) ([]models.Topup, error)
+	FindPendingTopup(userID string, amount int) (*models.Topup, error)
+	ReverseTopup(topupID, reversedBy, reason string) (*models.TopupReversal, error)
+}
+
+type HistoryStore interface {
+	GetUserHistory(filter models.HistoryFilter) ([]models.HistoryEntry, int, error)
+}
+
+type ReferralStore interface {
+	GetReferralStats(userID string, since time.Time, recent int64) (*models.ReferralStats, error)
+	GetTopReferrers(from, to time.Time, limit int) ([]models.ReferrerRank, error)
+	FindReferralTopups(referrerID string, amount int, payerKey string, since time.Time) ([]models.Topup, error)
+	FlagReferral(flag models.ReferralFlag) (bool, error)
+}
+
+type ProductStore interface {
+	GetProducts(game string, activeOnly bool) ([]models.Product, error)
+	GetProduct(game, sku string) (*models.Product, error)
+	SaveProducts(products []models.Product) error
+}
+
+type AuthStore interface {
+	LoadAuthorizedUsers() (map[string]bool, error)
+	AddAuthorizedUser(userID string) error
+	RemoveAuthorizedUser(userID string) error
+}
+
+type AdminStore interface {
+	GetAdmin(userID string) (*models.Admin, error)
+	GetAdmins() ([]models.Admin, error)
+	SetAdmin(admin models.Admin) error
+	RemoveAdmin(userID string) (bool, error)
+}
+
+type AuditStore interface {
+	AddAuditEntry(entry models.AuditEntry) error
+	GetAuditLog(filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type SettingsStore interface {
+	LoadSettings(defaultPayment, defaultMaintenance, defaultAffiliate, defaultAutoDelete map[string]interface{}) (map[string]interface{}, error)
+	UpdateSetting(key string, value interface{}) error
+	LoadPaymentMethods() ([]models.PaymentMethod, error)
+	SavePaymentMethods(methods []models.PaymentMethod) error
+}
+
+type CallbackStore interface {
+	ClaimCallback(key, action, handledByID, handledBy string) (bool, *models.ProcessedCallback, error)
+	ReleaseCallback(key string) error
+}
+
+type StateStore interface {
+	GetUserState(userID string) (*models.UserState, error)
+	SetUserState(state models.UserState) error
+	ClearUserState(userID string) error
+}
+
+type SequenceStore interface {
+	NextSequence(name string) (int64, error)
+}
+
+type Store interface {
+	UserStore
+	LedgerStore
+	OrderStore
+	TopupStore
+	HistoryStore
+	ReferralStore
+	ProductStore
+	AuthStore
+	AdminStore
+	AuditStore
+	SettingsStore
+	CallbackStore
+	StateStore
+	SequenceStore
+}
+
+var (
+	_ Store = (*DBManager)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
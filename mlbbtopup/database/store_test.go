@@ -0,0 +1,601 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mlbbtopup/models"
+)
+
+// The same tests run against every Store. MemoryStore always runs; DBManager
+// runs too when MLBB_TEST_MONGO_URL points at a replica set.
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+
+	t.Run("mongo", func(t *testing.T) {
+		test(t, testDB(t))
+	})
+}
+
+// testDB connects to MLBB_TEST_MONGO_URL, skipping the test when it is not
+// set. Each test gets its own throwaway database.
+func testDB(t *testing.T) *DBManager {
+	t.Helper()
+
+	mongoURL := os.Getenv("MLBB_TEST_MONGO_URL")
+	if mongoURL == "" {
+		t.Skip("MLBB_TEST_MONGO_URL is not set")
+	}
+
+	db, err := newDBManager(mongoURL, fmt.Sprintf("mlbb_test_%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatalf("connecting to MongoDB: %v", err)
+	}
+	t.Cleanup(func() {
+		db.db.Drop(context.Background())
+		db.Close()
+	})
+	return db
+}
+
+func createUser(t *testing.T, store Store, userID string, referrerID *string, balance int) {
+	t.Helper()
+
+	if err := store.CreateUser(userID, "User "+userID, "user"+userID, referrerID); err != nil {
+		t.Fatalf("CreateUser(%s): %v", userID, err)
+	}
+	if balance != 0 {
+		if _, err := store.UpdateBalance(userID, balance, models.LedgerReasonAdjustment, "test"); err != nil {
+			t.Fatalf("UpdateBalance(%s): %v", userID, err)
+		}
+	}
+}
+
+func balanceOf(t *testing.T, store Store, userID string) int {
+	t.Helper()
+
+	user, err := store.GetUser(userID)
+	if err != nil || user == nil {
+		t.Fatalf("GetUser(%s) = %v, %v", userID, user, err)
+	}
+	return user.Balance
+}
+
+func approvedTopup(t *testing.T, store Store, topupID, userID string, amount int) {
+	t.Helper()
+
+	err := store.AddTopup(models.Topup{
+		TopupID:   topupID,
+		Amount:    amount,
+		Status:    "pending",
+		Timestamp: time.Now(),
+		UserID:    userID,
+	})
+	if err != nil {
+		t.Fatalf("AddTopup: %v", err)
+	}
+	if _, err := store.FindAndUpdateTopup(topupID, bson.M{"status": "approved", "approved_by": "admin"}); err != nil {
+		t.Fatalf("approving %s: %v", topupID, err)
+	}
+}
+
+func TestPlaceOrderInsufficientBalance(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		createUser(t, store, "1", nil, 1000)
+
+		order := models.Order{
+			OrderID:   "O1",
+			GameID:    "123456789",
+			ServerID:  "1234",
+			Amount:    "86",
+			Price:     1500,
+			Status:    "pending",
+			Timestamp: time.Now(),
+			UserID:    "1",
+		}
+		if _, err := store.PlaceOrder(order); !errors.Is(err, ErrInsufficientBalance) {
+			t.Fatalf("PlaceOrder over balance: err = %v, want ErrInsufficientBalance", err)
+		}
+		if got := balanceOf(t, store, "1"); got != 1000 {
+			t.Errorf("balance after refused order = %d, want 1000", got)
+		}
+		if saved, _ := store.GetOrder("O1"); saved != nil {
+			t.Errorf("refused order was stored: %+v", saved)
+		}
+
+		order.Price = 1000
+		newBalance, err := store.PlaceOrder(order)
+		if err != nil {
+			t.Fatalf("PlaceOrder for the whole balance: %v", err)
+		}
+		if newBalance != 0 {
+			t.Errorf("PlaceOrder returned balance %d, want 0", newBalance)
+		}
+		if saved, err := store.GetOrder("O1"); err != nil || saved == nil || saved.UserID != "1" {
+			t.Errorf("GetOrder(O1) = %+v, %v; want the placed order", saved, err)
+		}
+
+		entries, err := store.GetLedger("1", 0)
+		if err != nil {
+			t.Fatalf("GetLedger: %v", err)
+		}
+		if len(entries) == 0 || entries[0].Reason != models.LedgerReasonOrderDebit || entries[0].Change != -1000 {
+			t.Errorf("latest ledger entries = %+v, want the 1000 MMK order debit first", entries)
+		}
+	})
+}
+
+func TestRefundOrderCreditsOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		createUser(t, store, "1", nil, 3000)
+
+		order := models.Order{OrderID: "O1", Amount: "86", Price: 1000, Status: models.OrderPending, Timestamp: time.Now(), UserID: "1"}
+		if _, err := store.PlaceOrder(order); err != nil {
+			t.Fatalf("PlaceOrder: %v", err)
+		}
+
+		// Only completed and failed orders can be refunded
+		if _, err := store.RefundOrder("O1", "admin"); !errors.Is(err, models.ErrInvalidOrderTransition) {
+			t.Fatalf("refunding a pending order: err = %v, want ErrInvalidOrderTransition", err)
+		}
+		for _, to := range []models.OrderStatus{models.OrderProcessing, models.OrderCompleted} {
+			if _, err := store.FindAndUpdateOrder("O1", to, "admin"); err != nil {
+				t.Fatalf("moving O1 to %s: %v", to, err)
+			}
+		}
+
+		refunded, err := store.RefundOrder("O1", "admin")
+		if err != nil {
+			t.Fatalf("RefundOrder: %v", err)
+		}
+		if refunded.Status != models.OrderRefunded {
+			t.Errorf("refunded order status = %s, want refunded", refunded.Status)
+		}
+		if _, err := store.RefundOrder("O1", "admin"); err == nil {
+			t.Error("second RefundOrder succeeded")
+		}
+		if got := balanceOf(t, store, "1"); got != 3000 {
+			t.Errorf("balance after refund = %d, want 3000", got)
+		}
+
+		entries, err := store.GetLedger("1", 0)
+		if err != nil {
+			t.Fatalf("GetLedger: %v", err)
+		}
+		if len(entries) == 0 || entries[0].Reason != models.LedgerReasonOrderRefund || entries[0].Change != 1000 || entries[0].BalanceAfter != 3000 {
+			t.Errorf("latest ledger entries = %+v, want the 1000 MMK refund first", entries)
+		}
+	})
+}
+
+func TestBackfillOpeningBalances(t *testing.T) {
+	db := testDB(t)
+	createUser(t, db, "1", nil, 0)
+
+	// Balances written without a ledger entry, as before the ledger existed
+	setBalance := func(balance int) {
+		t.Helper()
+		_, err := db.usersCollection.UpdateOne(context.Background(),
+			bson.M{"user_id": "1"}, bson.M{"$set": bson.M{"balance": balance}})
+		if err != nil {
+			t.Fatalf("setting balance: %v", err)
+		}
+	}
+
+	setBalance(4000)
+	opened, adjusted, err := db.BackfillOpeningBalances()
+	if err != nil || opened != 1 || adjusted != 0 {
+		t.Fatalf("first backfill = %d, %d, %v; want 1 opening entry", opened, adjusted, err)
+	}
+
+	entries, err := db.GetLedger("1", 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ledger after backfill = %+v, %v", entries, err)
+	}
+	if entries[0].Reason != models.LedgerReasonOpeningBalance || entries[0].Change != 4000 || entries[0].BalanceAfter != 4000 {
+		t.Errorf("opening entry = %+v, want +4000 ending at 4000", entries[0])
+	}
+
+	// A balance that drifted after the opening entry gets an adjustment
+	if _, err := db.UpdateBalance("1", 1000, models.LedgerReasonTopupApproval, "T1"); err != nil {
+		t.Fatalf("UpdateBalance: %v", err)
+	}
+	setBalance(4500)
+	opened, adjusted, err = db.BackfillOpeningBalances()
+	if err != nil || opened != 0 || adjusted != 1 {
+		t.Fatalf("second backfill = %d, %d, %v; want 1 adjustment", opened, adjusted, err)
+	}
+
+	entries, _ = db.GetLedger("1", 1)
+	if len(entries) != 1 || entries[0].Reason != models.LedgerReasonAdjustment || entries[0].Change != -500 || entries[0].BalanceAfter != 4500 {
+		t.Errorf("latest entry = %+v, want a -500 adjustment ending at 4500", entries)
+	}
+	if stored, ledger, err := db.VerifyBalance("1"); err != nil || stored != ledger {
+		t.Errorf("VerifyBalance = %d, %d, %v; want them equal", stored, ledger, err)
+	}
+
+	// Nothing left to record
+	if opened, adjusted, err = db.BackfillOpeningBalances(); err != nil || opened != 0 || adjusted != 0 {
+		t.Errorf("third backfill = %d, %d, %v; want nothing", opened, adjusted, err)
+	}
+}
+
+func TestMigrateEmbeddedHistory(t *testing.T) {
+	db := testDB(t)
+
+	_, err := db.usersCollection.InsertOne(context.Background(), bson.M{
+		"user_id": "1",
+		"balance": 0,
+		"orders": []models.Order{
+			{OrderID: "O1", GameID: "123456789", ServerID: "1234", Amount: "86", Price: 4500, Status: "pending", Timestamp: time.Now()},
+		},
+		"topups": []models.Topup{
+			{TopupID: "T1", Amount: 5000, Status: "approved", Timestamp: time.Now()},
+			{TopupID: "T2", Amount: 3000, Status: "pending", Timestamp: time.Now()},
+		},
+	})
+	if err != nil {
+		t.Fatalf("inserting legacy user: %v", err)
+	}
+
+	orders, topups, err := db.MigrateEmbeddedHistory()
+	if err != nil || orders != 1 || topups != 2 {
+		t.Fatalf("MigrateEmbeddedHistory = %d, %d, %v; want 1, 2, nil", orders, topups, err)
+	}
+
+	migrated, err := db.GetUserOrders("1", 0)
+	if err != nil || len(migrated) != 1 || migrated[0].UserID != "1" {
+		t.Errorf("GetUserOrders = %+v, %v; want O1 owned by user 1", migrated, err)
+	}
+	pending, err := db.GetUserTopups("1", "pending", 0)
+	if err != nil || len(pending) != 1 || pending[0].TopupID != "T2" {
+		t.Errorf("pending topups = %+v, %v; want T2", pending, err)
+	}
+
+	// A second run finds nothing left to move
+	if orders, topups, err := db.MigrateEmbeddedHistory(); err != nil || orders != 0 || topups != 0 {
+		t.Errorf("second MigrateEmbeddedHistory = %d, %d, %v; want 0, 0, nil", orders, topups, err)
+	}
+}
+
+func TestSeedProductsKeepsCustomPrices(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	_, err := db.pricesCollection.InsertOne(ctx, bson.M{
+		"_id":    "custom_prices",
+		"prices": bson.M{"86": int32(4800), "999": int64(60000)},
+	})
+	if err != nil {
+		t.Fatalf("inserting legacy prices: %v", err)
+	}
+	if _, err := db.pubgPricesCollection.InsertOne(ctx, bson.M{
+		"_id":    "custom_prices",
+		"prices": bson.M{"660uc": 14500.0},
+	}); err != nil {
+		t.Fatalf("inserting legacy PUBG prices: %v", err)
+	}
+
+	added, err := db.SeedProducts()
+	if err != nil || added != len(models.DefaultProducts())+1 {
+		t.Fatalf("SeedProducts = %d, %v; want the catalog plus one custom item", added, err)
+	}
+
+	for _, tt := range []struct {
+		game, sku string
+		want      int
+	}{
+		{models.GameMLBB, "86", 4800},
+		{models.GameMLBB, "172", 10200},
+		{models.GameMLBB, "999", 60000},
+		{models.GamePUBG, "660uc", 14500},
+	} {
+		product, err := db.GetProduct(tt.game, tt.sku)
+		if err != nil || product == nil || product.Price != tt.want {
+			t.Errorf("GetProduct(%s, %s) = %+v, %v; want price %d", tt.game, tt.sku, product, err, tt.want)
+		}
+	}
+
+	// A second run leaves the catalog alone
+	if added, err := db.SeedProducts(); err != nil || added != 0 {
+		t.Errorf("second SeedProducts = %d, %v; want 0", added, err)
+	}
+}
+
+func TestNextSequenceNeverRepeats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+
+		seen := map[int64]bool{}
+		for i := 0; i < 5; i++ {
+			seq, err := store.NextSequence("orders")
+			if err != nil {
+				t.Fatalf("NextSequence: %v", err)
+			}
+			if seen[seq] {
+				t.Fatalf("NextSequence repeated %d", seq)
+			}
+			seen[seq] = true
+		}
+
+		// Each counter counts on its own
+		if seq, err := store.NextSequence("topups"); err != nil || seq != 1 {
+			t.Errorf("first topups sequence = %d, %v; want 1", seq, err)
+		}
+	})
+}
+
+func TestFindAndUpdateTopupAppliesOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		createUser(t, store, "1", nil, 0)
+		approvedTopup(t, store, "T1", "1", 5000)
+
+		_, err := store.FindAndUpdateTopup("T1", bson.M{"status": "approved", "approved_by": "admin"})
+		if err != mongo.ErrNoDocuments {
+			t.Fatalf("second approval: err = %v, want mongo.ErrNoDocuments", err)
+		}
+		if got := balanceOf(t, store, "1"); got != 5000 {
+			t.Errorf("balance = %d, want 5000 credited once", got)
+		}
+
+		entries, err := store.GetLedger("1", 0)
+		if err != nil {
+			t.Fatalf("GetLedger: %v", err)
+		}
+		credits := 0
+		for _, entry := range entries {
+			if entry.Reason == models.LedgerReasonTopupApproval {
+				credits++
+			}
+		}
+		if credits != 1 {
+			t.Errorf("found %d topup_approval entries, want 1", credits)
+		}
+	})
+}
+
+func TestClaimCallbackOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+
+		claimed, claim, err := store.ClaimCallback("topup_approve_T1", "approve", "1", "First Admin")
+		if err != nil || !claimed {
+			t.Fatalf("first claim = %v, %v; want claimed", claimed, err)
+		}
+		if claim.HandledBy != "First Admin" {
+			t.Errorf("claim handled by %q, want First Admin", claim.HandledBy)
+		}
+
+		claimed, claim, err = store.ClaimCallback("topup_approve_T1", "approve", "2", "Second Admin")
+		if err != nil || claimed {
+			t.Fatalf("second claim = %v, %v; want refused", claimed, err)
+		}
+		if claim.HandledByID != "1" {
+			t.Errorf("refused claim reports handler %q, want the first admin", claim.HandledByID)
+		}
+
+		if err := store.ReleaseCallback("topup_approve_T1"); err != nil {
+			t.Fatalf("ReleaseCallback: %v", err)
+		}
+		if claimed, _, err := store.ClaimCallback("topup_approve_T1", "approve", "2", "Second Admin"); err != nil || !claimed {
+			t.Errorf("claim after release = %v, %v; want claimed", claimed, err)
+		}
+	})
+}
+
+func TestUserStateExpires(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		topup := models.PendingTopup{Amount: 5000}
+
+		state := models.NewUserState("1", models.StateAwaitingScreenshot, topup, time.Now())
+		if err := store.SetUserState(state); err != nil {
+			t.Fatalf("SetUserState: %v", err)
+		}
+		if got, err := store.GetUserState("1"); err != nil || got == nil || got.Topup.Amount != 5000 {
+			t.Fatalf("GetUserState = %+v, %v; want the saved state", got, err)
+		}
+
+		expired := models.NewUserState("1", models.StateAwaitingScreenshot, topup, time.Now().Add(-3*time.Hour))
+		if err := store.SetUserState(expired); err != nil {
+			t.Fatalf("SetUserState: %v", err)
+		}
+		if got, err := store.GetUserState("1"); err != nil || got != nil {
+			t.Errorf("GetUserState after expiry = %+v, %v; want nil", got, err)
+		}
+	})
+}
+
+func TestUpdateReferralEarningsCreditsOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		createUser(t, store, "100", nil, 0)
+
+		if err := store.UpdateReferralEarnings("100", 250, "T1"); err != nil {
+			t.Fatalf("first credit: %v", err)
+		}
+		if err := store.UpdateReferralEarnings("100", 250, "T1"); !errors.Is(err, ErrAlreadyCredited) {
+			t.Fatalf("second credit: err = %v, want ErrAlreadyCredited", err)
+		}
+
+		user, err := store.GetUser("100")
+		if err != nil {
+			t.Fatalf("GetUser: %v", err)
+		}
+		if user.Balance != 250 || user.ReferralEarnings != 250 {
+			t.Errorf("balance %d, earnings %d; want 250 each", user.Balance, user.ReferralEarnings)
+		}
+	})
+}
+
+func TestReferralStatsAndLeaderboard(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		referrer := "100"
+		createUser(t, store, referrer, nil, 0)
+		createUser(t, store, "101", &referrer, 0)
+		createUser(t, store, "102", &referrer, 0)
+
+		approvedTopup(t, store, "T1", "101", 10000)
+		if err := store.UpdateReferralEarnings(referrer, 300, "T1"); err != nil {
+			t.Fatalf("UpdateReferralEarnings: %v", err)
+		}
+
+		since := time.Now().AddDate(0, -1, 0)
+		stats, err := store.GetReferralStats(referrer, since, 5)
+		if err != nil {
+			t.Fatalf("GetReferralStats: %v", err)
+		}
+		if stats.Signups != 2 || stats.Active != 1 {
+			t.Errorf("signups %d, active %d; want 2 and 1", stats.Signups, stats.Active)
+		}
+		if len(stats.MonthlyCommission) != 1 || stats.MonthlyCommission[0].Amount != 300 {
+			t.Errorf("monthly commission = %+v, want one month of 300", stats.MonthlyCommission)
+		}
+		if len(stats.RecentCommissions) != 1 || stats.RecentCommissions[0].ReferenceID != "T1" {
+			t.Errorf("recent commissions = %+v, want T1", stats.RecentCommissions)
+		}
+
+		ranks, err := store.GetTopReferrers(since, time.Now().Add(time.Minute), 10)
+		if err != nil {
+			t.Fatalf("GetTopReferrers: %v", err)
+		}
+		if len(ranks) != 1 || ranks[0].ReferrerID != referrer || ranks[0].Commission != 300 || ranks[0].Signups != 2 {
+			t.Errorf("ranks = %+v, want referrer 100 with 2 signups and 300 MMK", ranks)
+		}
+	})
+}
+
+func TestReverseTopupClawsBackCommission(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		referrerID := "100"
+		createUser(t, store, referrerID, nil, 0)
+		createUser(t, store, "1", &referrerID, 0)
+		approvedTopup(t, store, "T1", "1", 5000)
+		if err := store.UpdateReferralEarnings(referrerID, 250, "T1"); err != nil {
+			t.Fatalf("UpdateReferralEarnings: %v", err)
+		}
+
+		reversal, err := store.ReverseTopup("T1", "admin", "chargeback")
+		if err != nil {
+			t.Fatalf("ReverseTopup: %v", err)
+		}
+		if reversal.Topup.Status != "reversed" || reversal.UserBalance != 0 {
+			t.Errorf("reversal = %+v, want status reversed and user balance 0", reversal)
+		}
+		if reversal.ReferrerID != referrerID || reversal.Commission != 250 || reversal.ReferrerBalance != 0 {
+			t.Errorf("reversal = %+v, want 250 clawed back from %s", reversal, referrerID)
+		}
+
+		referrer, err := store.GetUser(referrerID)
+		if err != nil {
+			t.Fatalf("GetUser: %v", err)
+		}
+		if referrer.Balance != 0 || referrer.ReferralEarnings != 0 {
+			t.Errorf("referrer balance %d, earnings %d; want both 0", referrer.Balance, referrer.ReferralEarnings)
+		}
+
+		if _, err := store.ReverseTopup("T1", "admin", "again"); !errors.Is(err, ErrTopupNotApproved) {
+			t.Errorf("second ReverseTopup: err = %v, want ErrTopupNotApproved", err)
+		}
+	})
+}
+
+func TestAuditLogFilters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		start := time.Now()
+		entries := []models.AuditEntry{
+			{ActorID: "1", Action: models.AuditTopupApprove, TargetUserID: "42", TargetID: "T1"},
+			{ActorID: "2", Action: models.AuditDeduct, TargetUserID: "42"},
+			{ActorID: "1", Action: models.AuditBan, TargetUserID: "43"},
+		}
+		for i, entry := range entries {
+			entry.CreatedAt = start.Add(time.Duration(i) * time.Second)
+			if err := store.AddAuditEntry(entry); err != nil {
+				t.Fatalf("AddAuditEntry: %v", err)
+			}
+		}
+
+		got, err := store.GetAuditLog(models.AuditFilter{ActorID: "1"})
+		if err != nil {
+			t.Fatalf("GetAuditLog: %v", err)
+		}
+		if len(got) != 2 || got[0].Action != models.AuditBan {
+			t.Errorf("entries by admin 1 = %+v, want ban then topup_approve", got)
+		}
+
+		got, _ = store.GetAuditLog(models.AuditFilter{UserID: "42", Action: models.AuditDeduct})
+		if len(got) != 1 || got[0].ActorID != "2" {
+			t.Errorf("deducts on 42 = %+v, want the one by admin 2", got)
+		}
+
+		got, _ = store.GetAuditLog(models.AuditFilter{Limit: 1})
+		if len(got) != 1 {
+			t.Errorf("limit 1 returned %d entries", len(got))
+		}
+	})
+}
+
+func TestUpdateBalanceRefusesOverdraft(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		createUser(t, store, "1", nil, 1000)
+
+		if _, err := store.UpdateBalance("1", -1500, models.LedgerReasonAdminDeduct, "deduct"); !errors.Is(err, ErrInsufficientBalance) {
+			t.Fatalf("overdraft: err = %v, want ErrInsufficientBalance", err)
+		}
+		if got := balanceOf(t, store, "1"); got != 1000 {
+			t.Errorf("balance after refused debit = %d, want 1000", got)
+		}
+
+		entry, err := store.UpdateBalance("1", -400, models.LedgerReasonAdminDeduct, "deduct")
+		if err != nil {
+			t.Fatalf("UpdateBalance: %v", err)
+		}
+		if entry.BalanceAfter != 600 || entry.Amount != 400 {
+			t.Errorf("entry = %+v, want 400 debited leaving 600", entry)
+		}
+	})
+}
+
+func TestReferralStatsNetClawbacks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		referrerID := "100"
+		createUser(t, store, referrerID, nil, 0)
+		createUser(t, store, "1", &referrerID, 0)
+		for _, topupID := range []string{"T1", "T2"} {
+			approvedTopup(t, store, topupID, "1", 5000)
+			if err := store.UpdateReferralEarnings(referrerID, 150, topupID); err != nil {
+				t.Fatalf("UpdateReferralEarnings(%s): %v", topupID, err)
+			}
+		}
+		if _, err := store.ReverseTopup("T1", "admin", "chargeback"); err != nil {
+			t.Fatalf("ReverseTopup: %v", err)
+		}
+
+		stats, err := store.GetReferralStats(referrerID, time.Now().Add(-time.Hour), 10)
+		if err != nil {
+			t.Fatalf("GetReferralStats: %v", err)
+		}
+		if len(stats.MonthlyCommission) != 1 {
+			t.Fatalf("got %d months, want 1", len(stats.MonthlyCommission))
+		}
+		if month := stats.MonthlyCommission[0]; month.Amount != 150 || month.Count != 2 {
+			t.Errorf("month = %+v, want 150 MMK from 2 commissions", month)
+		}
+		if len(stats.RecentCommissions) != 3 || stats.RecentCommissions[0].Change != -150 {
+			t.Errorf("recent entries = %+v, want the clawback first", stats.RecentCommissions)
+		}
+
+		ranks, err := store.GetTopReferrers(time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 10)
+		if err != nil {
+			t.Fatalf("GetTopReferrers: %v", err)
+		}
+		if len(ranks) != 1 || ranks[0].ReferrerID != referrerID || ranks[0].Commission != 150 {
+			t.Errorf("ranks = %+v, want %s with 150 MMK", ranks, referrerID)
+		}
+	})
+}
@@ -16,12 +16,12 @@ import (
 )
 
 type AdminHandler struct {
-	bot      *tgbotapi.BotAPI
-	db       *database.DBManager
+	bot      utils.Sender
+	db       database.Store
 	config   *models.Config
 }
 
-func NewAdminHandler(bot *tgbotapi.BotAPI, db *database.DBManager, config *models.Config) *AdminHandler {
+func NewAdminHandler(bot utils.Sender, db database.Store, config *models.Config) *AdminHandler {
 	return &AdminHandler{
 		bot:    bot,
 		db:     db,
@@ -32,7 +32,7 @@ func NewAdminHandler(bot *tgbotapi.BotAPI, db *database.DBManager, config *model
 func (h *AdminHandler) HandleApprove(message *tgbotapi.Message, args string) {
 	userID := strconv.FormatInt(message.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermTopups) {
 		h.sendNotAdminMessage(message.Chat.ID)
 		return
 	}
@@ -59,6 +59,19 @@ func (h *AdminHandler) HandleApprove(message *tgbotapi.Message, args string) {
 		return
 	}
 
+	// Share the claim with the inline Approve/Reject buttons
+	actionKey := "topup:" + topupID
+	claimed, existing, err := h.db.ClaimCallback(actionKey, "topup_approve", userID, adminName)
+	if err != nil {
+		h.sendApprovalErrorMessage(message.Chat.ID)
+		return
+	}
+
+	if !claimed {
+		h.sendAlreadyHandledMessage(message.Chat.ID, topupID, existing.HandledBy)
+		return
+	}
+
 	updates := bson.M{
 		"status":      "approved",
 		"approved_by": adminName,
@@ -67,16 +80,25 @@ func (h *AdminHandler) HandleApprove(message *tgbotapi.Message, args string) {
 
 	approvedUserID, err := h.db.FindAndUpdateTopup(topupID, updates)
 	if err != nil {
+		h.db.ReleaseCallback(actionKey)
 		h.sendApprovalErrorMessage(message.Chat.ID)
 		return
 	}
 
+	recordAudit(h.db, message.From, models.AuditTopupApprove, approvedUserID, topupID,
+		bson.M{"status": "pending"}, bson.M{"status": "approved", "amount": amount})
+
 	// Clear user state if exists
-	// delete(userStates, targetUserID)
+	if err := utils.ClearTopupState(h.db, approvedUserID, topupID); err != nil {
+		log.Printf("Error clearing user state: %v", err)
+	}
 
 	// Notify user
 	h.notifyUserAboutApproval(approvedUserID, amount, adminName)
 
+	// Process affiliate commission
+	creditAffiliateCommission(h.bot, h.db, h.config.AdminGroupID, topupID)
+
 	// Send confirmation to admin
 	h.sendApprovalConfirmation(message.Chat.ID, targetUserID, amount)
 }
@@ -84,7 +106,7 @@ func (h *AdminHandler) HandleApprove(message *tgbotapi.Message, args string) {
 func (h *AdminHandler) HandleDeduct(message *tgbotapi.Message, args string) {
 	userID := strconv.FormatInt(message.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermBalance) {
 		h.sendNotAdminMessage(message.Chat.ID)
 		return
 	}
@@ -108,18 +130,25 @@ func (h *AdminHandler) HandleDeduct(message *tgbotapi.Message, args string) {
 		return
 	}
 
-	if userDoc.Balance < amount {
+	// The debit only applies while the balance covers it, so a concurrent
+	// order cannot push the balance below zero
+	entry, err := h.db.UpdateBalance(targetUserID, -amount, models.LedgerReasonAdminDeduct, userID)
+	if err == database.ErrInsufficientBalance {
+		if current, err := h.db.GetUser(targetUserID); err == nil && current != nil {
+			userDoc = current
+		}
 		h.sendInsufficientBalanceForDeduction(message.Chat.ID, amount, userDoc.Balance)
 		return
 	}
-
-	err = h.db.UpdateBalance(targetUserID, -amount)
 	if err != nil {
+		log.Printf("Error deducting %d from %s: %v", amount, targetUserID, err)
 		h.sendDeductionErrorMessage(message.Chat.ID)
 		return
 	}
 
-	newBalance := userDoc.Balance - amount
+	newBalance := entry.BalanceAfter
+	recordAudit(h.db, message.From, models.AuditDeduct, targetUserID, "",
+		bson.M{"balance": newBalance + amount}, bson.M{"balance": newBalance})
 
 	// Notify user
 	h.notifyUserAboutDeduction(targetUserID, amount, newBalance)
@@ -131,7 +160,7 @@ func (h *AdminHandler) HandleDeduct(message *tgbotapi.Message, args string) {
 func (h *AdminHandler) HandleBan(message *tgbotapi.Message, args string) {
 	userID := strconv.FormatInt(message.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermUsers) {
 		h.sendNotAdminMessage(message.Chat.ID)
 		return
 	}
@@ -161,6 +190,8 @@ func (h *AdminHandler) HandleBan(message *tgbotapi.Message, args string) {
 		h.sendBanErrorMessage(message.Chat.ID)
 		return
 	}
+	recordAudit(h.db, message.From, models.AuditBan, targetUserID, "",
+		bson.M{"authorized": true}, bson.M{"authorized": false})
 
 	// Notify user
 	h.notifyUserAboutBan(targetUserID)
@@ -175,7 +206,7 @@ func (h *AdminHandler) HandleBan(message *tgbotapi.Message, args string) {
 func (h *AdminHandler) HandleUnban(message *tgbotapi.Message, args string) {
 	userID := strconv.FormatInt(message.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermUsers) {
 		h.sendNotAdminMessage(message.Chat.ID)
 		return
 	}
@@ -205,9 +236,13 @@ func (h *AdminHandler) HandleUnban(message *tgbotapi.Message, args string) {
 		h.sendUnbanErrorMessage(message.Chat.ID)
 		return
 	}
+	recordAudit(h.db, message.From, models.AuditUnban, targetUserID, "",
+		bson.M{"authorized": false}, bson.M{"authorized": true})
 
 	// Clear user state if exists
-	// delete(userStates, targetUserID)
+	if err := h.db.ClearUserState(targetUserID); err != nil {
+		log.Printf("Error clearing user state: %v", err)
+	}
 
 	// Notify user
 	h.notifyUserAboutUnban(targetUserID)
@@ -222,39 +257,54 @@ func (h *AdminHandler) HandleUnban(message *tgbotapi.Message, args string) {
 func (h *AdminHandler) HandleSetPrice(message *tgbotapi.Message, args string) {
 	userID := strconv.FormatInt(message.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermPrices) {
 		h.sendNotAdminMessage(message.Chat.ID)
 		return
 	}
 
 	argList := strings.Fields(args)
+
+	// An optional game code comes first, e.g. /setprice pubg 660uc 15000
+	game := models.FindGame(models.GameMLBB)
+	if len(argList) > 0 {
+		if g := models.FindGame(strings.ToLower(argList[0])); g != nil {
+			game = g
+			argList = argList[1:]
+		}
+	}
+
 	if len(argList) < 2 {
 		h.sendSetPriceHelpMessage(message.Chat.ID)
 		return
 	}
 
 	item := strings.ToLower(argList[0])
-	customPrices, err := h.db.LoadPrices()
+	products, err := h.db.GetProducts(game.Code, false)
 	if err != nil {
-		log.Printf("Error loading prices: %v", err)
-		customPrices = make(map[string]interface{})
+		log.Printf("Error loading %s products: %v", game.Name, err)
+		h.sendPriceUpdateErrorMessage(message.Chat.ID)
+		return
+	}
+	catalog := make(map[string]models.Product, len(products))
+	for _, product := range products {
+		catalog[product.SKU] = product
 	}
 
 	// Handle batch updates for normal diamonds
 	if item == "normal" {
-		h.handleNormalDiamondsBatchUpdate(message.Chat.ID, argList[1:], customPrices)
+		h.handleBatchPriceUpdate(message, *game, models.CategoryNormal, argList[1:], catalog)
 		return
 	}
 
 	// Handle batch updates for 2x diamonds
 	if item == "2x" {
-		h.handle2xDiamondsBatchUpdate(message.Chat.ID, argList[1:], customPrices)
+		h.handleBatchPriceUpdate(message, *game, models.CategoryDouble, argList[1:], catalog)
 		return
 	}
 
-	// Single item update
-	if len(argList) != 2 {
-		h.sendInvalidFormatMessage(message.Chat.ID, "/setprice item price")
+	// Single item update, optionally with what the item costs us
+	if len(argList) != 2 && len(argList) != 3 {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/setprice [game] item price [cost]")
 		return
 	}
 
@@ -265,29 +315,46 @@ func (h *AdminHandler) HandleSetPrice(message *tgbotapi.Message, args string) {
 	}
 
 	// Handle weekly pass auto-update
-	if strings.HasPrefix(item, "wp") {
+	weeklyPasses := game.SKUsIn(models.CategoryWeeklyPass)
+	if strings.HasPrefix(item, "wp") && len(argList) == 2 {
 		weekNum, err := strconv.Atoi(item[2:])
-		if err == nil && weekNum >= 1 && weekNum <= 10 {
-			h.handleWeeklyPassUpdate(message.Chat.ID, weekNum, price, customPrices)
+		if err == nil && weekNum >= 1 && weekNum <= len(weeklyPasses) {
+			h.handleWeeklyPassUpdate(message, *game, weekNum, price, catalog)
 			return
 		}
 	}
 
 	// Single item update
-	customPrices[item] = price
-	err = h.db.SavePrices(customPrices)
+	item = game.NormalizeSKU(item)
+	product, exists := newOrExistingProduct(*game, item, catalog)
+	before := bson.M{item: nil}
+	if exists {
+		before[item] = product.Price
+	}
+	product.Price = price
+	if len(argList) == 3 {
+		cost, err := strconv.Atoi(argList[2])
+		if err != nil || cost < 0 {
+			h.sendInvalidAmountMessage(message.Chat.ID)
+			return
+		}
+		product.Cost = cost
+	}
+
+	err = h.db.SaveProducts([]models.Product{product})
 	if err != nil {
 		h.sendPriceUpdateErrorMessage(message.Chat.ID)
 		return
 	}
+	recordAudit(h.db, message.From, models.AuditSetPrice, "", priceAuditTarget(*game, item), before, bson.M{item: price})
 
-	h.sendPriceUpdateConfirmation(message.Chat.ID, item, price)
+	h.sendPriceUpdateConfirmation(message.Chat.ID, product.Name, price)
 }
 
 func (h *AdminHandler) HandleMaintenance(message *tgbotapi.Message, args string) {
 	userID := strconv.FormatInt(message.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermSettings) {
 		h.sendNotAdminMessage(message.Chat.ID)
 		return
 	}
@@ -314,135 +381,562 @@ func (h *AdminHandler) HandleMaintenance(message *tgbotapi.Message, args string)
 	newStatus := (status == "on")
 	settingKey := fmt.Sprintf("maintenance.%s", feature)
 
+	var oldStatus interface{}
+	if settings, err := utils.LoadSettings(h.db); err == nil {
+		if maintenance, ok := settings["maintenance"].(map[string]interface{}); ok {
+			oldStatus = maintenance[feature]
+		}
+	}
+
 	err := h.db.UpdateSetting(settingKey, newStatus)
 	if err != nil {
 		h.sendMaintenanceUpdateErrorMessage(message.Chat.ID)
 		return
 	}
+	recordAudit(h.db, message.From, models.AuditMaintenance, "", feature,
+		bson.M{"enabled": oldStatus}, bson.M{"enabled": newStatus})
 
 	h.sendMaintenanceUpdateConfirmation(message.Chat.ID, feature, newStatus)
 }
 
-// Helper methods
-func (h *AdminHandler) isAdmin(userID string) bool {
-	userIDInt, err := strconv.ParseInt(userID, 10, 64)
+// HandleSetPayment views and edits the payment methods customers can use:
+//
+//	/setpayment                      list all methods
+//	/setpayment kpay                 preview one method
+//	/setpayment kpay number 09xxxxxxx
+//	/setpayment kpay name U Mya
+//	/setpayment kpay qr              (as a reply to a photo)
+//	/setpayment kpay qr off
+//	/setpayment kpay min 1000 | max 500000
+//	/setpayment kpay on | off
+//	/setpayment ayapay add AYA Pay
+//	/setpayment ayapay remove
+func (h *AdminHandler) HandleSetPayment(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	if !h.can(userID, models.PermSettings) {
+		h.sendNotAdminMessage(message.Chat.ID)
+		return
+	}
+
+	methods, err := h.db.LoadPaymentMethods()
 	if err != nil {
+		log.Printf("Error loading payment methods: %v", err)
+		h.sendPaymentUpdateErrorMessage(message.Chat.ID)
+		return
+	}
+
+	argList := strings.Fields(args)
+	if len(argList) == 0 {
+		h.sendPaymentMethodsList(message.Chat.ID, methods)
+		return
+	}
+
+	code := strings.ToLower(argList[0])
+	if len(argList) == 1 {
+		method := models.FindPaymentMethod(methods, code)
+		if method == nil {
+			h.sendPaymentMethodNotFoundMessage(message.Chat.ID, code)
+			return
+		}
+		h.sendPaymentPreview(message.Chat.ID, *method)
+		return
+	}
+
+	field := strings.ToLower(argList[1])
+	value := strings.TrimSpace(strings.Join(argList[2:], " "))
+
+	var before, after interface{}
+	if method := models.FindPaymentMethod(methods, code); method != nil {
+		before = *method
+	}
+
+	switch field {
+	case "add":
+		if models.FindPaymentMethod(methods, code) != nil || value == "" || strings.Contains(code, "_") {
+			h.sendSetPaymentHelpMessage(message.Chat.ID)
+			return
+		}
+		methods = append(methods, models.PaymentMethod{Code: code, Name: value, MinAmount: 1000})
+	case "remove":
+		index := -1
+		for i := range methods {
+			if methods[i].Code == code {
+				index = i
+			}
+		}
+		if index < 0 {
+			h.sendPaymentMethodNotFoundMessage(message.Chat.ID, code)
+			return
+		}
+		methods = append(methods[:index], methods[index+1:]...)
+	default:
+		method := models.FindPaymentMethod(methods, code)
+		if method == nil {
+			h.sendPaymentMethodNotFoundMessage(message.Chat.ID, code)
+			return
+		}
+		if !h.applyPaymentField(message, method, field, value) {
+			h.sendSetPaymentHelpMessage(message.Chat.ID)
+			return
+		}
+	}
+
+	if err := h.db.SavePaymentMethods(methods); err != nil {
+		log.Printf("Error saving payment methods: %v", err)
+		h.sendPaymentUpdateErrorMessage(message.Chat.ID)
+		return
+	}
+
+	if method := models.FindPaymentMethod(methods, code); method != nil {
+		after = *method
+	}
+	recordAudit(h.db, message.From, models.AuditSetPayment, "", code, before, after)
+
+	if field == "remove" {
+		h.sendPaymentMethodsList(message.Chat.ID, methods)
+		return
+	}
+	h.sendPaymentPreview(message.Chat.ID, *models.FindPaymentMethod(methods, code))
+}
+
+// applyPaymentField changes one field of method. It returns false if the
+// field or value is not valid.
+func (h *AdminHandler) applyPaymentField(message *tgbotapi.Message, method *models.PaymentMethod, field string, value string) bool {
+	switch field {
+	case "number":
+		if value == "" {
+			return false
+		}
+		method.AccountNumber = value
+	case "name":
+		if value == "" {
+			return false
+		}
+		method.AccountName = value
+	case "title":
+		if value == "" {
+			return false
+		}
+		method.Name = value
+	case "qr":
+		if value == "off" {
+			method.QRFileID = ""
+			return true
+		}
+		// Take the largest size of the photo being replied to
+		reply := message.ReplyToMessage
+		if reply == nil || len(reply.Photo) == 0 {
+			return false
+		}
+		method.QRFileID = reply.Photo[len(reply.Photo)-1].FileID
+	case "min", "max":
+		amount, err := strconv.Atoi(value)
+		if err != nil || amount < 0 {
+			return false
+		}
+		if field == "min" {
+			method.MinAmount = amount
+		} else {
+			method.MaxAmount = amount
+		}
+	case "on", "off":
+		method.Enabled = (field == "on")
+	default:
 		return false
 	}
-	return userIDInt == h.config.AdminID
+	return true
 }
 
-func (h *AdminHandler) findPendingTopup(userID string, amount int) (string, error) {
-	userDoc, err := h.db.GetUser(userID)
+// HandleReverseTopup takes back an approved topup that was refunded or
+// charged back: /reversetopup TOPxxx reason
+func (h *AdminHandler) HandleReverseTopup(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	if !h.can(userID, models.PermBalance) {
+		h.sendNotAdminMessage(message.Chat.ID)
+		return
+	}
+
+	argList := strings.Fields(args)
+	if len(argList) < 2 {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/reversetopup TOPxxxx reason")
+		return
+	}
+
+	topupID := strings.ToUpper(argList[0])
+	reason := strings.Join(argList[1:], " ")
+	adminName := utils.GetUserDisplayName(message.From)
+
+	reversal, err := h.db.ReverseTopup(topupID, adminName, reason)
+	if err == database.ErrTopupNotApproved {
+		h.sendTopupNotReversibleMessage(message.Chat.ID, topupID)
+		return
+	}
 	if err != nil {
-		return "", err
+		log.Printf("Error reversing topup %s: %v", topupID, err)
+		h.sendReversalErrorMessage(message.Chat.ID)
+		return
 	}
 
-	if userDoc == nil {
-		return "", fmt.Errorf("user not found")
+	after := bson.M{"status": "reversed", "reason": reason, "user_balance": reversal.UserBalance}
+	if reversal.ReferrerID != "" {
+		after["referrer_id"] = reversal.ReferrerID
+		after["commission_clawback"] = reversal.Commission
+		after["referrer_balance"] = reversal.ReferrerBalance
 	}
+	recordAudit(h.db, message.From, models.AuditTopupReverse, reversal.Topup.UserID, topupID,
+		bson.M{"status": "approved", "amount": reversal.Topup.Amount}, after)
 
-	for _, topup := range userDoc.Topups {
-		if topup.Status == "pending" && topup.Amount == amount {
-			return topup.TopupID, nil
-		}
+	h.notifyUserAboutReversal(reversal)
+	if reversal.ReferrerID != "" {
+		h.notifyReferrerAboutClawback(reversal)
 	}
 
-	return "", fmt.Errorf("pending topup not found")
+	h.sendReversalConfirmation(message.Chat.ID, reversal)
 }
 
-func (h *AdminHandler) isValidFeature(feature string) bool {
-	validFeatures := []string{"orders", "topups", "general"}
-	for _, validFeature := range validFeatures {
-		if feature == validFeature {
-			return true
+// HandleTopReferrers shows the referrers with the most commission in a date
+// range: /topreferrers [from] [to], dates as YYYY-MM-DD. It defaults to the
+// current month, and to is inclusive.
+func (h *AdminHandler) HandleTopReferrers(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	if !h.can(userID, models.PermReports) {
+		h.sendNotAdminMessage(message.Chat.ID)
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+
+	argList := strings.Fields(args)
+	if len(argList) > 2 {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/topreferrers 2025-01-01 2025-01-31")
+		return
+	}
+
+	if len(argList) >= 1 {
+		date, err := time.ParseInLocation("2006-01-02", argList[0], now.Location())
+		if err != nil {
+			h.sendInvalidFormatMessage(message.Chat.ID, "/topreferrers 2025-01-01 2025-01-31")
+			return
 		}
+		from = date
 	}
-	return false
+
+	if len(argList) == 2 {
+		date, err := time.ParseInLocation("2006-01-02", argList[1], now.Location())
+		if err != nil || date.Before(from) {
+			h.sendInvalidFormatMessage(message.Chat.ID, "/topreferrers 2025-01-01 2025-01-31")
+			return
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+
+	ranks, err := h.db.GetTopReferrers(from, to, 10)
+	if err != nil {
+		log.Printf("Error getting top referrers: %v", err)
+		return
+	}
+
+	h.sendTopReferrers(message.Chat.ID, ranks, from, to)
 }
 
-func (h *AdminHandler) isValidStatus(status string) bool {
-	return status == "on" || status == "off"
+// Helper methods
+func (h *AdminHandler) HandleAddAdmin(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	if !h.can(userID, models.PermAdmins) {
+		h.sendNotAdminMessage(message.Chat.ID)
+		return
+	}
+
+	argList := strings.Fields(args)
+	if len(argList) != 2 {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/addadmin user_id admin|support|finance|owner")
+		return
+	}
+
+	targetUserID := argList[0]
+	role := models.AdminRole(strings.ToLower(argList[1]))
+	if !role.Valid() {
+		h.sendInvalidRoleMessage(message.Chat.ID)
+		return
+	}
+	if _, err := strconv.ParseInt(targetUserID, 10, 64); err != nil || targetUserID == strconv.FormatInt(h.config.AdminID, 10) {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/addadmin user_id admin|support|finance|owner")
+		return
+	}
+
+	name := "-"
+	if userDoc, err := h.db.GetUser(targetUserID); err == nil && userDoc != nil {
+		name = userDoc.Name
+	}
+
+	var before interface{}
+	if existing, err := h.db.GetAdmin(targetUserID); err == nil && existing != nil {
+		before = bson.M{"role": existing.Role}
+	}
+
+	admin := models.Admin{
+		UserID:  targetUserID,
+		Name:    name,
+		Role:    role,
+		AddedBy: utils.GetUserDisplayName(message.From),
+		AddedAt: time.Now(),
+	}
+	if err := h.db.SetAdmin(admin); err != nil {
+		log.Printf("Error adding admin %s: %v", targetUserID, err)
+		h.sendAdminUpdateErrorMessage(message.Chat.ID)
+		return
+	}
+
+	recordAudit(h.db, message.From, models.AuditAddAdmin, targetUserID, "", before, bson.M{"role": role})
+
+	h.notifyUserAboutAdminRole(targetUserID, role)
+	h.sendAdminAddedConfirmation(message.Chat.ID, admin)
 }
 
-func (h *AdminHandler) handleNormalDiamondsBatchUpdate(chatID int64, prices []string, customPrices map[string]interface{}) {
-	normalDiamonds := []string{"11", "22", "33", "56", "86", "112", "172", "257", "343",
-		"429", "514", "600", "706", "878", "963", "1049", "1135",
-		"1412", "2195", "3688", "5532", "9288", "12976"}
+func (h *AdminHandler) HandleRemoveAdmin(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
 
-	if len(prices) != len(normalDiamonds) {
-		h.sendInvalidBatchPriceCountMessage(chatID, len(normalDiamonds))
+	if !h.can(userID, models.PermAdmins) {
+		h.sendNotAdminMessage(message.Chat.ID)
 		return
 	}
 
-	updatedItems := []string{}
-	for i, diamond := range normalDiamonds {
-		price, err := strconv.Atoi(prices[i])
-		if err != nil || price < 0 {
-			h.sendInvalidPriceInBatchMessage(chatID, diamond)
+	argList := strings.Fields(args)
+	if len(argList) != 1 {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/removeadmin user_id")
+		return
+	}
+
+	targetUserID := argList[0]
+	existing, err := h.db.GetAdmin(targetUserID)
+	if err != nil {
+		log.Printf("Error getting admin %s: %v", targetUserID, err)
+		h.sendAdminUpdateErrorMessage(message.Chat.ID)
+		return
+	}
+
+	removed, err := h.db.RemoveAdmin(targetUserID)
+	if err != nil {
+		log.Printf("Error removing admin %s: %v", targetUserID, err)
+		h.sendAdminUpdateErrorMessage(message.Chat.ID)
+		return
+	}
+	if !removed {
+		h.sendNotAnAdminMessage(message.Chat.ID, targetUserID)
+		return
+	}
+
+	recordAudit(h.db, message.From, models.AuditRemoveAdmin, targetUserID, "", bson.M{"role": existing.Role}, nil)
+
+	h.notifyUserAboutAdminRemoval(targetUserID)
+	h.sendAdminRemovedConfirmation(message.Chat.ID, targetUserID)
+}
+
+func (h *AdminHandler) HandleAdmins(message *tgbotapi.Message) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	if !h.can(userID, models.PermAdmins) {
+		h.sendNotAdminMessage(message.Chat.ID)
+		return
+	}
+
+	admins, err := h.db.GetAdmins()
+	if err != nil {
+		log.Printf("Error getting admins: %v", err)
+		h.sendAdminUpdateErrorMessage(message.Chat.ID)
+		return
+	}
+
+	h.sendAdminsList(message.Chat.ID, admins)
+}
+
+// HandleAudit shows the latest admin actions, optionally filtered:
+// /audit [admin user_id] [user user_id] [action name]
+func (h *AdminHandler) HandleAudit(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	if !h.can(userID, models.PermAudit) {
+		h.sendNotAdminMessage(message.Chat.ID)
+		return
+	}
+
+	filter := models.AuditFilter{Limit: 20}
+	argList := strings.Fields(args)
+	if len(argList)%2 != 0 {
+		h.sendAuditHelpMessage(message.Chat.ID)
+		return
+	}
+	for i := 0; i < len(argList); i += 2 {
+		value := argList[i+1]
+		switch strings.ToLower(argList[i]) {
+		case "admin":
+			filter.ActorID = value
+		case "user":
+			filter.UserID = value
+		case "action":
+			filter.Action = strings.ToLower(value)
+		default:
+			h.sendAuditHelpMessage(message.Chat.ID)
 			return
 		}
-		customPrices[diamond] = price
-		updatedItems = append(updatedItems, fmt.Sprintf("%s=%d", diamond, price))
 	}
 
-	err := h.db.SavePrices(customPrices)
+	entries, err := h.db.GetAuditLog(filter)
 	if err != nil {
-		h.sendPriceUpdateErrorMessage(chatID)
+		log.Printf("Error getting audit log: %v", err)
 		return
 	}
 
-	h.sendBatchPriceUpdateConfirmation(chatID, "Normal Diamonds", updatedItems)
+	h.sendAuditLog(message.Chat.ID, entries)
+}
+
+func (h *AdminHandler) can(userID string, perm models.Permission) bool {
+	return utils.HasPermission(h.db, h.config.AdminID, userID, perm)
+}
+
+func (h *AdminHandler) findPendingTopup(userID string, amount int) (string, error) {
+	topup, err := h.db.FindPendingTopup(userID, amount)
+	if err != nil {
+		return "", err
+	}
+
+	if topup == nil {
+		return "", fmt.Errorf("pending topup not found")
+	}
+
+	return topup.TopupID, nil
+}
+
+func (h *AdminHandler) isValidFeature(feature string) bool {
+	validFeatures := []string{"orders", "topups", "general"}
+	for _, validFeature := range validFeatures {
+		if feature == validFeature {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *AdminHandler) isValidStatus(status string) bool {
+	return status == "on" || status == "off"
 }
 
-func (h *AdminHandler) handle2xDiamondsBatchUpdate(chatID int64, prices []string, customPrices map[string]interface{}) {
-	doublePass := []string{"55", "165", "275", "565"}
+// handleBatchPriceUpdate sets the price of every item in a category at once,
+// in catalog order.
+func (h *AdminHandler) handleBatchPriceUpdate(message *tgbotapi.Message, game models.Game, category models.ProductCategory, prices []string, catalog map[string]models.Product) {
+	chatID := message.Chat.ID
+	skus := game.SKUsIn(category)
 
-	if len(prices) != len(doublePass) {
-		h.sendInvalidBatchPriceCountMessage(chatID, len(doublePass))
+	if len(skus) == 0 || len(prices) != len(skus) {
+		h.sendInvalidBatchPriceCountMessage(chatID, len(skus))
 		return
 	}
 
+	updated := make([]models.Product, 0, len(skus))
 	updatedItems := []string{}
-	for i, diamond := range doublePass {
+	before, after := bson.M{}, bson.M{}
+	for i, sku := range skus {
 		price, err := strconv.Atoi(prices[i])
 		if err != nil || price < 0 {
-			h.sendInvalidPriceInBatchMessage(chatID, diamond)
+			h.sendInvalidPriceInBatchMessage(chatID, sku.Code)
 			return
 		}
-		customPrices[diamond] = price
-		updatedItems = append(updatedItems, fmt.Sprintf("%s=%d", diamond, price))
+		product, exists := newOrExistingProduct(game, sku.Code, catalog)
+		if exists {
+			before[sku.Code] = product.Price
+		}
+		product.Price = price
+		after[sku.Code] = price
+		updated = append(updated, product)
+		updatedItems = append(updatedItems, fmt.Sprintf("%s=%d", sku.Code, price))
 	}
 
-	err := h.db.SavePrices(customPrices)
+	err := h.db.SaveProducts(updated)
 	if err != nil {
 		h.sendPriceUpdateErrorMessage(chatID)
 		return
 	}
 
-	h.sendBatchPriceUpdateConfirmation(chatID, "2X Diamonds", updatedItems)
+	recordAudit(h.db, message.From, models.AuditSetPrice, "", priceAuditTarget(game, string(category)), before, after)
+
+	label := fmt.Sprintf("%s %s", game.Name, category)
+	switch {
+	case game.Code == models.GameMLBB && category == models.CategoryNormal:
+		label = "Normal Diamonds"
+	case game.Code == models.GameMLBB && category == models.CategoryDouble:
+		label = "2X Diamonds"
+	}
+	h.sendBatchPriceUpdateConfirmation(chatID, label, updatedItems)
 }
 
-func (h *AdminHandler) handleWeeklyPassUpdate(chatID int64, weekNum int, price int, customPrices map[string]interface{}) {
+// handleWeeklyPassUpdate prices every weekly pass from the price given for
+// one of them, keeping the same price per week.
+func (h *AdminHandler) handleWeeklyPassUpdate(message *tgbotapi.Message, game models.Game, weekNum int, price int, catalog map[string]models.Product) {
+	chatID := message.Chat.ID
 	basePricePerWeek := float64(price) / float64(weekNum)
+	updated := []models.Product{}
 	updatedItems := []string{}
+	before, after := bson.M{}, bson.M{}
 
-	for i := 1; i <= 10; i++ {
-		wpKey := fmt.Sprintf("wp%d", i)
-		wpPrice := int(basePricePerWeek * float64(i))
-		customPrices[wpKey] = wpPrice
-		updatedItems = append(updatedItems, fmt.Sprintf("%s=%d", wpKey, wpPrice))
+	for i, sku := range game.SKUsIn(models.CategoryWeeklyPass) {
+		wpPrice := int(basePricePerWeek * float64(i+1))
+		product, exists := newOrExistingProduct(game, sku.Code, catalog)
+		if exists {
+			before[sku.Code] = product.Price
+		}
+		product.Price = wpPrice
+		after[sku.Code] = wpPrice
+		updated = append(updated, product)
+		updatedItems = append(updatedItems, fmt.Sprintf("%s=%d", sku.Code, wpPrice))
 	}
 
-	err := h.db.SavePrices(customPrices)
+	err := h.db.SaveProducts(updated)
 	if err != nil {
 		h.sendPriceUpdateErrorMessage(chatID)
 		return
 	}
 
+	recordAudit(h.db, message.From, models.AuditSetPrice, "", priceAuditTarget(game, "wp"), before, after)
 	h.sendWeeklyPassUpdateConfirmation(chatID, int(basePricePerWeek), updatedItems)
 }
 
+// newOrExistingProduct returns the catalog product for an item, or a new
+// active product if the item has never been priced. The bool reports whether
+// it already existed.
+func newOrExistingProduct(game models.Game, sku string, catalog map[string]models.Product) (models.Product, bool) {
+	if product, ok := catalog[sku]; ok {
+		return product, true
+	}
+
+	product := models.Product{
+		Game:      game.Code,
+		SKU:       sku,
+		Name:      sku,
+		Category:  models.CategoryNormal,
+		SortOrder: len(catalog) + 1,
+		Active:    true,
+	}
+	if known := game.FindSKU(sku); known != nil {
+		product.Name, product.Category = known.Name, known.Category
+	}
+	return product, false
+}
+
+// priceAuditTarget names what a price change applied to. MLBB items keep the
+// bare names they were logged under before other games were added.
+func priceAuditTarget(game models.Game, item string) string {
+	if game.Code == models.GameMLBB {
+		return item
+	}
+	return game.Code + " " + item
+}
+
 // Message sending methods
 func (h *AdminHandler) sendNotAdminMessage(chatID int64) {
 	text := "❌ သင်သည် admin မဟုတ်ပါ!"
@@ -455,6 +949,12 @@ func (h *AdminHandler) sendApprovalConfirmation(chatID int64, userID string, amo
 	utils.SendMessage(h.bot, chatID, text, "Markdown")
 }
 
+func (h *AdminHandler) sendAlreadyHandledMessage(chatID int64, requestID string, handledBy string) {
+	text := fmt.Sprintf("⚠️ ***လုပ်ဆောင်ပြီးသား ဖြစ်ပါတယ်!***\n\n📝 ***ID:*** `%s`\n👤 ***Handled by:*** %s",
+		requestID, handledBy)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
 func (h *AdminHandler) sendDeductionConfirmation(chatID int64, userID string, amount int, newBalance int) {
 	text := fmt.Sprintf("✅ ***Balance နှုတ်ခြင်း အောင်မြင်ပါပြီ!***\n\n👤 User ID: `%s`\n💰 ***နှုတ်ခဲ့တဲ့ပမာဏ***: `%d MMK`\n💳 ***User လက်ကျန်ငွေ***: `%d MMK`", 
 		userID, amount, newBalance)
@@ -498,6 +998,329 @@ func (h *AdminHandler) sendMaintenanceUpdateConfirmation(chatID int64, feature s
 	utils.SendMessage(h.bot, chatID, text, "Markdown")
 }
 
+func (h *AdminHandler) sendInvalidFormatMessage(chatID int64, usage string) {
+	text := fmt.Sprintf("❌ ***Format မှားနေပါတယ်!***\n\n💡 ***အသုံးပြုပုံ:*** `%s`", usage)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendInvalidAmountMessage(chatID int64) {
+	text := "❌ ***ပမာဏ မှားနေပါတယ်!***\n\n💡 ***0 နှင့်အထက် ဂဏန်းသာ ထည့်ပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendTopupNotFoundMessage(chatID int64, userID string, amount int) {
+	text := fmt.Sprintf("❌ ***Pending topup မတွေ့ပါ!***\n\n👤 ***User ID:*** `%s`\n💰 ***Amount:*** `%d MMK`",
+		userID, amount)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendApprovalErrorMessage(chatID int64) {
+	text := "❌ ***Approve လုပ်ရာတွင် အမှားရှိပါတယ်!***\n\n💡 ***ခဏနေ ထပ်ကြိုးစားပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendUserNotFoundMessage(chatID int64, userID string) {
+	text := fmt.Sprintf("❌ ***User မတွေ့ပါ!***\n\n👤 User ID: `%s`", userID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendInsufficientBalanceForDeduction(chatID int64, amount int, balance int) {
+	text := fmt.Sprintf("❌ ***User လက်ကျန်ငွေ မလုံလောက်ပါ!***\n\n💰 ***နှုတ်မည့်ပမာဏ***: `%d MMK`\n💳 ***User လက်ကျန်ငွေ***: `%d MMK`",
+		amount, balance)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendDeductionErrorMessage(chatID int64) {
+	text := "❌ ***Balance နှုတ်ရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendUserNotAuthorizedMessage(chatID int64) {
+	text := "ℹ️ ***ဒီ user က အသုံးပြုခွင့် မရှိသေးပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendUserAlreadyAuthorizedMessage(chatID int64) {
+	text := "ℹ️ ***ဒီ user က အသုံးပြုခွင့် ရပြီးသား ဖြစ်ပါတယ်။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendBanErrorMessage(chatID int64) {
+	text := "❌ ***User ban လုပ်ရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendUnbanErrorMessage(chatID int64) {
+	text := "❌ ***User unban လုပ်ရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendSetPriceHelpMessage(chatID int64) {
+	text := "❌ ***Format မှားနေပါတယ်!***\n\n" +
+		"`/setprice 86 4500`\n" +
+		"`/setprice 86 4500 4200` ***(cost ပါ)***\n" +
+		"`/setprice wp1 5500` ***(weekly pass အားလုံး)***\n" +
+		"`/setprice normal 1000 2000 ...`\n" +
+		"`/setprice 2x 3000 6000 ...`\n" +
+		"`/setprice pubg 660uc 15000`"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendPriceUpdateErrorMessage(chatID int64) {
+	text := "❌ ***ဈေးနှုန်း ပြောင်းလဲရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendInvalidBatchPriceCountMessage(chatID int64, count int) {
+	text := fmt.Sprintf("❌ ***ဈေးနှုန်း `%d` ခု ထည့်ရပါမယ်!***\n\n💡 ***Item အားလုံးကို catalog အစဉ်အတိုင်း ထည့်ပါ။***", count)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendInvalidPriceInBatchMessage(chatID int64, item string) {
+	text := fmt.Sprintf("❌ ***ဈေးနှုန်း မှားနေပါတယ်!***\n\n💎 Item: `%s`", item)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendBatchPriceUpdateConfirmation(chatID int64, label string, items []string) {
+	text := fmt.Sprintf("✅ ***%s ဈေးနှုန်းများ ပြောင်းလဲပါပြီ!***\n\n`%s`", label, strings.Join(items, "`\n`"))
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendWeeklyPassUpdateConfirmation(chatID int64, pricePerWeek int, items []string) {
+	text := fmt.Sprintf("✅ ***Weekly Pass ဈေးနှုန်းများ ပြောင်းလဲပါပြီ!***\n\n📅 ***တစ်ပတ်လျှင်:*** `%d MMK`\n\n`%s`",
+		pricePerWeek, strings.Join(items, "`\n`"))
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendMaintenanceHelpMessage(chatID int64) {
+	text := "❌ ***Format မှားနေပါတယ်!***\n\n" +
+		"`/maintenance orders on|off`\n" +
+		"`/maintenance topups on|off`\n" +
+		"`/maintenance general on|off`"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendInvalidFeatureMessage(chatID int64) {
+	text := "❌ ***Feature မှားနေပါတယ်!***\n\n💡 `orders`, `topups`, `general` ***ထဲက တစ်ခု ရွေးပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendInvalidStatusMessage(chatID int64) {
+	text := "❌ ***Status မှားနေပါတယ်!***\n\n💡 `on` ***သို့မဟုတ်*** `off` ***ထည့်ပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendMaintenanceUpdateErrorMessage(chatID int64) {
+	text := "❌ ***Maintenance mode ပြောင်းလဲရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendTopReferrers(chatID int64, ranks []models.ReferrerRank, from, to time.Time) {
+	text := fmt.Sprintf("🏆 ***Top Referrers***\n📅 %s → %s\n\n",
+		from.Format("2006-01-02"), to.Add(-time.Second).Format("2006-01-02"))
+
+	if len(ranks) == 0 {
+		text += "ℹ️ ***ဒီကာလအတွင်း referral မရှိပါ။***"
+		utils.SendMessage(h.bot, chatID, text, "Markdown")
+		return
+	}
+
+	for i, rank := range ranks {
+		name := rank.ReferrerID
+		if user, err := h.db.GetUser(rank.ReferrerID); err == nil && user != nil && user.Name != "" {
+			name = user.Name
+		}
+
+		conversion := 0
+		if rank.Signups > 0 {
+			conversion = rank.Active * 100 / rank.Signups
+		}
+
+		text += fmt.Sprintf("%d. %s (`%s`)\n"+
+			"   👥 Signups: `%d` | ✅ Active: `%d` (%d%%)\n"+
+			"   💰 Commission: `%d MMK`\n",
+			i+1, name, rank.ReferrerID, rank.Signups, rank.Active, conversion, rank.Commission)
+	}
+
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendPaymentMethodsList(chatID int64, methods []models.PaymentMethod) {
+	text := "💳 ***Payment Methods***\n\n"
+	for _, method := range methods {
+		status := "🟢"
+		if !method.Enabled {
+			status = "🔴"
+		}
+
+		limit := fmt.Sprintf("%d+", method.MinAmount)
+		if method.MaxAmount > 0 {
+			limit = fmt.Sprintf("%d - %d", method.MinAmount, method.MaxAmount)
+		}
+
+		qr := "❌"
+		if method.QRFileID != "" {
+			qr = "✅"
+		}
+
+		text += fmt.Sprintf("%s ***%s*** (`%s`)\n📞 `%s` | 👤 %s\n💰 %s MMK | QR: %s\n\n",
+			status, method.Name, method.Code, method.AccountNumber, method.AccountName, limit, qr)
+	}
+	text += "💡 ***အသေးစိတ်ကြည့်ရန်:*** `/setpayment kpay`"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+// sendPaymentPreview shows the admin exactly what customers get after
+// choosing the method.
+func (h *AdminHandler) sendPaymentPreview(chatID int64, method models.PaymentMethod) {
+	status := "🟢 ***ဖွင့်ထား***"
+	if !method.Enabled {
+		status = "🔴 ***ပိတ်ထား***"
+	}
+
+	header := fmt.Sprintf("👁 ***Customer Preview*** — %s (`%s`)\n📊 Status: %s\n💰 Min: `%d` | Max: `%d` (0 = no limit)",
+		method.Name, method.Code, status, method.MinAmount, method.MaxAmount)
+	utils.SendMessage(h.bot, chatID, header, "Markdown")
+
+	if method.QRFileID != "" {
+		utils.SendPhoto(h.bot, chatID, method.QRFileID, utils.PaymentQRCaption(method), "Markdown")
+	}
+
+	amount := method.MinAmount
+	if amount < 1000 {
+		amount = 1000
+	}
+	utils.SendMessage(h.bot, chatID, utils.PaymentInstructions(method, amount), "Markdown")
+}
+
+func (h *AdminHandler) sendPaymentMethodNotFoundMessage(chatID int64, code string) {
+	text := fmt.Sprintf("❌ ***Payment method မတွေ့ပါ!***\n\n🔑 Code: `%s`\n\n💡 ***အားလုံးကြည့်ရန်:*** /setpayment", code)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendSetPaymentHelpMessage(chatID int64) {
+	text := "❌ ***Format မှားနေပါတယ်!***\n\n" +
+		"`/setpayment kpay number 09xxxxxxx`\n" +
+		"`/setpayment kpay name U Mya`\n" +
+		"`/setpayment kpay title KBZ Pay`\n" +
+		"`/setpayment kpay qr` ***(QR ပုံကို reply လုပ်ပါ)***\n" +
+		"`/setpayment kpay qr off`\n" +
+		"`/setpayment kpay min 1000`\n" +
+		"`/setpayment kpay max 500000`\n" +
+		"`/setpayment kpay on` / `off`\n" +
+		"`/setpayment ayapay add AYA Pay`\n" +
+		"`/setpayment ayapay remove`"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendPaymentUpdateErrorMessage(chatID int64) {
+	text := "❌ ***Payment settings ပြောင်းလဲရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendTopupNotReversibleMessage(chatID int64, topupID string) {
+	text := fmt.Sprintf("❌ ***Reverse လုပ်လို့ မရပါ!***\n\n📝 ***Topup ID:*** `%s`\n\n💡 ***Approve ပြီးသား topup ကိုသာ reverse လုပ်နိုင်ပါတယ်။***", topupID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendReversalErrorMessage(chatID int64) {
+	text := "❌ ***Topup reverse လုပ်ရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendReversalConfirmation(chatID int64, reversal *models.TopupReversal) {
+	topup := reversal.Topup
+	text := fmt.Sprintf("✅ ***Topup Reverse အောင်မြင်ပါပြီ!***\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"👤 ***User ID:*** `%s`\n"+
+		"💰 ***နှုတ်ခဲ့တဲ့ပမာဏ:*** `%d MMK`\n"+
+		"💳 ***User လက်ကျန်ငွေ:*** `%d MMK`\n"+
+		"📋 ***အကြောင်းရင်း:*** %s",
+		topup.TopupID, topup.UserID, topup.Amount, reversal.UserBalance, topup.ReversalReason)
+
+	if reversal.ReferrerID != "" {
+		text += fmt.Sprintf("\n\n🎁 ***Commission ပြန်ယူ:*** `%d MMK`\n"+
+			"👤 ***Referrer:*** `%s`\n"+
+			"💳 ***Referrer လက်ကျန်ငွေ:*** `%d MMK`",
+			reversal.Commission, reversal.ReferrerID, reversal.ReferrerBalance)
+	}
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendInvalidRoleMessage(chatID int64) {
+	text := "❌ ***Role မှားနေပါတယ်!***\n\n" +
+		"👑 `owner` - အားလုံး\n" +
+		"🛡 `admin` - admin စီမံခြင်းမှလွဲ၍ အားလုံး\n" +
+		"💬 `support` - orders, ban/unban\n" +
+		"💰 `finance` - topups, balance, reports"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendAdminUpdateErrorMessage(chatID int64) {
+	text := "❌ ***Admin စာရင်း ပြောင်းလဲရာတွင် အမှားရှိပါတယ်!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendNotAnAdminMessage(chatID int64, userID string) {
+	text := fmt.Sprintf("❌ ***Admin စာရင်းထဲမှာ မရှိပါ!***\n\n👤 User ID: `%s`", userID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendAdminAddedConfirmation(chatID int64, admin models.Admin) {
+	text := fmt.Sprintf("✅ ***Admin ထည့်ပြီးပါပြီ!***\n\n👤 User ID: `%s`\n🏷 Role: `%s`",
+		admin.UserID, admin.Role)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendAdminRemovedConfirmation(chatID int64, userID string) {
+	text := fmt.Sprintf("✅ ***Admin ဖယ်ရှားပြီးပါပြီ!***\n\n👤 User ID: `%s`", userID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendAdminsList(chatID int64, admins []models.Admin) {
+	text := fmt.Sprintf("👥 ***Admins***\n\n👑 `%d` - owner (config)\n", h.config.AdminID)
+	for _, admin := range admins {
+		text += fmt.Sprintf("• `%s` - %s (`%s`)\n", admin.UserID, admin.Name, admin.Role)
+	}
+	text += "\n💡 `/addadmin user_id role` | `/removeadmin user_id`"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendAuditHelpMessage(chatID int64) {
+	text := "❌ ***Format မှားနေပါတယ်!***\n\n" +
+		"`/audit`\n" +
+		"`/audit admin 123456789`\n" +
+		"`/audit user 123456789`\n" +
+		"`/audit action topup_approve`\n" +
+		"`/audit admin 123456789 action deduct`"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) sendAuditLog(chatID int64, entries []models.AuditEntry) {
+	if len(entries) == 0 {
+		utils.SendMessage(h.bot, chatID, "ℹ️ ***Audit log မှာ မှတ်တမ်း မရှိပါ။***", "Markdown")
+		return
+	}
+
+	text := "📜 ***Audit Log***\n\n"
+	for _, entry := range entries {
+		target := entry.TargetID
+		if entry.TargetUserID != "" {
+			target = strings.TrimSpace("👤 " + entry.TargetUserID + " " + entry.TargetID)
+		}
+		text += fmt.Sprintf("🕒 %s | `%s`\n"+
+			"🛡 %s (`%s`)\n"+
+			"🎯 `%s`\n"+
+			"↩️ `%s`\n"+
+			"➡️ `%s`\n\n",
+			entry.CreatedAt.Format("2006-01-02 15:04"), entry.Action,
+			entry.ActorName, entry.ActorID, target,
+			strings.ReplaceAll(formatAuditValue(entry.Before), "`", "'"),
+			strings.ReplaceAll(formatAuditValue(entry.After), "`", "'"))
+	}
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
 // Notification methods
 func (h *AdminHandler) notifyUserAboutApproval(userID string, amount int, adminName string) {
 	userDoc, err := h.db.GetUser(userID)
@@ -511,7 +1334,7 @@ func (h *AdminHandler) notifyUserAboutApproval(userID string, amount int, adminN
 	keyboard := utils.CreateInlineKeyboard([][]tgbotapi.InlineKeyboardButton{
 		{
 			tgbotapi.NewInlineKeyboardButtonURL("💎 Order တင်မယ်", 
-				fmt.Sprintf("https://t.me/%s?start=order", h.bot.Self.UserName)),
+				fmt.Sprintf("https://t.me/%s?start=order", h.config.BotUsername)),
 		},
 	})
 
@@ -539,3 +1362,58 @@ func (h *AdminHandler) notifyUserAboutUnban(userID string) {
 	text := "🎉 *Bot အသုံးပြုခွင့် ပြန်လည်ရရှိပါပြီ!*\n\n✅ Admin က သင့် ban ကို ဖြုတ်ပေးလိုက်ပါပြီ။\n\n🚀 ယခုအခါ /start နှိပ်ပြီး bot ကို အသုံးပြုနိုင်ပါပြီ!"
 	utils.SendMessage(h.bot, chatID, text, "Markdown")
 }
+
+func (h *AdminHandler) notifyAdminsAboutBan(adminName string, userID string) {
+	text := fmt.Sprintf("🚫 ***User Ban***\n\n👤 ***User ID:*** `%s`\n🛡 ***Banned by:*** %s", userID, adminName)
+	utils.SendMessage(h.bot, h.config.AdminGroupID, text, "Markdown")
+}
+
+func (h *AdminHandler) notifyAdminsAboutUnban(adminName string, userID string) {
+	text := fmt.Sprintf("✅ ***User Unban***\n\n👤 ***User ID:*** `%s`\n🛡 ***Unbanned by:*** %s", userID, adminName)
+	utils.SendMessage(h.bot, h.config.AdminGroupID, text, "Markdown")
+}
+
+func (h *AdminHandler) notifyUserAboutReversal(reversal *models.TopupReversal) {
+	topup := reversal.Topup
+	chatID, err := strconv.ParseInt(topup.UserID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	text := fmt.Sprintf("⚠️ ***ငွေဖြည့်မှု ပြန်လည်ရုပ်သိမ်းခံရပါပြီ***\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"💰 ***နှုတ်ခံရတဲ့ပမာဏ:*** `%d MMK`\n"+
+		"💳 ***လက်ကျန်ငွေ:*** `%d MMK`\n"+
+		"📋 ***အကြောင်းရင်း:*** %s\n\n"+
+		"📞 မေးခွန်းရှိရင် admin ကို ဆက်သွယ်ပါ။",
+		topup.TopupID, topup.Amount, reversal.UserBalance, topup.ReversalReason)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) notifyReferrerAboutClawback(reversal *models.TopupReversal) {
+	chatID, err := strconv.ParseInt(reversal.ReferrerID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	text := fmt.Sprintf("⚠️ ***Affiliate Commission ပြန်လည်နှုတ်ယူခံရပါပြီ***\n\n"+
+		"👤 ***သင့်ဖိတ်ခေါ်သူ:*** `%s`\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"🎁 ***နှုတ်ယူသော Commission:*** `%d MMK`\n"+
+		"💳 ***လက်ကျန်ငွေ:*** `%d MMK`\n\n"+
+		"ℹ️ ***ဖိတ်ခေါ်သူ၏ ငွေဖြည့်မှု ပြန်လည်ရုပ်သိမ်းခံရသောကြောင့် ဖြစ်ပါတယ်။***",
+		reversal.Topup.UserID, reversal.Topup.TopupID, reversal.Commission, reversal.ReferrerBalance)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) notifyUserAboutAdminRole(userID string, role models.AdminRole) {
+	chatID, _ := strconv.ParseInt(userID, 10, 64)
+	text := fmt.Sprintf("🛡 ***Admin အဖြစ် ခန့်အပ်ခံရပါပြီ!***\n\n🏷 Role: `%s`", role)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *AdminHandler) notifyUserAboutAdminRemoval(userID string) {
+	chatID, _ := strconv.ParseInt(userID, 10, 64)
+	text := "ℹ️ ***သင့်ရဲ့ admin အခွင့်အရေးကို ဖယ်ရှားလိုက်ပါပြီ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
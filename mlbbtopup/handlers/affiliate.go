@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"mlbbtopup/database"
+	"mlbbtopup/models"
+	"mlbbtopup/utils"
+)
+
+// creditAffiliateCommission pays the referrer of the topup's owner their
+// share of an approved topup, as configured in the affiliate settings. Both
+// the Approve button and /approve call it; the store makes sure a topup is
+// only paid out once.
+func creditAffiliateCommission(bot utils.Sender, db database.Store, adminGroupID int64, topupID string) {
+	topup, err := db.GetTopup(topupID)
+	if err != nil {
+		log.Printf("Error getting topup %s for commission: %v", topupID, err)
+		return
+	}
+	if topup == nil || topup.Status != "approved" {
+		return
+	}
+
+	user, err := db.GetUser(topup.UserID)
+	if err != nil {
+		log.Printf("Error getting user %s for commission: %v", topup.UserID, err)
+		return
+	}
+	if user == nil || user.ReferredBy == "" || user.ReferredBy == user.UserID {
+		return
+	}
+
+	settings, err := utils.LoadSettings(db)
+	if err != nil {
+		log.Printf("Error loading settings: %v", err)
+		return
+	}
+
+	affiliateBlock, _ := settings["affiliate"].(map[string]interface{})
+	commission := models.ParseAffiliateSettings(affiliateBlock).Commission(topup.Amount)
+	if commission <= 0 {
+		return
+	}
+
+	flagSuspiciousReferral(bot, db, adminGroupID, user.ReferredBy, topup)
+
+	err = db.UpdateReferralEarnings(user.ReferredBy, commission, topupID)
+	if err == database.ErrAlreadyCredited {
+		return
+	}
+	if err != nil {
+		log.Printf("Error crediting commission for topup %s: %v", topupID, err)
+		return
+	}
+
+	notifyReferrerAboutCommission(bot, db, user.ReferredBy, user, topup.Amount, commission)
+}
+
+// Referral chains longer than this are treated as circular.
+const maxReferralDepth = 10
+
+// validateReferrer returns the referrer from a /start link, or nil if the
+// link should be ignored: the referrer must be an existing, authorized user
+// other than the new user, and must not have been referred by them.
+func validateReferrer(db database.Store, ownerID int64, userID, referrerID string) *string {
+	if referrerID == "" || referrerID == userID {
+		return nil
+	}
+
+	authorizedUsers, err := db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return nil
+	}
+	if !authorizedUsers[referrerID] && referrerID != strconv.FormatInt(ownerID, 10) {
+		return nil
+	}
+
+	// Walk up the referrer's chain
+	current := referrerID
+	for depth := 0; depth < maxReferralDepth; depth++ {
+		user, err := db.GetUser(current)
+		if err != nil {
+			log.Printf("Error getting user %s for referral check: %v", current, err)
+			return nil
+		}
+		if user == nil {
+			if current == referrerID {
+				return nil
+			}
+			return &referrerID
+		}
+		if user.ReferredBy == "" {
+			return &referrerID
+		}
+		if user.ReferredBy == userID || user.ReferredBy == referrerID {
+			return nil
+		}
+		current = user.ReferredBy
+	}
+	return nil
+}
+
+// Window and number of referees that make a same-amount, same-payer pattern
+// suspicious.
+const (
+	suspiciousReferralWindow = 30 * 24 * time.Hour
+	suspiciousReferralUsers  = 3
+)
+
+// flagSuspiciousReferral records a flag when several of the referrer's
+// referees have topped up the same amount from the same payment account, and
+// alerts the admin group the first time. A topup without a payer name cannot
+// be checked, so it is flagged on its own. The commission is still paid;
+// admins can reverse the topups if it turns out to be abuse.
+func flagSuspiciousReferral(bot utils.Sender, db database.Store, adminGroupID int64, referrerID string, topup *models.Topup) {
+	if topup.PayerKey == "" {
+		flagReferralWithoutPayer(bot, db, adminGroupID, referrerID, topup)
+		return
+	}
+
+	now := time.Now()
+	topups, err := db.FindReferralTopups(referrerID, topup.Amount, topup.PayerKey, now.Add(-suspiciousReferralWindow))
+	if err != nil {
+		log.Printf("Error checking referral topups for %s: %v", referrerID, err)
+		return
+	}
+
+	var userIDs, topupIDs []string
+	seen := make(map[string]bool)
+	for _, t := range topups {
+		topupIDs = append(topupIDs, t.TopupID)
+		if !seen[t.UserID] {
+			seen[t.UserID] = true
+			userIDs = append(userIDs, t.UserID)
+		}
+	}
+	if len(userIDs) < suspiciousReferralUsers {
+		return
+	}
+
+	flag := models.ReferralFlag{
+		Key:        fmt.Sprintf("%s|%s|%d|%s", models.ReferralFlagSamePayer, referrerID, topup.Amount, topup.PayerKey),
+		ReferrerID: referrerID,
+		Reason:     models.ReferralFlagSamePayer,
+		Amount:     topup.Amount,
+		PayerName:  topup.PayerName,
+		UserIDs:    userIDs,
+		TopupIDs:   topupIDs,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	created, err := db.FlagReferral(flag)
+	if err != nil {
+		log.Printf("Error flagging referrer %s: %v", referrerID, err)
+		return
+	}
+	if !created {
+		return
+	}
+
+	text := fmt.Sprintf("🚩 ***Referral သံသယ ရှိနေပါတယ်!***\n\n"+
+		"👤 ***Referrer:*** `%s`\n"+
+		"👥 ***ဖိတ်ခေါ်ခံရသူ %d ဦး*** က ငွေလွှဲသူ တစ်ဦးတည်းဖြင့် `%d MMK` စီ ဖြည့်ထားပါတယ်။\n"+
+		"🧾 ***ငွေလွှဲသူအမည်:*** `%s`\n"+
+		"🆔 ***Users:*** `%s`\n"+
+		"📝 ***Topups:*** `%s`",
+		referrerID, len(userIDs), topup.Amount, strings.ReplaceAll(topup.PayerName, "`", "'"),
+		strings.Join(userIDs, ", "), strings.Join(topupIDs, ", "))
+	utils.SendMessage(bot, adminGroupID, text, "Markdown")
+}
+
+func flagReferralWithoutPayer(bot utils.Sender, db database.Store, adminGroupID int64, referrerID string, topup *models.Topup) {
+	now := time.Now()
+	flag := models.ReferralFlag{
+		Key:        fmt.Sprintf("%s|%s", models.ReferralFlagNoPayer, topup.TopupID),
+		ReferrerID: referrerID,
+		Reason:     models.ReferralFlagNoPayer,
+		Amount:     topup.Amount,
+		UserIDs:    []string{topup.UserID},
+		TopupIDs:   []string{topup.TopupID},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	created, err := db.FlagReferral(flag)
+	if err != nil {
+		log.Printf("Error flagging referrer %s: %v", referrerID, err)
+		return
+	}
+	if !created {
+		return
+	}
+
+	text := fmt.Sprintf("🚩 ***ငွေလွှဲသူအမည် မပါသော Referral ငွေဖြည့်မှု!***\n\n"+
+		"👤 ***Referrer:*** `%s`\n"+
+		"🆔 ***User:*** `%s`\n"+
+		"📝 ***Topup:*** `%s` (`%d MMK`)\n\n"+
+		"💡 ***Screenshot ကို စစ်ဆေးပေးပါ။***",
+		referrerID, topup.UserID, topup.TopupID, topup.Amount)
+	utils.SendMessage(bot, adminGroupID, text, "Markdown")
+}
+
+func notifyReferrerAboutCommission(bot utils.Sender, db database.Store, referrerID string, referred *models.User, topupAmount int, commission int) {
+	chatID, err := strconv.ParseInt(referrerID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	balanceText := ""
+	if referrer, err := db.GetUser(referrerID); err == nil && referrer != nil {
+		balanceText = fmt.Sprintf("\n💳 ***လက်ကျန်:*** `%d MMK`\n💸 ***စုစုပေါင်း ရရှိငွေ:*** `%d MMK`",
+			referrer.Balance, referrer.ReferralEarnings)
+	}
+
+	text := fmt.Sprintf("🎉 ***Affiliate Commission ရရှိပါပြီ!***\n\n"+
+		"👤 ***သင့်ဖိတ်ခေါ်သူ:*** `%s`\n"+
+		"💰 ***ငွေဖြည့်ပမာဏ:*** `%d MMK`\n"+
+		"🎁 ***Commission:*** `%d MMK`%s",
+		referred.UserID, topupAmount, commission, balanceText)
+	utils.SendMessage(bot, chatID, text, "Markdown")
+}
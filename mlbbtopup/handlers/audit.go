@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"mlbbtopup/database"
+	"mlbbtopup/models"
+	"mlbbtopup/utils"
+)
+
+// recordAudit writes an admin action to the audit log. A failed write is
+// logged but does not undo the action.
+func recordAudit(db database.AuditStore, actor *tgbotapi.User, action, targetUserID, targetID string, before, after interface{}) {
+	entry := models.AuditEntry{
+		ActorID:      strconv.FormatInt(actor.ID, 10),
+		ActorName:    utils.GetUserDisplayName(actor),
+		Action:       action,
+		TargetUserID: targetUserID,
+		TargetID:     targetID,
+		Before:       before,
+		After:        after,
+		CreatedAt:    time.Now(),
+	}
+	if err := db.AddAuditEntry(entry); err != nil {
+		log.Printf("Error writing audit entry %s for %s: %v", action, targetID, err)
+	}
+}
+
+// formatAuditValue prints a before/after value on one line. Documents read
+// back from MongoDB decode as bson.D, values written by MemoryStore keep
+// their Go types.
+func formatAuditValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case bson.D:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			parts = append(parts, fmt.Sprintf("%s=%s", e.Key, formatAuditValue(e.Value)))
+		}
+		return strings.Join(parts, ", ")
+	case bson.M:
+		return formatAuditMap(v)
+	case map[string]interface{}:
+		return formatAuditMap(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("%+v", value)
+}
+
+func formatAuditMap(m map[string]interface{}) string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", key, formatAuditValue(m[key])))
+	}
+	return strings.Join(parts, ", ")
+}
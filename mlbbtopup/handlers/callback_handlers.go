@@ -16,12 +16,12 @@ import (
 )
 
 type CallbackHandler struct {
-	bot      *tgbotapi.BotAPI
-	db       *database.DBManager
+	bot      utils.Sender
+	db       database.Store
 	config   *models.Config
 }
 
-func NewCallbackHandler(bot *tgbotapi.BotAPI, db *database.DBManager, config *models.Config) *CallbackHandler {
+func NewCallbackHandler(bot utils.Sender, db database.Store, config *models.Config) *CallbackHandler {
 	return &CallbackHandler{
 		bot:    bot,
 		db:     db,
@@ -30,27 +30,40 @@ func NewCallbackHandler(bot *tgbotapi.BotAPI, db *database.DBManager, config *mo
 }
 
 func (h *CallbackHandler) HandleCallback(callback *tgbotapi.CallbackQuery) {
-	userID := strconv.FormatInt(callback.From.ID, 10)
 	data := callback.Data
 
-	// Answer callback query immediately
-	callbackConfig := tgbotapi.NewCallback(callback.ID, "")
-	h.bot.Send(callbackConfig)
+	// Answer callback query immediately, except for admin actions and
+	// price sections which answer with their own result
+	if !isAdminActionCallback(data) && !isPriceSectionCallback(data) {
+		h.answerCallback(callback.ID, "")
+	}
 
 	// Handle different callback types
 	switch {
 	case strings.HasPrefix(data, "topup_pay_"):
 		h.handleTopupPaymentMethod(callback, data)
+	case strings.HasPrefix(data, "order_process_"):
+		h.handleOrderProcess(callback, data)
 	case strings.HasPrefix(data, "order_confirm_"):
 		h.handleOrderConfirm(callback, data)
+	case strings.HasPrefix(data, "order_fail_"):
+		h.handleOrderFail(callback, data)
 	case strings.HasPrefix(data, "order_cancel_"):
 		h.handleOrderCancel(callback, data)
+	case strings.HasPrefix(data, "order_refund_"):
+		h.handleOrderRefund(callback, data)
 	case strings.HasPrefix(data, "topup_approve_"):
 		h.handleTopupApprove(callback, data)
 	case strings.HasPrefix(data, "topup_reject_"):
 		h.handleTopupReject(callback, data)
 	case data == "topup_cancel":
 		h.handleTopupCancel(callback)
+	case strings.HasPrefix(data, "history_"):
+		h.handleHistoryPage(callback, data)
+	case strings.HasPrefix(data, "price_buy_"):
+		h.handlePriceBuy(callback, data)
+	case strings.HasPrefix(data, "price_"):
+		h.handlePriceSection(callback, data)
 	case data == "request_register":
 		h.handleRegisterRequest(callback)
 	case strings.HasPrefix(data, "register_approve_"):
@@ -64,184 +77,363 @@ func (h *CallbackHandler) HandleCallback(callback *tgbotapi.CallbackQuery) {
 
 func (h *CallbackHandler) handleTopupPaymentMethod(callback *tgbotapi.CallbackQuery, data string) {
 	userID := strconv.FormatInt(callback.From.ID, 10)
-	parts := strings.Split(data, "_")
-	
-	if len(parts) != 4 {
+
+	// topup_pay_<code>_<amount>
+	payload := strings.TrimPrefix(data, "topup_pay_")
+	sep := strings.LastIndex(payload, "_")
+	if sep <= 0 {
 		return
 	}
 
-	paymentMethod := parts[2]
-	amount, err := strconv.Atoi(parts[3])
+	paymentMethod := payload[:sep]
+	amount, err := strconv.Atoi(payload[sep+1:])
 	if err != nil {
 		return
 	}
 
-	// In production, you would store this in a proper state management system
-	// For now, we'll simulate with a simple approach
-	// pendingTopups[userID].PaymentMethod = paymentMethod
-
-	settings, err := h.db.LoadSettings(
-		map[string]interface{}{},
-		map[string]interface{}{}, 
-		map[string]interface{}{},
-		map[string]interface{}{},
-	)
+	methods, err := h.db.LoadPaymentMethods()
 	if err != nil {
-		log.Printf("Error loading settings: %v", err)
+		log.Printf("Error loading payment methods: %v", err)
 		return
 	}
 
-	paymentInfo, _ := settings["payment_info"].(map[string]interface{})
+	method := models.FindPaymentMethod(methods, paymentMethod)
+	if method == nil || !method.Accepts(amount) {
+		text := "❌ ***ဒီ Payment method ကို လောလောဆယ် အသုံးပြုလို့ မရပါ!***\n\n💡 ***တခြား method ရွေးပါ သို့မဟုတ်*** /topup ***ပြန်နှိပ်ပါ။***"
+		keyboard := utils.CreatePaymentMethodsKeyboard(methods, amount)
+		edit := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+		edit.ParseMode = "Markdown"
+		h.bot.Send(edit)
+		return
+	}
 
-	var paymentName, paymentNum, paymentAccName string
-	var paymentQr interface{}
+	// The payment method may still be changed until a screenshot is sent
+	state, err := h.db.GetUserState(userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+		return
+	}
 
-	if paymentMethod == "kpay" {
-		paymentName = "KBZ Pay"
-		paymentNum, _ = paymentInfo["kpay_number"].(string)
-		paymentAccName, _ = paymentInfo["kpay_name"].(string)
-		paymentQr = paymentInfo["kpay_image"]
-	} else {
-		paymentName = "Wave Money" 
-		paymentNum, _ = paymentInfo["wave_number"].(string)
-		paymentAccName, _ = paymentInfo["wave_name"].(string)
-		paymentQr = paymentInfo["wave_image"]
+	if state == nil || state.Topup.Amount != amount ||
+		(state.State != models.StateAwaitingPaymentMethod && state.State != models.StateAwaitingScreenshot) {
+		text := "❌ ***ငွေဖြည့်လုပ်ငန်းစဉ် သက်တမ်းကုန်သွားပါပြီ!***\n\n💡 ***ပြန်ဖြည့်ချင်ရင်*** /topup ***နှိပ်ပါ။***"
+		edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+		edit.ParseMode = "Markdown"
+		h.bot.Send(edit)
+		return
+	}
+
+	state.Topup.PaymentMethod = paymentMethod
+	state.Advance(models.StateAwaitingScreenshot, time.Now())
+	if err := h.db.SetUserState(*state); err != nil {
+		log.Printf("Error saving user state: %v", err)
+		return
 	}
 
 	// Send QR code if available
-	if paymentQr != nil {
-		if qrFileID, ok := paymentQr.(string); ok {
-			caption := fmt.Sprintf("📱 **%s QR Code**\n📞 နံပါတ်: `%s`\n👤 နာမည်: %s",
-				paymentName, paymentNum, paymentAccName)
-			utils.SendPhoto(h.bot, callback.Message.Chat.ID, qrFileID, caption, "Markdown")
-		}
+	if method.QRFileID != "" {
+		utils.SendPhoto(h.bot, callback.Message.Chat.ID, method.QRFileID, utils.PaymentQRCaption(*method), "Markdown")
 	}
 
 	// Update message with payment instructions
-	text := fmt.Sprintf("💳 ***ငွေဖြည့်လုပ်ငန်းစဉ်***\n\n"+
-		"✅ ***ပမာဏ:*** `%d MMK`\n"+
-		"✅ ***Payment:*** %s\n\n"+
-		"***အဆင့် 3: ငွေလွှဲပြီး Screenshot တင်ပါ။***\n\n"+
-		"📱 %s\n"+
-		"📞 ***နံပါတ်:*** `%s`\n"+
-		"👤 ***အမည်:*** %s\n\n"+
-		"⚠️ ***အရေးကြီးသော သတိပေးချက်:***\n"+
-		"***ငွေလွှဲ note/remark မှာ သင့်ရဲ့ %s အကောင့်နာမည်ကို ရေးပေးပါ။***\n\n"+
-		"💡 ***ငွေလွှဲပြီးရင် screenshot ကို ဒီမှာ တင်ပေးပါ။***\n"+
-		"ℹ️ ***ပယ်ဖျက်ရန် /cancel နှိပ်ပါ***",
-		amount, paymentName, paymentName, paymentNum, paymentAccName, paymentName)
+	text := utils.PaymentInstructions(*method, amount)
 
 	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
 	edit.ParseMode = "Markdown"
 	h.bot.Send(edit)
 }
 
-func (h *CallbackHandler) handleOrderConfirm(callback *tgbotapi.CallbackQuery, data string) {
+// handleHistoryPage moves /history to another page or filter in place.
+func (h *CallbackHandler) handleHistoryPage(callback *tgbotapi.CallbackQuery, data string) {
 	userID := strconv.FormatInt(callback.From.ID, 10)
-	
-	if !h.isAdmin(userID) {
+
+	filter := models.ParseHistoryFilter(userID, data)
+	text, keyboard, err := historyMessage(h.db, filter)
+	if err != nil {
+		log.Printf("Error loading history for %s: %v", userID, err)
 		return
 	}
 
-	adminName := utils.GetUserDisplayName(callback.From)
-	orderID := strings.TrimPrefix(data, "order_confirm_")
+	edit := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+	edit.ParseMode = "Markdown"
+	h.bot.Send(edit)
+}
 
-	updates := bson.M{
-		"status":       "confirmed",
-		"confirmed_by": adminName,
-		"confirmed_at": time.Now(),
-	}
+// handlePriceSection switches the /price list to another section in place.
+// It answers the callback itself so a failure shows on the button.
+func (h *CallbackHandler) handlePriceSection(callback *tgbotapi.CallbackQuery, data string) {
+	userID := strconv.FormatInt(callback.From.ID, 10)
 
-	targetUserID, err := h.db.FindAndUpdateOrder(orderID, updates)
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
 	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		h.answerCallback(callback.ID, "❌ ပြန်ကြိုးစားပါ")
+		return
+	}
+	if !authorizedUsers[userID] && userID != strconv.FormatInt(h.config.AdminID, 10) {
+		h.answerCallback(callback.ID, "🚫 အသုံးပြုခွင့် မရှိပါ")
 		return
 	}
 
-	// Update message
-	originalText := callback.Message.Text
-	updatedText := strings.Replace(originalText, "⏳ စောင့်ဆိုင်းနေသည်", 
-		fmt.Sprintf("✅ လက်ခံပြီး (by %s)", adminName), 1)
+	section, products, err := loadPriceSection(h.db, strings.TrimPrefix(data, "price_"))
+	if err != nil {
+		log.Printf("Error loading products: %v", err)
+		h.answerCallback(callback.ID, "❌ ဈေးနှုန်းများ ဖွင့်မရပါ၊ ပြန်ကြိုးစားပါ")
+		return
+	}
+	h.answerCallback(callback.ID, "")
 
-	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, updatedText)
+	text := utils.PriceListText(section, products)
+	keyboard := utils.CreatePriceListKeyboard(section, products)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
 	edit.ParseMode = "Markdown"
 	h.bot.Send(edit)
+}
 
-	// Remove inline keyboard
-	editReplyMarkup := tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, tgbotapi.InlineKeyboardMarkup{})
-	h.bot.Send(editReplyMarkup)
+// handlePriceBuy starts an order for a /price item and asks for the game
+// account; UserHandler.HandleOrderAccount places it.
+func (h *CallbackHandler) handlePriceBuy(callback *tgbotapi.CallbackQuery, data string) {
+	userID := strconv.FormatInt(callback.From.ID, 10)
+	chatID := callback.Message.Chat.ID
+
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return
+	}
+	if !authorizedUsers[userID] && userID != strconv.FormatInt(h.config.AdminID, 10) {
+		return
+	}
+
+	// price_buy_<game>_<sku>
+	payload := strings.TrimPrefix(data, "price_buy_")
+	sep := strings.Index(payload, "_")
+	if sep <= 0 {
+		return
+	}
+
+	game := models.FindGame(payload[:sep])
+	if game == nil {
+		return
+	}
+
+	product, err := h.db.GetProduct(game.Code, payload[sep+1:])
+	if err != nil {
+		log.Printf("Error loading %s product %s: %v", game.Name, payload[sep+1:], err)
+		return
+	}
+	if product == nil || !product.Active || product.Price <= 0 {
+		text := "❌ ***ဒီ item ကို လောလောဆယ် ဝယ်လို့ မရပါ!***\n\n💡 ***ဈေးနှုန်းများ ပြန်ကြည့်ရန်*** /price ***နှိပ်ပါ။***"
+		utils.SendMessage(h.bot, chatID, text, "Markdown")
+		return
+	}
+
+	// A topup in progress keeps its place until it is sent or cancelled
+	state, err := h.db.GetUserState(userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+		return
+	}
+	if state != nil && state.State != models.StateAwaitingOrderAccount {
+		text := "⏳ ***ငွေဖြည့်လုပ်ငန်းစဉ် မပြီးသေးပါ!***\n\n💡 ***ငွေဖြည့်ခြင်း ပြီးမှ သို့မဟုတ်*** /cancel ***နှိပ်ပြီးမှ order တင်ပါ။***"
+		utils.SendMessage(h.bot, chatID, text, "Markdown")
+		return
+	}
+
+	pending := models.NewUserState(userID, models.StateAwaitingOrderAccount, models.PendingTopup{}, time.Now())
+	pending.Order = models.PendingOrder{Game: game.Code, SKU: product.SKU}
+	if err := h.db.SetUserState(pending); err != nil {
+		log.Printf("Error saving user state: %v", err)
+		return
+	}
+
+	labels := make([]string, 0, len(game.IDFields))
+	for _, field := range game.IDFields {
+		labels = append(labels, field.Label)
+	}
+
+	text := fmt.Sprintf("🛒 ***%s***\n"+
+		"💰 ***ဈေးနှုန်း:*** `%d MMK`\n\n"+
+		"🎮 ***သင့် %s %s ကို ပို့ပေးပါ။***\n"+
+		"***ဥပမာ:*** `%s`\n\n"+
+		"ℹ️ ***ပယ်ဖျက်ရန် /cancel နှိပ်ပါ***",
+		product.Name, product.Price, game.Name, strings.Join(labels, " နဲ့ "), game.ExampleIDs())
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) handleOrderProcess(callback *tgbotapi.CallbackQuery, data string) {
+	adminName := utils.GetUserDisplayName(callback.From)
+	orderID := strings.TrimPrefix(data, "order_process_")
+
+	actionKey, ok := h.claimOrderAction(callback, orderID, models.OrderProcessing, "order_process")
+	if !ok {
+		return
+	}
+
+	order, err := h.db.FindAndUpdateOrder(orderID, models.OrderProcessing, adminName)
+	if err != nil {
+		log.Printf("Error processing order %s: %v", orderID, err)
+		h.releaseAction(callback, actionKey)
+		return
+	}
+	recordAudit(h.db, callback.From, models.AuditOrderProcess, order.UserID, orderID,
+		bson.M{"status": models.OrderPending}, bson.M{"status": order.Status})
+	h.answerCallback(callback.ID, "🔄 Processing")
+
+	h.updateOrderMessage(callback, order, fmt.Sprintf("🔄 လုပ်ဆောင်နေသည် (by %s)", adminName))
+
+	// Notify user
+	h.notifyUserAboutOrderProcessing(order)
+}
+
+func (h *CallbackHandler) handleOrderConfirm(callback *tgbotapi.CallbackQuery, data string) {
+	adminName := utils.GetUserDisplayName(callback.From)
+	orderID := strings.TrimPrefix(data, "order_confirm_")
+
+	actionKey, ok := h.claimOrderAction(callback, orderID, models.OrderCompleted, "order_confirm")
+	if !ok {
+		return
+	}
+
+	order, err := h.db.FindAndUpdateOrder(orderID, models.OrderCompleted, adminName)
+	if err != nil {
+		log.Printf("Error confirming order %s: %v", orderID, err)
+		h.releaseAction(callback, actionKey)
+		return
+	}
+	targetUserID := order.UserID
+	recordAudit(h.db, callback.From, models.AuditOrderConfirm, targetUserID, orderID,
+		bson.M{"status": models.OrderProcessing}, bson.M{"status": order.Status})
+	h.answerCallback(callback.ID, "✅ Confirmed")
+
+	h.updateOrderMessage(callback, order, fmt.Sprintf("✅ လက်ခံပြီး (by %s)", adminName))
 
 	// Notify other admins
 	h.notifyAdminsAboutOrderConfirmation(orderID, adminName, targetUserID)
 
 	// Notify user
-	h.notifyUserAboutOrderConfirmation(targetUserID, orderID)
+	h.notifyUserAboutOrderConfirmation(order)
 }
 
-func (h *CallbackHandler) handleOrderCancel(callback *tgbotapi.CallbackQuery, data string) {
-	userID := strconv.FormatInt(callback.From.ID, 10)
-	
-	if !h.isAdmin(userID) {
+func (h *CallbackHandler) handleOrderFail(callback *tgbotapi.CallbackQuery, data string) {
+	adminName := utils.GetUserDisplayName(callback.From)
+	orderID := strings.TrimPrefix(data, "order_fail_")
+
+	actionKey, ok := h.claimOrderAction(callback, orderID, models.OrderFailed, "order_fail")
+	if !ok {
 		return
 	}
 
+	order, err := h.db.FindAndUpdateOrder(orderID, models.OrderFailed, adminName)
+	if err != nil {
+		log.Printf("Error failing order %s: %v", orderID, err)
+		h.releaseAction(callback, actionKey)
+		return
+	}
+	recordAudit(h.db, callback.From, models.AuditOrderFail, order.UserID, orderID,
+		bson.M{"status": models.OrderProcessing}, bson.M{"status": order.Status})
+	h.answerCallback(callback.ID, "⚠️ Failed")
+
+	h.updateOrderMessage(callback, order, fmt.Sprintf("⚠️ မအောင်မြင်ပါ (by %s)", adminName))
+
+	// Notify user
+	h.notifyUserAboutOrderFailure(order)
+}
+
+func (h *CallbackHandler) handleOrderCancel(callback *tgbotapi.CallbackQuery, data string) {
 	adminName := utils.GetUserDisplayName(callback.From)
 	orderID := strings.TrimPrefix(data, "order_cancel_")
 
 	// Get order details first
 	order, err := h.getOrderByID(orderID)
-	if err != nil {
+	if err != nil || order == nil {
+		log.Printf("Error getting order %s: %v", orderID, err)
+		h.answerCallback(callback.ID, "")
 		return
 	}
+	previousStatus := order.Status
 
-	if order.Status != "pending" {
+	actionKey, ok := h.claimOrderAction(callback, orderID, models.OrderCancelled, "order_cancel")
+	if !ok {
 		return
 	}
 
-	refundAmount := order.Price
-	updates := bson.M{
-		"status":       "cancelled", 
-		"cancelled_by": adminName,
-		"cancelled_at": time.Now(),
-	}
-
-	targetUserID, err := h.db.FindAndUpdateOrder(orderID, updates)
+	// Cancel and refund balance in one step
+	order, err = h.db.CancelOrder(orderID, adminName)
 	if err != nil {
+		log.Printf("Error cancelling order %s: %v", orderID, err)
+		h.releaseAction(callback, actionKey)
 		return
 	}
+	targetUserID := order.UserID
+	refundAmount := order.Price
+	recordAudit(h.db, callback.From, models.AuditOrderCancel, targetUserID, orderID,
+		bson.M{"status": previousStatus}, bson.M{"status": order.Status, "refund": refundAmount})
+	h.answerCallback(callback.ID, "❌ Cancelled")
 
-	// Refund balance
-	h.db.UpdateBalance(targetUserID, refundAmount)
+	h.updateOrderMessage(callback, order, fmt.Sprintf("❌ ငြင်းပယ်ပြီး (by %s)", adminName))
 
-	// Update message
-	originalText := callback.Message.Text
-	updatedText := strings.Replace(originalText, "⏳ စောင့်ဆိုင်းနေသည်",
-		fmt.Sprintf("❌ ငြင်းပယ်ပြီး (by %s)", adminName), 1)
+	// Notify other admins
+	h.notifyAdminsAboutOrderCancellation(orderID, adminName, refundAmount)
 
-	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, updatedText)
-	edit.ParseMode = "Markdown"
-	h.bot.Send(edit)
+	// Notify user
+	h.notifyUserAboutOrderCancellation(targetUserID, orderID, refundAmount)
+}
 
-	// Remove inline keyboard  
-	editReplyMarkup := tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, tgbotapi.InlineKeyboardMarkup{})
-	h.bot.Send(editReplyMarkup)
+func (h *CallbackHandler) handleOrderRefund(callback *tgbotapi.CallbackQuery, data string) {
+	adminName := utils.GetUserDisplayName(callback.From)
+	orderID := strings.TrimPrefix(data, "order_refund_")
+
+	order, err := h.getOrderByID(orderID)
+	if err != nil || order == nil {
+		log.Printf("Error getting order %s: %v", orderID, err)
+		h.answerCallback(callback.ID, "")
+		return
+	}
+	previousStatus := order.Status
+
+	actionKey, ok := h.claimOrderAction(callback, orderID, models.OrderRefunded, "order_refund")
+	if !ok {
+		return
+	}
+
+	// Refund and record it in the ledger in one step
+	order, err = h.db.RefundOrder(orderID, adminName)
+	if err != nil {
+		log.Printf("Error refunding order %s: %v", orderID, err)
+		h.releaseAction(callback, actionKey)
+		return
+	}
+	refundAmount := order.Price
+	recordAudit(h.db, callback.From, models.AuditOrderRefund, order.UserID, orderID,
+		bson.M{"status": previousStatus}, bson.M{"status": order.Status, "refund": refundAmount})
+	h.answerCallback(callback.ID, "↩️ Refunded")
+
+	h.updateOrderMessage(callback, order, fmt.Sprintf("↩️ ငွေပြန်အမ်းပြီး (by %s)", adminName))
 
 	// Notify other admins
-	h.notifyAdminsAboutOrderCancellation(orderID, adminName, refundAmount)
+	h.notifyAdminsAboutOrderRefund(orderID, adminName, refundAmount)
 
 	// Notify user
-	h.notifyUserAboutOrderCancellation(targetUserID, orderID, refundAmount)
+	h.notifyUserAboutOrderRefund(order.UserID, orderID, refundAmount)
 }
 
 func (h *CallbackHandler) handleTopupApprove(callback *tgbotapi.CallbackQuery, data string) {
 	userID := strconv.FormatInt(callback.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermTopups) {
+		h.answerCallback(callback.ID, "")
 		return
 	}
 
 	adminName := utils.GetUserDisplayName(callback.From)
 	topupID := strings.TrimPrefix(data, "topup_approve_")
 
+	actionKey := "topup:" + topupID
+	if !h.claimAction(callback, actionKey, "topup_approve") {
+		return
+	}
+
 	updates := bson.M{
 		"status":      "approved",
 		"approved_by": adminName,
@@ -250,8 +442,17 @@ func (h *CallbackHandler) handleTopupApprove(callback *tgbotapi.CallbackQuery, d
 
 	targetUserID, err := h.db.FindAndUpdateTopup(topupID, updates)
 	if err != nil {
+		log.Printf("Error approving topup %s: %v", topupID, err)
+		h.releaseAction(callback, actionKey)
 		return
 	}
+	recordAudit(h.db, callback.From, models.AuditTopupApprove, targetUserID, topupID,
+		bson.M{"status": "pending"}, bson.M{"status": "approved"})
+	h.answerCallback(callback.ID, "✅ Approved")
+
+	if err := utils.ClearTopupState(h.db, targetUserID, topupID); err != nil {
+		log.Printf("Error clearing user state: %v", err)
+	}
 
 	// Update message caption if it's a photo message
 	if callback.Message.Photo != nil {
@@ -278,13 +479,19 @@ func (h *CallbackHandler) handleTopupApprove(callback *tgbotapi.CallbackQuery, d
 func (h *CallbackHandler) handleTopupReject(callback *tgbotapi.CallbackQuery, data string) {
 	userID := strconv.FormatInt(callback.From.ID, 10)
 	
-	if !h.isAdmin(userID) {
+	if !h.can(userID, models.PermTopups) {
+		h.answerCallback(callback.ID, "")
 		return
 	}
 
 	adminName := utils.GetUserDisplayName(callback.From)
 	topupID := strings.TrimPrefix(data, "topup_reject_")
 
+	actionKey := "topup:" + topupID
+	if !h.claimAction(callback, actionKey, "topup_reject") {
+		return
+	}
+
 	updates := bson.M{
 		"status":      "rejected", 
 		"rejected_by": adminName,
@@ -293,8 +500,17 @@ func (h *CallbackHandler) handleTopupReject(callback *tgbotapi.CallbackQuery, da
 
 	targetUserID, err := h.db.FindAndUpdateTopup(topupID, updates)
 	if err != nil {
+		log.Printf("Error rejecting topup %s: %v", topupID, err)
+		h.releaseAction(callback, actionKey)
 		return
 	}
+	recordAudit(h.db, callback.From, models.AuditTopupReject, targetUserID, topupID,
+		bson.M{"status": "pending"}, bson.M{"status": "rejected"})
+	h.answerCallback(callback.ID, "❌ Rejected")
+
+	if err := utils.ClearTopupState(h.db, targetUserID, topupID); err != nil {
+		log.Printf("Error clearing user state: %v", err)
+	}
 
 	// Update message caption if it's a photo message
 	if callback.Message.Photo != nil {
@@ -317,9 +533,18 @@ func (h *CallbackHandler) handleTopupReject(callback *tgbotapi.CallbackQuery, da
 
 func (h *CallbackHandler) handleTopupCancel(callback *tgbotapi.CallbackQuery) {
 	userID := strconv.FormatInt(callback.From.ID, 10)
-	
-	// In production, you would remove from pending topups
-	// delete(pendingTopups, userID)
+
+	// Only an unsubmitted topup can be cancelled here
+	state, err := h.db.GetUserState(userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+		return
+	}
+	if state != nil && state.State != models.StateWaitingApproval {
+		if err := h.db.ClearUserState(userID); err != nil {
+			log.Printf("Error clearing user state: %v", err)
+		}
+	}
 
 	text := "✅ ***ငွေဖြည့်ခြင်း ပယ်ဖျက်ပါပြီ!***\n\n💡 ***ပြန်ဖြည့်ချင်ရင်*** /topup ***နှိပ်ပါ။***"
 	
@@ -328,19 +553,204 @@ func (h *CallbackHandler) handleTopupCancel(callback *tgbotapi.CallbackQuery) {
 	h.bot.Send(edit)
 }
 
+// handleRegisterRequest sends a registration request for the user who
+// tapped the button.
+func (h *CallbackHandler) handleRegisterRequest(callback *tgbotapi.CallbackQuery) {
+	userID := strconv.FormatInt(callback.From.ID, 10)
+
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return
+	}
+	if authorizedUsers[userID] {
+		text := "✅ သင်သည် အသုံးပြုခွင့် ရပြီးသား ဖြစ်ပါတယ်!\n\n🚀 /start နှိပ်ပါ။"
+		utils.SendMessage(h.bot, callback.Message.Chat.ID, text, "Markdown")
+		return
+	}
+
+	NewUserHandler(h.bot, h.db, h.config).handleRegistrationRequest(callback.From)
+}
+
+func (h *CallbackHandler) handleRegisterApprove(callback *tgbotapi.CallbackQuery, data string) {
+	userID := strconv.FormatInt(callback.From.ID, 10)
+
+	if !h.can(userID, models.PermUsers) {
+		h.answerCallback(callback.ID, "")
+		return
+	}
+
+	adminName := utils.GetUserDisplayName(callback.From)
+	targetUserID := strings.TrimPrefix(data, "register_approve_")
+
+	actionKey := "register:" + targetUserID
+	if !h.claimAction(callback, actionKey, "register_approve") {
+		return
+	}
+
+	if err := h.db.AddAuthorizedUser(targetUserID); err != nil {
+		log.Printf("Error authorizing user %s: %v", targetUserID, err)
+		h.releaseAction(callback, actionKey)
+		return
+	}
+	recordAudit(h.db, callback.From, models.AuditRegisterApprove, targetUserID, "",
+		bson.M{"authorized": false}, bson.M{"authorized": true})
+	h.answerCallback(callback.ID, "✅ Approved")
+
+	h.markRegistrationHandled(callback, fmt.Sprintf("✅ Approved by: %s", adminName))
+
+	chatID, _ := strconv.ParseInt(targetUserID, 10, 64)
+	text := "🎉 ***Registration အတည်ပြုပါပြီ!***\n\n🚀 ***/start နှိပ်ပြီး bot ကို အသုံးပြုနိုင်ပါပြီ!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) handleRegisterReject(callback *tgbotapi.CallbackQuery, data string) {
+	userID := strconv.FormatInt(callback.From.ID, 10)
+
+	if !h.can(userID, models.PermUsers) {
+		h.answerCallback(callback.ID, "")
+		return
+	}
+
+	adminName := utils.GetUserDisplayName(callback.From)
+	targetUserID := strings.TrimPrefix(data, "register_reject_")
+
+	actionKey := "register:" + targetUserID
+	if !h.claimAction(callback, actionKey, "register_reject") {
+		return
+	}
+	recordAudit(h.db, callback.From, models.AuditRegisterReject, targetUserID, "", nil, nil)
+	h.answerCallback(callback.ID, "❌ Rejected")
+
+	h.markRegistrationHandled(callback, fmt.Sprintf("❌ Rejected by: %s", adminName))
+
+	chatID, _ := strconv.ParseInt(targetUserID, 10, 64)
+	text := "❌ ***Registration ငြင်းပယ်ခံရပါပြီ!***\n\n📞 ***အကြောင်းရင်း သိရှိရန် Owner ကို ဆက်သွယ်ပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+// markRegistrationHandled notes the outcome on the admin group request and
+// removes its buttons.
+func (h *CallbackHandler) markRegistrationHandled(callback *tgbotapi.CallbackQuery, outcome string) {
+	text := callback.Message.Text + "\n\n" + outcome
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+	h.bot.Send(edit)
+
+	editReplyMarkup := tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, tgbotapi.InlineKeyboardMarkup{})
+	h.bot.Send(editReplyMarkup)
+}
+
 // Helper methods
-func (h *CallbackHandler) isAdmin(userID string) bool {
-	userIDInt, err := strconv.ParseInt(userID, 10, 64)
+func isAdminActionCallback(data string) bool {
+	for _, prefix := range []string{"order_process_", "order_confirm_", "order_fail_", "order_cancel_", "order_refund_", "topup_approve_", "topup_reject_", "register_approve_", "register_reject_"} {
+		if strings.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPriceSectionCallback(data string) bool {
+	return strings.HasPrefix(data, "price_") && !strings.HasPrefix(data, "price_buy_")
+}
+
+func (h *CallbackHandler) answerCallback(callbackID string, text string) {
+	if err := utils.AnswerCallback(h.bot, callbackID, text); err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
+}
+
+// claimAction makes sure an admin action on an order or topup runs once.
+// A repeated tap is answered with who already handled it.
+func (h *CallbackHandler) claimAction(callback *tgbotapi.CallbackQuery, key string, action string) bool {
+	userID := strconv.FormatInt(callback.From.ID, 10)
+	adminName := utils.GetUserDisplayName(callback.From)
+
+	claimed, existing, err := h.db.ClaimCallback(key, action, userID, adminName)
 	if err != nil {
+		log.Printf("Error claiming callback %s: %v", key, err)
+		h.answerCallback(callback.ID, "❌ Error, ထပ်ကြိုးစားပါ")
 		return false
 	}
-	return userIDInt == h.config.AdminID
+
+	if !claimed {
+		h.answerCallback(callback.ID, fmt.Sprintf("⚠️ Already handled by %s", existing.HandledBy))
+		return false
+	}
+	return true
+}
+
+// claimOrderAction checks that the admin may move the order to the given
+// status and claims that move. It answers the callback itself when not.
+func (h *CallbackHandler) claimOrderAction(callback *tgbotapi.CallbackQuery, orderID string, to models.OrderStatus, action string) (string, bool) {
+	userID := strconv.FormatInt(callback.From.ID, 10)
+	if !h.can(userID, models.PermOrders) {
+		h.answerCallback(callback.ID, "")
+		return "", false
+	}
+
+	order, err := h.getOrderByID(orderID)
+	if err != nil || order == nil {
+		log.Printf("Error getting order %s: %v", orderID, err)
+		h.answerCallback(callback.ID, "")
+		return "", false
+	}
+
+	if !models.CanTransitionOrder(order.Status, to) {
+		h.answerCallback(callback.ID, fmt.Sprintf("⚠️ Order is already %s", order.Status))
+		return "", false
+	}
+
+	// Each move is claimed on its own, so an order can go through
+	// processing, completion and refund one tap at a time
+	actionKey := fmt.Sprintf("order:%s:%s", orderID, to)
+	if !h.claimAction(callback, actionKey, action) {
+		return "", false
+	}
+	return actionKey, true
+}
+
+// releaseAction frees a claim whose action failed so it can be retried.
+func (h *CallbackHandler) releaseAction(callback *tgbotapi.CallbackQuery, key string) {
+	if err := h.db.ReleaseCallback(key); err != nil {
+		log.Printf("Error releasing callback %s: %v", key, err)
+	}
+	h.answerCallback(callback.ID, "❌ Error, ထပ်ကြိုးစားပါ")
+}
+
+func (h *CallbackHandler) can(userID string, perm models.Permission) bool {
+	return utils.HasPermission(h.db, h.config.AdminID, userID, perm)
 }
 
 func (h *CallbackHandler) getOrderByID(orderID string) (*models.Order, error) {
-	// This would require implementing a method to find order by ID
-	// For now, return a mock implementation
-	return &models.Order{}, nil
+	return h.db.GetOrder(orderID)
+}
+
+// updateOrderMessage rewrites the status line of the admin group order
+// message and swaps its buttons for the moves the new status allows.
+func (h *CallbackHandler) updateOrderMessage(callback *tgbotapi.CallbackQuery, order *models.Order, status string) {
+	text := replaceStatusLine(callback.Message.Text, status)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text,
+		utils.CreateOrderActionKeyboard(order.OrderID, order.Status))
+	edit.ParseMode = "Markdown"
+	h.bot.Send(edit)
+}
+
+// replaceStatusLine replaces whatever follows the last "Status:" label up to
+// the end of its line.
+func replaceStatusLine(text string, status string) string {
+	start := strings.LastIndex(text, "Status:")
+	if start < 0 {
+		return text
+	}
+	start += len("Status:")
+	start += len(text[start:]) - len(strings.TrimLeft(text[start:], "* "))
+
+	end := strings.Index(text[start:], "\n")
+	if end < 0 {
+		return text[:start] + status
+	}
+	return text[:start] + status + text[start+end:]
 }
 
 func (h *CallbackHandler) notifyAdminsAboutOrderConfirmation(orderID string, adminName string, targetUserID string) {
@@ -352,19 +762,120 @@ func (h *CallbackHandler) notifyAdminsAboutOrderConfirmation(orderID string, adm
 	utils.SendMessage(h.bot, h.config.AdminGroupID, text, "Markdown")
 }
 
-func (h *CallbackHandler) notifyUserAboutOrderConfirmation(userID string, orderID string) {
+func (h *CallbackHandler) notifyUserAboutOrderConfirmation(order *models.Order) {
+	chatID, _ := strconv.ParseInt(order.UserID, 10, 64)
+
+	delivered := "Order"
+	if game := models.FindGame(order.GameCode()); game != nil {
+		delivered = game.Name + " " + game.Unit
+	}
+
+	text := fmt.Sprintf("✅ ***Order လက်ခံပြီးပါပြီ!***\n\n📝 ***Order ID:*** `%s`\n🎮 ***Account:*** `%s`\n📦 ***Amount:*** `%s`\n📊 Status: ✅ ***လက်ခံပြီး***\n\n🎁 ***%s များကို ထည့်သွင်းပေးလိုက်ပါပြီ။***",
+		order.OrderID, order.AccountText(), order.Amount, delivered)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyAdminsAboutOrderCancellation(orderID string, adminName string, refundAmount int) {
+	text := fmt.Sprintf("❌ ***Order Cancelled!***\n📝 ***Order ID:*** `%s`\n👤 ***Cancelled by:*** %s\n💰 ***ငွေပြန်အမ်း:*** `%d MMK`",
+		orderID, adminName, refundAmount)
+	utils.SendMessage(h.bot, h.config.AdminGroupID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyUserAboutOrderCancellation(userID string, orderID string, refundAmount int) {
+	chatID, _ := strconv.ParseInt(userID, 10, 64)
+
+	balanceText := ""
+	if userDoc, err := h.db.GetUser(userID); err == nil && userDoc != nil {
+		balanceText = fmt.Sprintf("\n💳 ***လက်ကျန်:*** `%d MMK`", userDoc.Balance)
+	}
+
+	text := fmt.Sprintf("❌ ***Order ငြင်းပယ်ခံရပါပြီ!***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"💰 ***ငွေပြန်အမ်း:*** `%d MMK`%s\n\n"+
+		"📞 ***အကြောင်းရင်း သိရှိရန် Admin ကို ဆက်သွယ်ပါ။***",
+		orderID, refundAmount, balanceText)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyUserAboutOrderProcessing(order *models.Order) {
+	chatID, _ := strconv.ParseInt(order.UserID, 10, 64)
+
+	text := fmt.Sprintf("🔄 ***Order ကို လုပ်ဆောင်နေပါပြီ!***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"🎮 ***Account:*** `%s`\n"+
+		"📦 ***Amount:*** `%s`\n"+
+		"📊 Status: 🔄 ***လုပ်ဆောင်နေသည်***",
+		order.OrderID, order.AccountText(), order.Amount)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyUserAboutOrderFailure(order *models.Order) {
+	chatID, _ := strconv.ParseInt(order.UserID, 10, 64)
+
+	text := fmt.Sprintf("⚠️ ***Order မအောင်မြင်ပါ!***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"🎮 ***Account:*** `%s`\n"+
+		"📦 ***Amount:*** `%s`\n\n"+
+		"💰 ***ငွေပြန်အမ်းခြင်းကို Admin က ဆောင်ရွက်ပေးပါမယ်။***",
+		order.OrderID, order.AccountText(), order.Amount)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyAdminsAboutOrderRefund(orderID string, adminName string, refundAmount int) {
+	text := fmt.Sprintf("↩️ ***Order Refunded!***\n📝 ***Order ID:*** `%s`\n👤 ***Refunded by:*** %s\n💰 ***ငွေပြန်အမ်း:*** `%d MMK`",
+		orderID, adminName, refundAmount)
+	utils.SendMessage(h.bot, h.config.AdminGroupID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyUserAboutOrderRefund(userID string, orderID string, refundAmount int) {
+	chatID, _ := strconv.ParseInt(userID, 10, 64)
+
+	balanceText := ""
+	if userDoc, err := h.db.GetUser(userID); err == nil && userDoc != nil {
+		balanceText = fmt.Sprintf("\n💳 ***လက်ကျန်:*** `%d MMK`", userDoc.Balance)
+	}
+
+	text := fmt.Sprintf("↩️ ***Order ငွေပြန်အမ်းပြီးပါပြီ!***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"💰 ***ငွေပြန်အမ်း:*** `%d MMK`%s",
+		orderID, refundAmount, balanceText)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyUserAboutTopupApproval(userID string, topupID string, adminName string) {
+	chatID, _ := strconv.ParseInt(userID, 10, 64)
+
+	topup, err := h.db.GetTopup(topupID)
+	if err != nil || topup == nil {
+		log.Printf("Error getting topup %s: %v", topupID, err)
+		return
+	}
+
+	balanceText := ""
+	if userDoc, err := h.db.GetUser(userID); err == nil && userDoc != nil {
+		balanceText = fmt.Sprintf("\n💳 ***လက်ကျန်ငွေ:*** `%d MMK`", userDoc.Balance)
+	}
+
+	text := fmt.Sprintf("✅ ***ငွေဖြည့်မှု အတည်ပြုပါပြီ!*** 🎉\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"💰 ***ပမာဏ:*** `%d MMK`%s\n"+
+		"👤 ***Approved by:*** %s\n\n"+
+		"🔓 ***Bot လုပ်ဆောင်ချက်များ ပြန်လည် အသုံးပြုနိုင်ပါပြီ!***",
+		topupID, topup.Amount, balanceText, adminName)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *CallbackHandler) notifyUserAboutTopupRejection(userID string, topupID string, adminName string) {
 	chatID, _ := strconv.ParseInt(userID, 10, 64)
-	text := fmt.Sprintf("✅ ***Order လက်ခံပြီးပါပြီ!***\n\n📝 ***Order ID:*** `%s`\n📊 Status: ✅ ***လက်ခံပြီး***\n\n💎 ***Diamonds များကို ထည့်သွင်းပေးလိုက်ပါပြီ။***",
-		orderID)
+	text := fmt.Sprintf("❌ ***ငွေဖြည့်မှု ငြင်းပယ်ခံရပါပြီ!***\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"👤 ***Rejected by:*** %s\n\n"+
+		"📞 ***အကြောင်းရင်း သိရှိရန် Admin ကို ဆက်သွယ်ပါ။***\n"+
+		"💡 ***ပြန်ဖြည့်ချင်ရင်*** /topup ***နှိပ်ပါ။***",
+		topupID, adminName)
 	utils.SendMessage(h.bot, chatID, text, "Markdown")
 }
 
 func (h *CallbackHandler) processAffiliateCommission(userID string, topupID string) {
-	// Implement affiliate commission logic here
-	// This would involve:
-	// 1. Getting the topup amount
-	// 2. Finding the referrer
-	// 3. Calculating commission
-	// 4. Updating balances
-	// 5. Sending notifications
+	creditAffiliateCommission(h.bot, h.db, h.config.AdminGroupID, topupID)
 }
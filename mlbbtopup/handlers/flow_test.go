@@ -0,0 +1,900 @@
+package handlers_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mlbbtopup/database"
+	"mlbbtopup/handlers"
+	"mlbbtopup/models"
+	"mlbbtopup/telegramtest"
+)
+
+const adminGroupID = -1001
+
+var (
+	owner    = tgbotapi.User{ID: 1, FirstName: "Owner"}
+	customer = tgbotapi.User{ID: 42, FirstName: "Aung", UserName: "aung"}
+	friend   = tgbotapi.User{ID: 43, FirstName: "Hla"}
+)
+
+// testBot runs the real handlers against a telegramtest.Server and an
+// in-memory store. Updates are fetched with getUpdates and routed one at a
+// time, so every step has finished when deliver returns.
+type testBot struct {
+	t      *testing.T
+	srv    *telegramtest.Server
+	bot    *tgbotapi.BotAPI
+	db     *database.MemoryStore
+	router *handlers.Router
+	offset int
+}
+
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+
+	srv := telegramtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	bot, err := srv.NewBot("test-token")
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+
+	db := database.NewMemoryStore()
+	config := &models.Config{
+		AdminID:      owner.ID,
+		AdminGroupID: adminGroupID,
+		BotUsername:  bot.Self.UserName,
+	}
+	return &testBot{t: t, srv: srv, bot: bot, db: db, router: handlers.NewRouter(bot, db, config)}
+}
+
+// deliver hands every queued update to the router.
+func (b *testBot) deliver() {
+	b.t.Helper()
+
+	updates, err := b.bot.GetUpdates(tgbotapi.UpdateConfig{Offset: b.offset})
+	if err != nil {
+		b.t.Fatalf("GetUpdates: %v", err)
+	}
+	for _, update := range updates {
+		b.offset = update.UpdateID + 1
+		b.router.HandleUpdate(update)
+	}
+}
+
+func (b *testBot) command(from tgbotapi.User, text string) {
+	b.t.Helper()
+	b.srv.PushCommand(from, text)
+	b.deliver()
+}
+
+func (b *testBot) photo(from tgbotapi.User, fileID, caption string) {
+	b.t.Helper()
+	b.srv.PushPhoto(from, fileID, caption)
+	b.deliver()
+}
+
+func (b *testBot) press(from tgbotapi.User, message telegramtest.Call, data string) {
+	b.t.Helper()
+	messageID, _ := strconv.Atoi(message.Params["message_id"])
+	b.srv.PushCallback(from, message.ChatID(), messageID, data)
+	b.deliver()
+}
+
+// authorize lets the user in and gives them a balance.
+func (b *testBot) authorize(user tgbotapi.User, balance int) {
+	b.t.Helper()
+
+	userID := strconv.FormatInt(user.ID, 10)
+	if err := b.db.AddAuthorizedUser(userID); err != nil {
+		b.t.Fatalf("AddAuthorizedUser: %v", err)
+	}
+	b.command(user, "/start")
+	if balance > 0 {
+		if _, err := b.db.UpdateBalance(userID, balance, models.LedgerReasonAdjustment, "test"); err != nil {
+			b.t.Fatalf("UpdateBalance: %v", err)
+		}
+	}
+}
+
+func (b *testBot) user(user tgbotapi.User) *models.User {
+	b.t.Helper()
+
+	doc, err := b.db.GetUser(strconv.FormatInt(user.ID, 10))
+	if err != nil || doc == nil {
+		b.t.Fatalf("GetUser(%d) = %v, %v", user.ID, doc, err)
+	}
+	return doc
+}
+
+// lastTo returns the newest call of method to chatID, with message_id set to
+// the ID the server gave the sent message.
+func (b *testBot) lastTo(method string, chatID int64) telegramtest.Call {
+	b.t.Helper()
+
+	messageID := 0
+	var found *telegramtest.Call
+	for _, call := range b.srv.Calls() {
+		if strings.HasPrefix(call.Method, "send") || strings.HasPrefix(call.Method, "edit") {
+			messageID++
+		}
+		if call.Method == method && call.ChatID() == chatID {
+			call := call
+			if call.Params["message_id"] == "" {
+				call.Params["message_id"] = strconv.Itoa(messageID)
+			}
+			found = &call
+		}
+	}
+	if found == nil {
+		b.t.Fatalf("no %s to chat %d", method, chatID)
+	}
+	return *found
+}
+
+func (b *testBot) answers() []string {
+	var texts []string
+	for _, call := range b.srv.CallsTo("answerCallbackQuery") {
+		texts = append(texts, call.Params["text"])
+	}
+	return texts
+}
+
+func assertContains(t *testing.T, call telegramtest.Call, param string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(call.Params[param], w) {
+			t.Errorf("%s %s = %q, want it to contain %q", call.Method, param, call.Params[param], w)
+		}
+	}
+}
+
+func TestMLBBOrderFlow(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 10000)
+
+	b.command(customer, "/mmb 987654321 1234 86")
+
+	price := 5100
+	if got := b.user(customer).Balance; got != 10000-price {
+		t.Fatalf("balance after order = %d, want %d", got, 10000-price)
+	}
+	order, err := b.db.GetOrder("ORD00001")
+	if err != nil || order == nil {
+		t.Fatalf("GetOrder = %v, %v", order, err)
+	}
+	if order.Game != models.GameMLBB || order.GameID != "987654321" || order.ServerID != "1234" ||
+		order.Amount != "86" || order.Price != price || order.Status != models.OrderPending {
+		t.Errorf("order = %+v", order)
+	}
+
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "ORD00001", "4900 MMK", "MLBB Diamonds", "987654321 (1234)")
+	adminMessage := b.lastTo("sendMessage", adminGroupID)
+	assertContains(t, adminMessage, "text", "ORD00001", "987654321")
+	assertContains(t, adminMessage, "reply_markup", "order_process_ORD00001", "order_cancel_ORD00001")
+
+	// A pending order has to be processed before it can be confirmed
+	b.press(owner, adminMessage, "order_confirm_ORD00001")
+	if order, _ = b.db.GetOrder("ORD00001"); order.Status != models.OrderPending {
+		t.Errorf("order status after confirming a pending order = %s, want pending", order.Status)
+	}
+
+	b.press(owner, adminMessage, "order_process_ORD00001")
+	if order, _ = b.db.GetOrder("ORD00001"); order.Status != models.OrderProcessing {
+		t.Errorf("order status = %s, want processing", order.Status)
+	}
+	assertContains(t, b.lastTo("editMessageText", adminGroupID), "reply_markup", "order_confirm_ORD00001", "order_fail_ORD00001")
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "ORD00001", "လုပ်ဆောင်နေ")
+
+	b.press(owner, adminMessage, "order_confirm_ORD00001")
+
+	if order, _ = b.db.GetOrder("ORD00001"); order.Status != models.OrderCompleted {
+		t.Errorf("order status = %s, want completed", order.Status)
+	}
+	if answers := b.answers(); len(answers) != 3 || answers[2] != "✅ Confirmed" {
+		t.Errorf("callback answers = %q", answers)
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "ORD00001", "လက်ခံပြီး", "MLBB Diamonds")
+
+	// A second tap is answered with who handled it and changes nothing
+	b.press(owner, adminMessage, "order_cancel_ORD00001")
+	if got := b.user(customer).Balance; got != 10000-price {
+		t.Errorf("balance after late cancel = %d, want %d", got, 10000-price)
+	}
+}
+
+func TestOrderFailAndRefund(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 10000)
+
+	b.command(customer, "/mmb 987654321 1234 86")
+	adminMessage := b.lastTo("sendMessage", adminGroupID)
+	b.press(owner, adminMessage, "order_process_ORD00001")
+	b.press(owner, adminMessage, "order_fail_ORD00001")
+
+	if order, _ := b.db.GetOrder("ORD00001"); order.Status != models.OrderFailed {
+		t.Fatalf("order status = %s, want failed", order.Status)
+	}
+	if got := b.user(customer).Balance; got != 4900 {
+		t.Errorf("balance after a failed order = %d, want 4900 until it is refunded", got)
+	}
+	assertContains(t, b.lastTo("editMessageText", adminGroupID), "reply_markup", "order_refund_ORD00001")
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "ORD00001", "မအောင်မြင်ပါ")
+
+	b.press(owner, adminMessage, "order_refund_ORD00001")
+
+	order, _ := b.db.GetOrder("ORD00001")
+	if order.Status != models.OrderRefunded || len(order.History) != 3 {
+		t.Errorf("order after refund = %+v, want refunded with 3 transitions", order)
+	}
+	if got := b.user(customer).Balance; got != 10000 {
+		t.Errorf("balance after refund = %d, want 10000", got)
+	}
+	entries, err := b.db.GetLedger("42", 1)
+	if err != nil || len(entries) != 1 || entries[0].Reason != models.LedgerReasonOrderRefund ||
+		entries[0].ReferenceID != "ORD00001" || entries[0].Change != 5100 {
+		t.Errorf("latest ledger entry = %+v, %v; want the 5100 MMK refund of ORD00001", entries, err)
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "ORD00001", "5100 MMK", "10000 MMK")
+
+	// A second refund tap changes nothing
+	b.press(owner, adminMessage, "order_refund_ORD00001")
+	if got := b.user(customer).Balance; got != 10000 {
+		t.Errorf("balance after a second refund tap = %d, want 10000", got)
+	}
+
+	audit, _ := b.db.GetAuditLog(models.AuditFilter{Action: models.AuditOrderRefund})
+	if len(audit) != 1 || audit[0].TargetID != "ORD00001" {
+		t.Errorf("refund audit entries = %+v", audit)
+	}
+}
+
+func TestPUBGOrderConfirmation(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 20000)
+
+	b.command(customer, "/pubg 5123456789 660")
+
+	order, err := b.db.GetOrder("ORD00001")
+	if err != nil || order == nil {
+		t.Fatalf("GetOrder = %v, %v", order, err)
+	}
+	if order.Game != models.GamePUBG || order.Amount != "660uc" || order.Price != 15000 {
+		t.Errorf("order = %+v", order)
+	}
+
+	adminMessage := b.lastTo("sendMessage", adminGroupID)
+	b.press(owner, adminMessage, "order_process_ORD00001")
+	b.press(owner, adminMessage, "order_confirm_ORD00001")
+
+	confirmation := b.lastTo("sendMessage", customer.ID)
+	assertContains(t, confirmation, "text", "ORD00001", "5123456789", "PUBG UC")
+	if strings.Contains(confirmation.Params["text"], "Diamonds") {
+		t.Errorf("PUBG confirmation mentions Diamonds: %q", confirmation.Params["text"])
+	}
+}
+
+func TestPriceButtonOrderKeepsStateUntilPlaced(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 10000)
+
+	b.command(customer, "/price")
+	priceList := b.lastTo("sendMessage", customer.ID)
+	assertContains(t, priceList, "reply_markup", "price_pubg", "price_buy_mlbb_86")
+
+	b.press(customer, priceList, "price_buy_mlbb_86")
+
+	// A mistyped account is refused and the item is still waiting
+	b.srv.PushMessage(customer, "12 1234")
+	b.deliver()
+	if state, _ := b.db.GetUserState("42"); state == nil || state.State != models.StateAwaitingOrderAccount {
+		t.Fatalf("state after a bad account = %+v, want it kept", state)
+	}
+
+	b.srv.PushMessage(customer, "987654321 1234")
+	b.deliver()
+
+	order, err := b.db.GetOrder("ORD00001")
+	if err != nil || order == nil || order.Amount != "86" || order.GameID != "987654321" {
+		t.Fatalf("GetOrder = %+v, %v", order, err)
+	}
+	if state, _ := b.db.GetUserState("42"); state != nil {
+		t.Errorf("state after the order = %+v, want it cleared", state)
+	}
+}
+
+func TestPriceSectionAnswersEveryTap(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+
+	b.command(customer, "/price")
+	priceList := b.lastTo("sendMessage", customer.ID)
+
+	b.press(customer, priceList, "price_pubg")
+	if answers := b.answers(); len(answers) != 1 || answers[0] != "" {
+		t.Errorf("section switch answered %q, want one empty answer", answers)
+	}
+	assertContains(t, b.lastTo("editMessageText", customer.ID), "text", "PUBG")
+
+	// Someone who is not authorized gets told so and the list stays as it is
+	b.srv.Reset()
+	b.press(friend, priceList, "price_wp")
+	if answers := b.answers(); len(answers) != 1 || !strings.Contains(answers[0], "🚫") {
+		t.Errorf("unauthorized section switch answered %q", answers)
+	}
+	if edits := b.srv.CallsTo("editMessageText"); len(edits) != 0 {
+		t.Errorf("unauthorized section switch edited the list: %+v", edits)
+	}
+}
+
+func TestUnknownItemPointsToPrice(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 20000)
+
+	b.command(customer, "/pubg 5123456789 999")
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "PUBG", "999uc", "/price")
+
+	// An item taken off sale is refused the same way
+	product, err := b.db.GetProduct(models.GameMLBB, "86")
+	if err != nil || product == nil {
+		t.Fatalf("GetProduct = %v, %v", product, err)
+	}
+	product.Active = false
+	if err := b.db.SaveProducts([]models.Product{*product}); err != nil {
+		t.Fatalf("SaveProducts: %v", err)
+	}
+	b.command(customer, "/mmb 987654321 1234 86")
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "MLBB", "`86`", "/price")
+
+	if orders, _ := b.db.GetUserOrders("42", 0); len(orders) != 0 {
+		t.Errorf("stored %d orders for items not on sale", len(orders))
+	}
+	if got := b.user(customer).Balance; got != 20000 {
+		t.Errorf("balance = %d, want 20000", got)
+	}
+}
+
+func TestMLBBOrderInsufficientBalance(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 1000)
+
+	b.command(customer, "/mmb 987654321 1234 86")
+
+	if orders, _ := b.db.GetUserOrders("42", 0); len(orders) != 0 {
+		t.Errorf("stored %d orders without the balance for them", len(orders))
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "5100 MMK", "1000 MMK")
+	for _, call := range b.srv.CallsTo("sendMessage") {
+		if call.ChatID() == adminGroupID {
+			t.Errorf("admin group was sent %q", call.Params["text"])
+		}
+	}
+}
+
+func TestRegistrationFlow(t *testing.T) {
+	b := newTestBot(t)
+
+	b.command(friend, "/start")
+
+	request := b.lastTo("sendMessage", adminGroupID)
+	assertContains(t, request, "reply_markup", "register_approve_43")
+	assertContains(t, b.lastTo("sendMessage", friend.ID), "text", "43")
+
+	b.press(owner, request, "register_approve_43")
+
+	authorized, err := b.db.LoadAuthorizedUsers()
+	if err != nil || !authorized["43"] {
+		t.Fatalf("user not authorized after approval: %v, %v", authorized, err)
+	}
+	b.command(friend, "/start")
+	b.command(friend, "/balance")
+	assertContains(t, b.lastTo("sendMessage", friend.ID), "text", "0 MMK")
+
+	entries, err := b.db.GetAuditLog(models.AuditFilter{UserID: "43"})
+	if err != nil || len(entries) != 1 || entries[0].Action != models.AuditRegisterApprove {
+		t.Errorf("audit entries = %+v, %v; want one register_approve", entries, err)
+	}
+}
+
+func TestTopupScreenshotApproveFlow(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+
+	b.command(customer, "/topup 5000")
+	methods := b.lastTo("sendMessage", customer.ID)
+	assertContains(t, methods, "reply_markup", "topup_pay_kpay_5000", "topup_pay_wave_5000")
+
+	b.press(customer, methods, "topup_pay_kpay_5000")
+	assertContains(t, b.lastTo("editMessageText", customer.ID), "text", "5000")
+
+	b.photo(customer, "screenshot-1", "U Aung")
+
+	topup, err := b.db.GetTopup("TOP00001")
+	if err != nil || topup == nil {
+		t.Fatalf("GetTopup = %v, %v", topup, err)
+	}
+	if topup.Status != "pending" || topup.Amount != 5000 || topup.PaymentMethod != "kpay" || topup.PayerName != "U Aung" {
+		t.Errorf("topup = %+v", topup)
+	}
+	adminPhoto := b.lastTo("sendPhoto", adminGroupID)
+	assertContains(t, adminPhoto, "caption", "TOP00001", "5000 MMK", "U Aung")
+	assertContains(t, adminPhoto, "reply_markup", "topup_approve_TOP00001")
+	if adminPhoto.Params["photo"] != "screenshot-1" {
+		t.Errorf("admin group got photo %q, want the screenshot", adminPhoto.Params["photo"])
+	}
+
+	// Orders wait until the screenshot is checked
+	b.command(customer, "/mmb 987654321 1234 11")
+	if orders, _ := b.db.GetUserOrders("42", 0); len(orders) != 0 {
+		t.Errorf("order placed while the topup waits for approval")
+	}
+
+	b.press(owner, adminPhoto, "topup_approve_TOP00001")
+
+	if got := b.user(customer).Balance; got != 5000 {
+		t.Errorf("balance after approval = %d, want 5000", got)
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "TOP00001", "5000 MMK")
+
+	// Approving again neither credits twice nor errors
+	b.press(owner, adminPhoto, "topup_approve_TOP00001")
+	if got := b.user(customer).Balance; got != 5000 {
+		t.Errorf("balance after second tap = %d, want 5000", got)
+	}
+	answers := b.answers()
+	if last := answers[len(answers)-1]; !strings.Contains(last, "Already handled by Owner") {
+		t.Errorf("second tap answered %q", last)
+	}
+}
+
+func TestCancelPendingOrderRefunds(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 10000)
+
+	b.command(customer, "/mmb 987654321 1234 86")
+	adminMessage := b.lastTo("sendMessage", adminGroupID)
+
+	// Other users cannot see or withdraw the order
+	b.authorize(friend, 0)
+	b.command(friend, "/cancel ORD00001")
+	assertContains(t, b.lastTo("sendMessage", friend.ID), "text", "ORD00001")
+	if order, _ := b.db.GetOrder("ORD00001"); order.Status != models.OrderPending {
+		t.Fatalf("order status after a stranger's /cancel = %s, want pending", order.Status)
+	}
+
+	b.command(customer, "/cancel ord00001")
+
+	order, err := b.db.GetOrder("ORD00001")
+	if err != nil || order == nil || order.Status != models.OrderCancelled {
+		t.Fatalf("order after /cancel = %+v, %v; want cancelled", order, err)
+	}
+	if got := b.user(customer).Balance; got != 10000 {
+		t.Errorf("balance after /cancel = %d, want 10000", got)
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "ORD00001", "5100 MMK")
+	assertContains(t, b.lastTo("editMessageText", adminGroupID), "text", "ORD00001")
+
+	// The admin buttons no longer act on the withdrawn order
+	b.press(owner, adminMessage, "order_confirm_ORD00001")
+	if order, _ := b.db.GetOrder("ORD00001"); order.Status != models.OrderCancelled {
+		t.Errorf("order status after a late confirm = %s, want cancelled", order.Status)
+	}
+	if got := b.user(customer).Balance; got != 10000 {
+		t.Errorf("balance after a late confirm = %d, want 10000", got)
+	}
+}
+
+func TestCancelTopup(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+
+	// A topup that is not paid yet is just forgotten
+	b.command(customer, "/topup 5000")
+	b.command(customer, "/cancel")
+	if state, _ := b.db.GetUserState("42"); state != nil {
+		t.Errorf("topup state kept after /cancel: %+v", state)
+	}
+
+	// A topup waiting for an admin is withdrawn
+	b.command(customer, "/topup 5000")
+	b.press(customer, b.lastTo("sendMessage", customer.ID), "topup_pay_kpay_5000")
+	b.photo(customer, "screenshot-1", "")
+	adminPhoto := b.lastTo("sendPhoto", adminGroupID)
+
+	b.command(customer, "/cancel")
+
+	if topup, _ := b.db.GetTopup("TOP00001"); topup == nil || topup.Status != "cancelled" {
+		t.Fatalf("topup after /cancel = %+v, want cancelled", topup)
+	}
+	if state, _ := b.db.GetUserState("42"); state != nil {
+		t.Errorf("topup state kept after /cancel: %+v", state)
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "TOP00001", "5000 MMK")
+
+	b.press(owner, adminPhoto, "topup_approve_TOP00001")
+	if got := b.user(customer).Balance; got != 0 {
+		t.Errorf("balance after approving a withdrawn topup = %d, want 0", got)
+	}
+
+	b.command(customer, "/cancel")
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "/cancel ORDxxxx")
+}
+
+func TestSetPaymentAddsMethod(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+
+	b.command(customer, "/setpayment aya add AYA Pay")
+	if methods, _ := b.db.LoadPaymentMethods(); models.FindPaymentMethod(methods, "aya") != nil {
+		t.Fatalf("non-admin added a payment method")
+	}
+
+	b.command(owner, "/setpayment aya add AYA Pay")
+	b.command(owner, "/setpayment aya number 09777000111")
+	b.command(owner, "/setpayment aya max 100000")
+
+	// New methods stay hidden until switched on
+	b.command(customer, "/topup 5000")
+	if markup := b.lastTo("sendMessage", customer.ID).Params["reply_markup"]; strings.Contains(markup, "topup_pay_aya_5000") {
+		t.Errorf("disabled method offered: %s", markup)
+	}
+
+	b.command(owner, "/setpayment aya on")
+	assertContains(t, b.lastTo("sendMessage", owner.ID), "text", "AYA Pay", "09777000111")
+
+	b.command(customer, "/cancel")
+	b.command(customer, "/topup 5000")
+	methods := b.lastTo("sendMessage", customer.ID)
+	assertContains(t, methods, "reply_markup", "topup_pay_aya_5000", "topup_pay_kpay_5000")
+
+	b.press(customer, methods, "topup_pay_aya_5000")
+	assertContains(t, b.lastTo("editMessageText", customer.ID), "text", "AYA Pay", "09777000111")
+
+	b.command(customer, "/cancel")
+	b.command(customer, "/topup 200000")
+	if markup := b.lastTo("sendMessage", customer.ID).Params["reply_markup"]; strings.Contains(markup, "topup_pay_aya") {
+		t.Errorf("method offered above its maximum: %s", markup)
+	}
+}
+
+func TestReferralCommissionFlow(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+	if err := b.db.AddAuthorizedUser("43"); err != nil {
+		t.Fatalf("AddAuthorizedUser: %v", err)
+	}
+
+	b.command(friend, "/start 42")
+
+	if got := b.user(friend).ReferredBy; got != "42" {
+		t.Fatalf("friend referred by %q, want 42", got)
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "43")
+
+	b.command(friend, "/topup 10000")
+	b.press(friend, b.lastTo("sendMessage", friend.ID), "topup_pay_wave_10000")
+	b.photo(friend, "screenshot-2", "Daw Hla")
+	b.press(owner, b.lastTo("sendPhoto", adminGroupID), "topup_approve_TOP00001")
+
+	// The default affiliate settings pay 3%
+	referrer := b.user(customer)
+	if referrer.Balance != 300 || referrer.ReferralEarnings != 300 {
+		t.Errorf("referrer balance %d, earnings %d; want 300 each", referrer.Balance, referrer.ReferralEarnings)
+	}
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "Commission", "300 MMK")
+
+	// A later /start link does not change the referrer
+	b.command(friend, "/start 1")
+	if got := b.user(friend).ReferredBy; got != "42" {
+		t.Errorf("friend referred by %q after a second link, want 42", got)
+	}
+
+	b.command(customer, "/affiliate")
+	assertContains(t, b.lastTo("sendMessage", customer.ID), "text", "300 MMK")
+}
+
+func TestSamePayerReferralsFlagged(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+
+	flags := func() []telegramtest.Call {
+		var calls []telegramtest.Call
+		for _, call := range b.srv.CallsTo("sendMessage") {
+			if call.ChatID() == adminGroupID && strings.Contains(call.Params["text"], "🚩") {
+				calls = append(calls, call)
+			}
+		}
+		return calls
+	}
+
+	captions := []string{"U Mg Mg", "u mg  mg", " U MG MG"}
+	for i, caption := range captions {
+		referee := tgbotapi.User{ID: int64(50 + i), FirstName: "Referee"}
+		if err := b.db.AddAuthorizedUser(strconv.FormatInt(referee.ID, 10)); err != nil {
+			t.Fatalf("AddAuthorizedUser: %v", err)
+		}
+		b.command(referee, "/start 42")
+		b.command(referee, "/topup 10000")
+		b.press(referee, b.lastTo("sendMessage", referee.ID), "topup_pay_wave_10000")
+		b.photo(referee, "screenshot", caption)
+		b.press(owner, b.lastTo("sendPhoto", adminGroupID), fmt.Sprintf("topup_approve_TOP%05d", i+1))
+
+		if got := len(flags()); i < len(captions)-1 && got != 0 {
+			t.Errorf("after referee %d: %d flags, want none", i+1, got)
+		}
+	}
+
+	// Commission is still paid; admins decide whether to reverse it
+	if got := b.user(customer).ReferralEarnings; got != 900 {
+		t.Errorf("referral earnings = %d, want 900", got)
+	}
+	sent := flags()
+	if len(sent) != 1 {
+		t.Fatalf("admin group got %d flags, want 1", len(sent))
+	}
+	assertContains(t, sent[0], "text", "50, 51, 52", "TOP00001, TOP00002, TOP00003")
+}
+
+func TestReferredTopupNeedsPayerName(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+	if err := b.db.AddAuthorizedUser("43"); err != nil {
+		t.Fatalf("AddAuthorizedUser: %v", err)
+	}
+	b.command(friend, "/start 42")
+
+	b.command(friend, "/topup 10000")
+	b.press(friend, b.lastTo("sendMessage", friend.ID), "topup_pay_wave_10000")
+	b.photo(friend, "screenshot", "")
+
+	if topup, _ := b.db.GetTopup("TOP00001"); topup != nil {
+		t.Fatalf("topup without a payer name was accepted: %+v", topup)
+	}
+	assertContains(t, b.lastTo("sendMessage", friend.ID), "text", "caption")
+
+	// The same session takes the screenshot once it names the payer
+	b.photo(friend, "screenshot", "Daw Hla")
+	if topup, _ := b.db.GetTopup("TOP00001"); topup == nil || topup.PayerName != "Daw Hla" {
+		t.Errorf("topup after resending = %+v, want payer Daw Hla", topup)
+	}
+}
+
+func TestReferralTopupWithoutPayerFlagged(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+	if err := b.db.AddAuthorizedUser("43"); err != nil {
+		t.Fatalf("AddAuthorizedUser: %v", err)
+	}
+	b.command(friend, "/start 42")
+
+	// A pending topup from before payer names were required
+	topup := models.Topup{TopupID: "TOP00001", Amount: 10000, Status: "pending", Timestamp: time.Now(), UserID: "43"}
+	if err := b.db.AddTopup(topup); err != nil {
+		t.Fatalf("AddTopup: %v", err)
+	}
+	b.command(owner, "/approve 43 10000")
+
+	if got := b.user(customer).ReferralEarnings; got != 300 {
+		t.Errorf("referral earnings = %d, want 300", got)
+	}
+	assertContains(t, b.lastTo("sendMessage", adminGroupID), "text", "🚩", "TOP00001", "43")
+}
+
+func TestInvalidReferrerIgnored(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 0)
+	for _, userID := range []string{"43", "44"} {
+		if err := b.db.AddAuthorizedUser(userID); err != nil {
+			t.Fatalf("AddAuthorizedUser: %v", err)
+		}
+	}
+
+	// 99 is not a user of the bot
+	b.command(friend, "/start 99")
+	if got := b.user(friend).ReferredBy; got != "" {
+		t.Errorf("friend referred by %q, want nobody", got)
+	}
+
+	third := tgbotapi.User{ID: 44, FirstName: "Su"}
+	b.command(third, "/start 44")
+	if got := b.user(third).ReferredBy; got != "" {
+		t.Errorf("self-referral recorded %q", got)
+	}
+}
+
+func TestAdminRolePermissions(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 10000)
+	b.authorize(friend, 0)
+
+	// Only owners manage admins
+	b.command(friend, "/addadmin 43 owner")
+	if admin, _ := b.db.GetAdmin("43"); admin != nil {
+		t.Fatalf("non-admin made themselves %s", admin.Role)
+	}
+
+	b.command(owner, "/addadmin 43 support")
+	if admin, _ := b.db.GetAdmin("43"); admin == nil || admin.Role != models.RoleSupport {
+		t.Fatalf("admin after /addadmin = %+v, want support", admin)
+	}
+
+	// Support may confirm orders but not approve topups
+	b.command(customer, "/mmb 987654321 1234 86")
+	adminMessage := b.lastTo("sendMessage", adminGroupID)
+	b.press(friend, adminMessage, "order_process_ORD00001")
+	b.press(friend, adminMessage, "order_confirm_ORD00001")
+	if order, _ := b.db.GetOrder("ORD00001"); order.Status != models.OrderCompleted {
+		t.Errorf("order status after support confirm = %s, want completed", order.Status)
+	}
+
+	b.command(customer, "/topup 5000")
+	b.press(customer, b.lastTo("sendMessage", customer.ID), "topup_pay_kpay_5000")
+	b.photo(customer, "screenshot-1", "U Aung")
+	b.press(friend, b.lastTo("sendPhoto", adminGroupID), "topup_approve_TOP00001")
+	if topup, _ := b.db.GetTopup("TOP00001"); topup.Status != "pending" {
+		t.Errorf("topup status after support approve = %s, want pending", topup.Status)
+	}
+
+	b.command(owner, "/removeadmin 43")
+	if admin, _ := b.db.GetAdmin("43"); admin != nil {
+		t.Errorf("admin kept after /removeadmin: %+v", admin)
+	}
+}
+
+func TestAdminActionsAudited(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 10000)
+
+	b.command(customer, "/mmb 987654321 1234 86")
+	b.press(owner, b.lastTo("sendMessage", adminGroupID), "order_cancel_ORD00001")
+	b.command(owner, "/deduct 42 1000")
+
+	entries, err := b.db.GetAuditLog(models.AuditFilter{UserID: "42"})
+	if err != nil {
+		t.Fatalf("GetAuditLog: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("audit entries = %+v, want cancel and deduct", entries)
+	}
+	if entries[0].Action != models.AuditDeduct || entries[1].Action != models.AuditOrderCancel {
+		t.Errorf("actions = %s, %s; want deduct, order_cancel", entries[0].Action, entries[1].Action)
+	}
+	if entries[1].ActorID != "1" || entries[1].TargetID != "ORD00001" {
+		t.Errorf("cancel entry = %+v", entries[1])
+	}
+
+	b.command(owner, "/audit user 42")
+	assertContains(t, b.lastTo("sendMessage", owner.ID), "text", models.AuditDeduct, "ORD00001")
+
+	// Customers cannot read the log
+	b.command(customer, "/audit")
+	if text := b.lastTo("sendMessage", customer.ID).Params["text"]; strings.Contains(text, "ORD00001") {
+		t.Errorf("customer was shown the audit log: %q", text)
+	}
+}
+
+func TestPUBGOrderFlow(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 20000)
+
+	b.command(customer, "/pubg 5123456789 660")
+
+	order, err := b.db.GetOrder("ORD00001")
+	if err != nil || order == nil {
+		t.Fatalf("GetOrder = %v, %v", order, err)
+	}
+	if order.Game != models.GamePUBG || order.GameID != "5123456789" || order.ServerID != "" ||
+		order.Amount != "660uc" || order.Price != 15000 {
+		t.Errorf("order = %+v", order)
+	}
+	if got := b.user(customer).Balance; got != 5000 {
+		t.Errorf("balance after order = %d, want 5000", got)
+	}
+	assertContains(t, b.lastTo("sendMessage", adminGroupID), "text", "ORD00001", "5123456789")
+
+	placed := b.lastTo("sendMessage", customer.ID)
+	assertContains(t, placed, "text", "ORD00001", "PUBG ID", "`5123456789`", "PUBG UC", "660uc")
+	if strings.Contains(placed.Params["text"], "(``)") {
+		t.Errorf("PUBG order confirmation shows an empty server: %q", placed.Params["text"])
+	}
+
+	// PUBG IDs have no server and are longer than MLBB ones
+	b.command(customer, "/pubg 12345 660")
+	if orders, _ := b.db.GetUserOrders("42", 0); len(orders) != 1 {
+		t.Errorf("stored %d orders, want the bad ID refused", len(orders))
+	}
+}
+
+func TestSetPriceUpdatesProducts(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 30000)
+	if err := b.db.SaveProducts(models.DefaultProducts()); err != nil {
+		t.Fatalf("SaveProducts: %v", err)
+	}
+
+	b.command(customer, "/setprice 86 1")
+	if product, _ := b.db.GetProduct(models.GameMLBB, "86"); product.Price != 5100 {
+		t.Fatalf("customer changed the price to %d", product.Price)
+	}
+
+	b.command(owner, "/setprice 86 4500 4200")
+	b.command(owner, "/setprice pubg 660 14000")
+
+	product, err := b.db.GetProduct(models.GameMLBB, "86")
+	if err != nil || product == nil || product.Price != 4500 || product.Cost != 4200 {
+		t.Errorf("86 after /setprice = %+v, %v; want price 4500, cost 4200", product, err)
+	}
+	if product, _ := b.db.GetProduct(models.GamePUBG, "660uc"); product == nil || product.Price != 14000 {
+		t.Errorf("660uc after /setprice = %+v, want price 14000", product)
+	}
+
+	b.command(customer, "/mmb 987654321 1234 86")
+	b.command(customer, "/pubg 5123456789 660")
+	if got := b.user(customer).Balance; got != 30000-4500-14000 {
+		t.Errorf("balance after both orders = %d, want %d", got, 30000-4500-14000)
+	}
+}
+
+func TestPriceListOrderButton(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 10000)
+
+	b.command(customer, "/price")
+	priceList := b.lastTo("sendMessage", customer.ID)
+	assertContains(t, priceList, "text", "86 Diamonds", "5100")
+	assertContains(t, priceList, "reply_markup", "price_pubg", "price_buy_mlbb_86")
+
+	b.press(customer, priceList, "price_pubg")
+	assertContains(t, b.lastTo("editMessageText", customer.ID), "text", "660 UC", "15000")
+
+	b.press(customer, priceList, "price_buy_mlbb_86")
+	if state, _ := b.db.GetUserState("42"); state == nil || state.Order.SKU != "86" {
+		t.Fatalf("state after the buy button = %+v, want 86 waiting for an account", state)
+	}
+
+	b.srv.PushMessage(customer, "987654321 1234")
+	b.deliver()
+
+	order, err := b.db.GetOrder("ORD00001")
+	if err != nil || order == nil || order.Amount != "86" || order.GameID != "987654321" || order.Price != 5100 {
+		t.Fatalf("order from the price list = %+v, %v", order, err)
+	}
+	if state, _ := b.db.GetUserState("42"); state != nil {
+		t.Errorf("state kept after the order: %+v", state)
+	}
+}
+
+func TestHistoryPagesAndFilters(t *testing.T) {
+	b := newTestBot(t)
+	b.authorize(customer, 100000)
+
+	for i := 0; i < 6; i++ {
+		b.command(customer, "/mmb 987654321 1234 11")
+	}
+	b.press(owner, b.lastTo("sendMessage", adminGroupID), "order_cancel_ORD00006")
+
+	b.command(customer, "/history")
+	history := b.lastTo("sendMessage", customer.ID)
+	assertContains(t, history, "text", "ORD00006", "ORD00002")
+	if strings.Contains(history.Params["text"], "ORD00001") {
+		t.Errorf("first page shows the sixth newest order: %q", history.Params["text"])
+	}
+	assertContains(t, history, "reply_markup", "history_all_any_1")
+
+	b.press(customer, history, "history_all_any_1")
+	assertContains(t, b.lastTo("editMessageText", customer.ID), "text", "ORD00001")
+
+	b.press(customer, history, "history_orders_failed_0")
+	failed := b.lastTo("editMessageText", customer.ID)
+	assertContains(t, failed, "text", "ORD00006")
+	if strings.Contains(failed.Params["text"], "ORD00005") {
+		t.Errorf("failed filter shows a pending order: %q", failed.Params["text"])
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mlbbtopup/database"
+	"mlbbtopup/models"
+	"mlbbtopup/utils"
+)
+
+// historyMessage renders one page of /history and its buttons.
+func historyMessage(db database.Store, filter models.HistoryFilter) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	entries, total, err := db.GetUserHistory(filter)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	// The history can shrink under an old message; show its last page instead
+	if len(entries) == 0 && filter.Page > 0 && total > 0 {
+		filter.Page = (total - 1) / models.HistoryPageSize
+		entries, total, err = db.GetUserHistory(filter)
+		if err != nil {
+			return "", tgbotapi.InlineKeyboardMarkup{}, err
+		}
+	}
+
+	methods, err := db.LoadPaymentMethods()
+	if err != nil {
+		log.Printf("Error loading payment methods: %v", err)
+	}
+
+	pages := (total + models.HistoryPageSize - 1) / models.HistoryPageSize
+	if pages == 0 {
+		pages = 1
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📋 ***သင့်ရဲ့ မှတ်တမ်းများ*** (%d/%d)\n\n", filter.Page+1, pages)
+	if len(entries) == 0 {
+		b.WriteString("📭 ***မှတ်တမ်း မရှိသေးပါ။***\n")
+	}
+
+	for _, entry := range entries {
+		if entry.Order != nil {
+			order := entry.Order
+			fmt.Fprintf(&b, "🛒 ***%s*** · `%s`\n"+
+				"💎 ***Item:*** %s %s\n"+
+				"🎮 ***%s ID:*** `%s`\n"+
+				"💰 ***Price:*** `%d MMK`\n"+
+				"📊 ***Status:*** %s\n"+
+				"👤 ***Admin:*** %s\n\n",
+				order.OrderID, order.Timestamp.Format("2006-01-02 15:04"),
+				models.GameName(order.GameCode()), order.Amount,
+				models.GameName(order.GameCode()), order.AccountText(),
+				order.Price,
+				orderStatusText(order.Status),
+				orNone(order.ConfirmedBy))
+			continue
+		}
+
+		topup := entry.Topup
+		fmt.Fprintf(&b, "💳 ***%s*** · `%s`\n"+
+			"💎 ***Item:*** Topup · %s\n"+
+			"🎮 ***Game ID:*** -\n"+
+			"💰 ***Price:*** `%d MMK`\n"+
+			"📊 ***Status:*** %s\n"+
+			"👤 ***Admin:*** %s\n\n",
+			topup.TopupID, topup.Timestamp.Format("2006-01-02 15:04"),
+			models.PaymentMethodName(methods, topup.PaymentMethod),
+			topup.Amount,
+			topupStatusText(topup.Status),
+			orNone(topup.ApprovedBy))
+	}
+
+	return b.String(), utils.CreateHistoryKeyboard(filter, total), nil
+}
+
+func topupStatusText(status string) string {
+	statusText := map[string]string{
+		"pending":   "⏳ စောင့်ဆိုင်းနေသည်",
+		"approved":  "✅ လက်ခံပြီး",
+		"rejected":  "❌ ငြင်းပယ်ပြီး",
+		"cancelled": "🚫 ပယ်ဖျက်ပြီး",
+		"reversed":  "↩️ ပြန်နုတ်ပြီး",
+	}
+
+	if text, ok := statusText[status]; ok {
+		return text
+	}
+	return status
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
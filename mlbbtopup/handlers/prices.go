@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"mlbbtopup/database"
+	"mlbbtopup/models"
+)
+
+// loadPriceSection returns the /price section for key, falling back to the
+// first one, with the active products listed in it.
+func loadPriceSection(db database.ProductStore, key string) (models.PriceSection, []models.Product, error) {
+	section := models.FindPriceSection(key)
+
+	products, err := db.GetProducts(section.Game, true)
+	if err != nil {
+		return section, nil, err
+	}
+
+	listed := make([]models.Product, 0, len(products))
+	for _, product := range products {
+		if section.Includes(product) && product.Price > 0 {
+			listed = append(listed, product)
+		}
+	}
+	return section, listed, nil
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mlbbtopup/database"
+	"mlbbtopup/models"
+	"mlbbtopup/utils"
+)
+
+// Router sends each update to the handler for it. main feeds it from
+// getUpdates; the tests feed it from a telegramtest.Server.
+type Router struct {
+	user     *UserHandler
+	admin    *AdminHandler
+	callback *CallbackHandler
+}
+
+func NewRouter(bot utils.Sender, db database.Store, config *models.Config) *Router {
+	return &Router{
+		user:     NewUserHandler(bot, db, config),
+		admin:    NewAdminHandler(bot, db, config),
+		callback: NewCallbackHandler(bot, db, config),
+	}
+}
+
+func (r *Router) HandleUpdate(update tgbotapi.Update) {
+	if update.Message != nil {
+		r.handleMessage(update.Message)
+	} else if update.CallbackQuery != nil {
+		r.callback.HandleCallback(update.CallbackQuery)
+	}
+}
+
+func (r *Router) handleMessage(message *tgbotapi.Message) {
+	if message.IsCommand() {
+		r.handleCommand(message)
+		return
+	}
+
+	// Handle photos (payment screenshots)
+	if message.Photo != nil && len(message.Photo) > 0 {
+		r.user.HandlePhoto(message)
+		return
+	}
+
+	// Handle other text messages
+	if message.Text != "" {
+		r.user.HandleText(message)
+	}
+}
+
+func (r *Router) handleCommand(message *tgbotapi.Message) {
+	command := message.Command()
+	args := message.CommandArguments()
+
+	switch command {
+	case "start":
+		r.user.HandleStart(message, args)
+	case "order":
+		r.user.HandleOrder(message, args)
+	case "cancel":
+		r.user.HandleCancel(message, args)
+	case "balance":
+		r.user.HandleBalance(message)
+	case "topup":
+		r.user.HandleTopup(message, args)
+	case "price":
+		r.user.HandlePrice(message)
+	case "history":
+		r.user.HandleHistory(message)
+	case "register":
+		r.user.HandleRegister(message)
+	case "affiliate":
+		r.user.HandleAffiliate(message)
+
+	// Admin commands; each handler checks the permission it needs
+	case "approve":
+		r.admin.HandleApprove(message, args)
+	case "deduct":
+		r.admin.HandleDeduct(message, args)
+	case "reversetopup":
+		r.admin.HandleReverseTopup(message, args)
+	case "ban":
+		r.admin.HandleBan(message, args)
+	case "unban":
+		r.admin.HandleUnban(message, args)
+	case "setprice":
+		r.admin.HandleSetPrice(message, args)
+	case "maintenance":
+		r.admin.HandleMaintenance(message, args)
+	case "topreferrers":
+		r.admin.HandleTopReferrers(message, args)
+	case "setpayment":
+		r.admin.HandleSetPayment(message, args)
+	case "addadmin":
+		r.admin.HandleAddAdmin(message, args)
+	case "removeadmin":
+		r.admin.HandleRemoveAdmin(message, args)
+	case "admins":
+		r.admin.HandleAdmins(message)
+	case "audit":
+		r.admin.HandleAudit(message, args)
+	default:
+		// Every game orders through its own command, e.g. /mmb or /pubg
+		if game := models.FindGameByCommand(command); game != nil {
+			r.user.HandleGameOrder(message, *game, args)
+			return
+		}
+		r.user.HandleUnknownCommand(message)
+	}
+}
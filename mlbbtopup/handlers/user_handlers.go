@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"strconv"
@@ -17,12 +16,12 @@ import (
 )
 
 type UserHandler struct {
-	bot      *tgbotapi.BotAPI
-	db       *database.DBManager
+	bot      utils.Sender
+	db       database.Store
 	config   *models.Config
 }
 
-func NewUserHandler(bot *tgbotapi.BotAPI, db *database.DBManager, config *models.Config) *UserHandler {
+func NewUserHandler(bot utils.Sender, db database.Store, config *models.Config) *UserHandler {
 	return &UserHandler{
 		bot:    bot,
 		db:     db,
@@ -51,15 +50,6 @@ func (h *UserHandler) HandleStart(message *tgbotapi.Message, args string) {
 		return
 	}
 
-	// Handle referrer ID if provided
-	var referrerID *string
-	if args != "" {
-		refID := args
-		if refID != userID {
-			referrerID = &refID
-		}
-	}
-
 	// Check for pending topups
 	hasPending, err := utils.HasPendingTopup(h.db, userID)
 	if err != nil {
@@ -78,14 +68,15 @@ func (h *UserHandler) HandleStart(message *tgbotapi.Message, args string) {
 	}
 
 	if userDoc == nil {
-		// New user
+		// New user; a referral link only counts on the first /start
+		referrerID := validateReferrer(h.db, h.config.AdminID, userID, strings.TrimSpace(args))
 		err = h.db.CreateUser(userID, name, username, referrerID)
 		if err != nil {
 			log.Printf("Error creating user: %v", err)
 		}
 
 		// Notify referrer
-		if referrerID != nil {
+		if err == nil && referrerID != nil {
 			h.notifyReferrer(*referrerID, name, userID)
 		}
 	} else {
@@ -103,7 +94,99 @@ func (h *UserHandler) HandleStart(message *tgbotapi.Message, args string) {
 	h.sendWelcomeMessage(message.Chat.ID, userID, name)
 }
 
-func (h *UserHandler) HandleMmb(message *tgbotapi.Message, args string) {
+// HandleGameOrder places an order for any game in models.Games, e.g.
+// /mmb gameid serverid amount or /pubg playerid amount. It reports whether
+// the order was placed.
+func (h *UserHandler) HandleGameOrder(message *tgbotapi.Message, game models.Game, args string) bool {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	if !h.canPlaceOrder(message, userID) {
+		return false
+	}
+
+	// Parse arguments
+	argList := strings.Fields(args)
+	if len(argList) != len(game.IDFields)+1 {
+		h.sendInvalidFormatMessage(message.Chat.ID, game.Usage())
+		return false
+	}
+
+	ids := argList[:len(game.IDFields)]
+	amount := game.NormalizeSKU(argList[len(argList)-1])
+
+	// Validation
+	for i, field := range game.IDFields {
+		if !field.Valid(ids[i]) {
+			h.sendInvalidAccountIDMessage(message.Chat.ID, game, field)
+			return false
+		}
+	}
+
+	order := models.Order{
+		Game:   game.Code,
+		GameID: ids[0],
+		Amount: amount,
+		UserID: userID,
+	}
+	if len(ids) > 1 {
+		order.ServerID = ids[1]
+	}
+
+	if utils.IsBannedAccount(order.GameID) {
+		h.sendBannedAccountMessage(message.Chat.ID, order.GameID)
+		h.notifyAdminsAboutBannedAccount(message.From, order.GameID, order.ServerID, amount)
+		return false
+	}
+
+	product, err := h.db.GetProduct(game.Code, amount)
+	if err != nil {
+		log.Printf("Error loading %s product %s: %v", game.Name, amount, err)
+	}
+	if product == nil || !product.Active || product.Price <= 0 {
+		h.sendInvalidItemMessage(message.Chat.ID, game, amount)
+		return false
+	}
+	order.Price = product.Price
+
+	return h.placeOrder(message, order)
+}
+
+// HandleOrderAccount finishes an order started from a /price item button:
+// the message is the game account the item is for. It reports whether the
+// message was used.
+func (h *UserHandler) HandleOrderAccount(message *tgbotapi.Message) bool {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	state, err := h.db.GetUserState(userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+		return false
+	}
+	if state == nil || state.State != models.StateAwaitingOrderAccount {
+		return false
+	}
+
+	game := models.FindGame(state.Order.Game)
+	if game == nil {
+		h.clearUserState(userID)
+		return false
+	}
+
+	// Keep the state until the order goes through, so a mistyped account or
+	// a short balance can be fixed by sending the account again
+	if h.HandleGameOrder(message, *game, message.Text+" "+state.Order.SKU) {
+		h.clearUserState(userID)
+	}
+	return true
+}
+
+func (h *UserHandler) clearUserState(userID string) {
+	if err := h.db.ClearUserState(userID); err != nil {
+		log.Printf("Error clearing user state: %v", err)
+	}
+}
+
+func (h *UserHandler) HandlePrice(message *tgbotapi.Message) {
 	userID := strconv.FormatInt(message.From.ID, 10)
 
 	// Authorization check
@@ -118,128 +201,151 @@ func (h *UserHandler) HandleMmb(message *tgbotapi.Message, args string) {
 		return
 	}
 
-	// Maintenance check
-	settings, err := h.db.LoadSettings(
-		map[string]interface{}{}, // defaultPayment
-		map[string]interface{}{}, // defaultMaintenance  
-		map[string]interface{}{}, // defaultAffiliate
-		map[string]interface{}{}, // defaultAutoDelete
-	)
+	section, products, err := loadPriceSection(h.db, "")
 	if err != nil {
-		log.Printf("Error loading settings: %v", err)
+		log.Printf("Error loading products: %v", err)
 	}
 
-	if maintenance, ok := settings["maintenance"].(map[string]interface{}); ok {
-		if orders, ok := maintenance["orders"].(bool); ok && !orders {
-			h.sendMaintenanceMessage(message.Chat.ID, "orders")
-			return
-		}
-	}
+	text := utils.PriceListText(section, products)
+	keyboard := utils.CreatePriceListKeyboard(section, products)
+	utils.SendMessageWithKeyboard(h.bot, message.Chat.ID, text, "Markdown", keyboard)
+}
 
-	// User state check (simplified in Go version)
-	// if userStates[userID] == "waiting_approval" {
-	//     h.sendWaitingApprovalMessage(message.Chat.ID)
-	//     return
-	// }
+// HandleHistory shows the newest page of the user's orders and topups.
+func (h *UserHandler) HandleHistory(message *tgbotapi.Message) {
+	userID := strconv.FormatInt(message.From.ID, 10)
 
-	// Pending topup check
-	hasPending, err := utils.HasPendingTopup(h.db, userID)
+	// Authorization check
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
 	if err != nil {
-		log.Printf("Error checking pending topup: %v", err)
-	}
-	if hasPending {
-		h.sendPendingTopupWarning(message.Chat.ID)
+		log.Printf("Error loading authorized users: %v", err)
 		return
 	}
 
-	// Parse arguments
-	argList := strings.Fields(args)
-	if len(argList) != 3 {
-		h.sendInvalidFormatMessage(message.Chat.ID, "/mmb gameid serverid amount")
+	if !authorizedUsers[userID] && userID != strconv.FormatInt(h.config.AdminID, 10) {
+		h.sendNotAuthorizedMessage(message.Chat.ID)
 		return
 	}
 
-	gameID, serverID, amount := argList[0], argList[1], argList[2]
-
-	// Validation
-	if !utils.ValidateGameID(gameID) {
-		h.sendInvalidGameIDMessage(message.Chat.ID)
+	userDoc, err := h.db.GetUser(userID)
+	if err != nil || userDoc == nil {
+		h.sendStartFirstMessage(message.Chat.ID)
 		return
 	}
 
-	if !utils.ValidateServerID(serverID) {
-		h.sendInvalidServerIDMessage(message.Chat.ID)
+	filter := models.HistoryFilter{UserID: userID, Kind: models.HistoryAll, Status: models.HistoryAnyStatus}
+	text, keyboard, err := historyMessage(h.db, filter)
+	if err != nil {
+		log.Printf("Error loading history for %s: %v", userID, err)
 		return
 	}
+	utils.SendMessageWithKeyboard(h.bot, message.Chat.ID, text, "Markdown", keyboard)
+}
 
-	if utils.IsBannedAccount(gameID) {
-		h.sendBannedAccountMessage(message.Chat.ID, gameID)
-		h.notifyAdminsAboutBannedAccount(message.From, gameID, serverID, amount)
-		return
+// canPlaceOrder runs the checks every order command shares and tells the
+// user why they cannot order, if they cannot.
+func (h *UserHandler) canPlaceOrder(message *tgbotapi.Message, userID string) bool {
+	// Authorization check
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return false
+	}
+
+	if !authorizedUsers[userID] && userID != strconv.FormatInt(h.config.AdminID, 10) {
+		h.sendNotAuthorizedMessage(message.Chat.ID)
+		return false
 	}
 
-	// Load custom prices
-	customPrices, err := h.db.LoadPrices()
+	// Maintenance check
+	settings, err := utils.LoadSettings(h.db)
 	if err != nil {
-		log.Printf("Error loading prices: %v", err)
-		customPrices = make(map[string]interface{})
+		log.Printf("Error loading settings: %v", err)
 	}
 
-	price := utils.GetPrice(amount, customPrices)
-	if price == 0 {
-		h.sendInvalidAmountMessage(message.Chat.ID)
-		return
+	if maintenance, ok := settings["maintenance"].(map[string]interface{}); ok {
+		if orders, ok := maintenance["orders"].(bool); ok && !orders {
+			h.sendMaintenanceMessage(message.Chat.ID, "orders")
+			return false
+		}
+	}
+
+	// Waiting approval check
+	waiting, err := utils.IsWaitingApproval(h.db, userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+	}
+	if waiting {
+		h.sendWaitingApprovalMessage(message.Chat.ID)
+		return false
+	}
+
+	// Pending topup check
+	hasPending, err := utils.HasPendingTopup(h.db, userID)
+	if err != nil {
+		log.Printf("Error checking pending topup: %v", err)
 	}
+	if hasPending {
+		h.sendPendingTopupWarning(message.Chat.ID)
+		return false
+	}
+
+	return true
+}
 
+// placeOrder debits the order's price and records it in one step, then
+// sends it to the admin group and confirms it to the user. The game account
+// and price have already been validated by the command. It reports whether
+// the order was placed.
+func (h *UserHandler) placeOrder(message *tgbotapi.Message, order models.Order) bool {
 	// Check balance
-	userDoc, err := h.db.GetUser(userID)
+	userDoc, err := h.db.GetUser(order.UserID)
 	if err != nil {
 		log.Printf("Error getting user: %v", err)
-		return
+		return false
 	}
 
-	if userDoc.Balance < price {
-		h.sendInsufficientBalanceMessage(message.Chat.ID, price, userDoc.Balance)
-		return
+	if userDoc == nil {
+		h.sendStartFirstMessage(message.Chat.ID)
+		return false
 	}
 
-	// Create order
-	orderID := utils.GenerateOrderID()
-	order := models.Order{
-		OrderID:   orderID,
-		GameID:    gameID,
-		ServerID:  serverID,
-		Amount:    amount,
-		Price:     price,
-		Status:    "pending",
-		Timestamp: time.Now(),
-		UserID:    userID,
-		ChatID:    message.Chat.ID,
+	if userDoc.Balance < order.Price {
+		h.sendInsufficientBalanceMessage(message.Chat.ID, order.Price, userDoc.Balance)
+		return false
 	}
 
-	// Convert order to BSON for storage
-	orderBSON := utils.ConvertOrderToBSON(order)
-
-	// Update balance and add order
-	err = h.db.UpdateBalance(userID, -price)
+	// Create order
+	seq, err := h.db.NextSequence("orders")
 	if err != nil {
-		log.Printf("Error updating balance: %v", err)
-		return
+		log.Printf("Error generating order ID: %v", err)
+		return false
 	}
 
-	err = h.db.AddOrder(userID, orderBSON)
+	order.OrderID = utils.GenerateOrderID(seq)
+	order.Status = models.OrderPending
+	order.Timestamp = time.Now()
+	order.ChatID = message.Chat.ID
+
+	// Debit balance and add order atomically
+	newBalance, err := h.db.PlaceOrder(order)
+	if err == database.ErrInsufficientBalance {
+		if userDoc, err = h.db.GetUser(order.UserID); err == nil && userDoc != nil {
+			h.sendInsufficientBalanceMessage(message.Chat.ID, order.Price, userDoc.Balance)
+		}
+		return false
+	}
 	if err != nil {
-		log.Printf("Error adding order: %v", err)
-		return
+		log.Printf("Error placing order: %v", err)
+		return false
 	}
 
-	newBalance := userDoc.Balance - price
-
 	// Notify admins
 	h.notifyAdminsAboutNewOrder(order, message.From, newBalance)
 
 	// Send confirmation to user
-	h.sendOrderConfirmation(message.Chat.ID, orderID, gameID, serverID, amount, price, newBalance)
+	h.sendOrderConfirmation(message.Chat.ID, order, newBalance)
+	return true
 }
 
 func (h *UserHandler) HandleBalance(message *tgbotapi.Message) {
@@ -257,11 +363,15 @@ func (h *UserHandler) HandleBalance(message *tgbotapi.Message) {
 		return
 	}
 
-	// User state checks (simplified in Go version)
-	// if userStates[userID] == "waiting_approval" {
-	//     h.sendWaitingApprovalMessage(message.Chat.ID)
-	//     return
-	// }
+	// Waiting approval check
+	waiting, err := utils.IsWaitingApproval(h.db, userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+	}
+	if waiting {
+		h.sendWaitingApprovalMessage(message.Chat.ID)
+		return
+	}
 
 	// Pending topup check
 	// if hasPendingTopup(userID) {
@@ -290,13 +400,15 @@ func (h *UserHandler) HandleBalance(message *tgbotapi.Message) {
 	h.db.UpdateUserProfile(userID, name, username)
 
 	// Calculate pending topups
-	pendingCount := 0
+	pendingTopups, err := h.db.GetUserTopups(userID, "pending", 0)
+	if err != nil {
+		log.Printf("Error getting pending topups: %v", err)
+	}
+
+	pendingCount := len(pendingTopups)
 	pendingAmount := 0
-	for _, topup := range userDoc.Topups {
-		if topup.Status == "pending" {
-			pendingCount++
-			pendingAmount += topup.Amount
-		}
+	for _, topup := range pendingTopups {
+		pendingAmount += topup.Amount
 	}
 
 	// Send balance information
@@ -319,12 +431,7 @@ func (h *UserHandler) HandleTopup(message *tgbotapi.Message, args string) {
 	}
 
 	// Maintenance check
-	settings, err := h.db.LoadSettings(
-		map[string]interface{}{}, // defaultPayment
-		map[string]interface{}{}, // defaultMaintenance  
-		map[string]interface{}{}, // defaultAffiliate
-		map[string]interface{}{}, // defaultAutoDelete
-	)
+	settings, err := utils.LoadSettings(h.db)
 	if err != nil {
 		log.Printf("Error loading settings: %v", err)
 	}
@@ -336,11 +443,15 @@ func (h *UserHandler) HandleTopup(message *tgbotapi.Message, args string) {
 		}
 	}
 
-	// User state checks (simplified in Go version)
-	// if userStates[userID] == "waiting_approval" {
-	//     h.sendWaitingApprovalMessage(message.Chat.ID)
-	//     return
-	// }
+	// Waiting approval check
+	waiting, err := utils.IsWaitingApproval(h.db, userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+	}
+	if waiting {
+		h.sendWaitingApprovalMessage(message.Chat.ID)
+		return
+	}
 
 	// Pending topup check
 	hasPending, err := utils.HasPendingTopup(h.db, userID)
@@ -365,66 +476,945 @@ func (h *UserHandler) HandleTopup(message *tgbotapi.Message, args string) {
 		return
 	}
 
-	// Store pending topup (in-memory, in production you might want to use Redis)
-	// pendingTopups[userID] = &models.PendingTopup{
-	//     Amount:    amount,
-	//     Timestamp: time.Now(),
-	// }
+	methods, err := h.db.LoadPaymentMethods()
+	if err != nil {
+		log.Printf("Error loading payment methods: %v", err)
+		return
+	}
+
+	if !acceptsAny(methods, amount) {
+		h.sendNoPaymentMethodMessage(message.Chat.ID, amount, methods)
+		return
+	}
+
+	// Remember the amount until the payment method and screenshot arrive
+	state := models.NewUserState(userID, models.StateAwaitingPaymentMethod, models.PendingTopup{
+		Amount:    amount,
+		Timestamp: time.Now(),
+	}, time.Now())
+	if err := h.db.SetUserState(state); err != nil {
+		log.Printf("Error saving user state: %v", err)
+		return
+	}
 
 	// Send payment method selection
-	h.sendPaymentMethodSelection(message.Chat.ID, amount)
+	h.sendPaymentMethodSelection(message.Chat.ID, amount, methods)
 }
 
-// Message sending helper methods
-func (h *UserHandler) sendWelcomeMessage(chatID int64, userID string, name string) {
-	text := fmt.Sprintf("👋 ***မင်္ဂလာပါ*** [%s](tg://user?id=%s)!\\n\\n"+
-		"💎 ***SASUKE MLBB TOP UP BOT*** မှ ကြိုဆိုပါတယ်\\.\\n\\n"+
-		"***အသုံးပြုနိုင်တဲ့ command များ***:\\n"+
-		"➤ /mmb gameid serverid amount\\n"+
-		"➤ /balance \\- ဘယ်လောက်လက်ကျန်ရှိလဲ စစ်မယ်\\n"+
-		"➤ /topup amount \\- ငွေဖြည့်မယ် \\(screenshot တင်ပါ\\)\\n"+
-		"➤ /price \\- Diamond များရဲ့ ဈေးနှုန်းများ\\n"+
-		"➤ /history \\- အော်ဒါမှတ်တမ်းကြည့်မယ်\\n\\n"+
-		"***📌 ဥပမာ***:\\n"+
-		"`/mmb 123456789 12345 wp1`\\n\\n"+
-		"***လိုအပ်တာရှိရင် Owner ကို ဆက်သွယ်နိုင်ပါတယ်\\.***",
-		utils.EscapeMarkdown(name), userID)
+func (h *UserHandler) HandlePhoto(message *tgbotapi.Message) {
+	userID := strconv.FormatInt(message.From.ID, 10)
 
-	utils.SendMessage(h.bot, chatID, text, "MarkdownV2")
+	// Authorization check
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return
+	}
+
+	if !authorizedUsers[userID] && userID != strconv.FormatInt(h.config.AdminID, 10) {
+		h.sendNotAuthorizedMessage(message.Chat.ID)
+		return
+	}
+
+	// A screenshot only counts after /topup and a payment method
+	state, err := h.db.GetUserState(userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+		return
+	}
+
+	if state == nil {
+		h.sendNoTopupInProgressMessage(message.Chat.ID)
+		return
+	}
+
+	switch state.State {
+	case models.StateAwaitingOrderAccount:
+		h.sendNoTopupInProgressMessage(message.Chat.ID)
+		return
+	case models.StateAwaitingPaymentMethod:
+		h.sendChoosePaymentMethodMessage(message.Chat.ID, state.Topup.Amount)
+		return
+	case models.StateWaitingApproval:
+		h.sendWaitingApprovalMessage(message.Chat.ID)
+		return
+	}
+	pending := state.Topup
+
+	// The payer name is what ties referees' topups to one payment account,
+	// so referred users cannot leave it out
+	if strings.TrimSpace(message.Caption) == "" {
+		userDoc, err := h.db.GetUser(userID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			return
+		}
+		if userDoc != nil && userDoc.ReferredBy != "" {
+			h.sendPayerNameRequiredMessage(message.Chat.ID)
+			return
+		}
+	}
+
+	seq, err := h.db.NextSequence("topups")
+	if err != nil {
+		log.Printf("Error generating topup ID: %v", err)
+		return
+	}
+
+	topup := models.Topup{
+		TopupID:       utils.GenerateTopupID(seq),
+		Amount:        pending.Amount,
+		PaymentMethod: pending.PaymentMethod,
+		Status:        "pending",
+		Timestamp:     time.Now(),
+		UserID:        userID,
+		ChatID:        message.Chat.ID,
+		PayerName:     strings.TrimSpace(message.Caption),
+		PayerKey:      models.NormalizePayerName(message.Caption),
+	}
+
+	if err := h.db.AddTopup(topup); err != nil {
+		log.Printf("Error adding topup: %v", err)
+		text := "❌ ***Screenshot လက်ခံရာတွင် အမှားရှိပါတယ်!***\n\n💡 ***ခဏနေ ပြန်တင်ပေးပါ။***"
+		utils.SendMessage(h.bot, message.Chat.ID, text, "Markdown")
+		return
+	}
+
+	state.TopupID = topup.TopupID
+	state.Advance(models.StateWaitingApproval, time.Now())
+	if err := h.db.SetUserState(*state); err != nil {
+		log.Printf("Error saving user state: %v", err)
+	}
+
+	// Largest size is last
+	photoFileID := message.Photo[len(message.Photo)-1].FileID
+
+	// Notify admins
+	h.notifyAdminsAboutNewTopup(topup, message.From, photoFileID)
+
+	// Send confirmation to user
+	text := fmt.Sprintf("✅ ***Screenshot လက်ခံရရှိပါပြီ!***\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"💰 ***ပမာဏ:*** `%d MMK`\n"+
+		"💳 ***Payment:*** %s\n\n"+
+		"⏳ ***Admin က စစ်ဆေးပြီး approve လုပ်တဲ့အထိ စောင့်ပါ။***",
+		topup.TopupID, topup.Amount, h.paymentMethodName(topup.PaymentMethod))
+	utils.SendMessage(h.bot, message.Chat.ID, text, "Markdown")
 }
 
-func (h *UserHandler) sendNotAuthorizedMessage(chatID int64) {
-	keyboard := utils.CreateInlineKeyboard([][]tgbotapi.InlineKeyboardButton{
-		{
-			tgbotapi.NewInlineKeyboardButtonURL("👑 Contact Owner", 
-				fmt.Sprintf("tg://user?id=%d", h.config.AdminID)),
-		},
-	})
+// HandleText answers a message that is neither a command nor a photo.
+func (h *UserHandler) HandleText(message *tgbotapi.Message) {
+	// The game account for an order started from /price
+	if h.HandleOrderAccount(message) {
+		return
+	}
 
-	text := "🚫 အသုံးပြုခွင့် မရှိပါ!\\n\\nOwner ထံ bot အသုံးပြုခွင့် တောင်းဆိုပါ\\."
-	utils.SendMessageWithKeyboard(h.bot, chatID, text, "MarkdownV2", keyboard)
+	// Handle non-command text messages
+	// This could include:
+	// 1. Auto-calculator functionality
+	// 2. Simple replies to common questions
+	// 3. Other text-based interactions
+	reply := utils.SimpleReply(message.Text)
+	if reply != "" {
+		userID := strconv.FormatInt(message.From.ID, 10)
+		// Check if user is authorized before sending reply
+		authorizedUsers, err := h.db.LoadAuthorizedUsers()
+		if err == nil && (authorizedUsers[userID] || userID == strconv.FormatInt(h.config.AdminID, 10)) {
+			utils.SendMessage(h.bot, message.Chat.ID, reply, "Markdown")
+		}
+	}
 }
 
-func (h *UserHandler) sendMaintenanceMessage(chatID int64, commandType string) {
-	var text string
-	
-	switch commandType {
-	case "orders":
-		text = "⏸️ ***Bot အော်ဒါတင်ခြင်းအား ခေတ္တ ယာယီပိတ်ထားပါသည်*** ⏸️\\n\\n" +
-			"***🔄 Admin မှ ပြန်လည်ဖွင့်ပေးမှ အသုံးပြုနိုင်ပါမည်\\.***"
-	case "topups":
-		text = "⏸️ ***Bot ငွေဖြည့်ခြင်းအား ခေတ္တ ယာယီပိတ်ထားပါသည်*** ⏸️\\n\\n" +
-			"***🔄 Admin မှ ပြန်လည်ဖွင့်ပေးမှ အသုံးပြုနိုင်ပါမည်\\.***"
-	default:
-		text = "⏸️ ***Bot အား ခေတ္တ ယာယီပိတ်ထားပါသည်*** ⏸️\\n\\n" +
-			"***🔄 Admin မှ ပြန်လည်ဖွင့်ပေးမှ အသုံးပြုနိုင်ပါမည်\\.***"
+func (h *UserHandler) HandleRegister(message *tgbotapi.Message) {
+	user := message.From
+	userID := strconv.FormatInt(user.ID, 10)
+
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err == nil && authorizedUsers[userID] {
+		text := "✅ သင်သည် အသုံးပြုခွင့် ရပြီးသား ဖြစ်ပါတယ်!\n\n🚀 /start နှိပ်ပါ။"
+		utils.SendMessage(h.bot, message.Chat.ID, text, "Markdown")
+		return
 	}
-	
-	utils.SendMessage(h.bot, chatID, text, "MarkdownV2")
+
+	// Send registration request to admins
+	h.handleRegistrationRequest(user)
+}
+
+func (h *UserHandler) HandleUnknownCommand(message *tgbotapi.Message) {
+	text := "❌ ***မသိသော command ဖြစ်ပါတယ်!***\n\n💡 ***အသုံးပြုနိုင်သော commands များကို ကြည့်ရန် /start နှိပ်ပါ။***"
+	utils.SendMessage(h.bot, message.Chat.ID, text, "Markdown")
 }
 
-// Additional helper methods would be implemented here...
-// (sendPendingTopupWarning, sendInvalidFormatMessage, sendInvalidGameIDMessage, etc.)
+func (h *UserHandler) HandleCancel(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	// Authorization check
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return
+	}
 
-// Note: The complete implementation would include all the message sending methods
-// and notification methods from the Python version.
+	if !authorizedUsers[userID] && userID != strconv.FormatInt(h.config.AdminID, 10) {
+		h.sendNotAuthorizedMessage(message.Chat.ID)
+		return
+	}
+
+	argList := strings.Fields(args)
+	if len(argList) > 1 {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/cancel ORDxxxx")
+		return
+	}
+
+	// Withdraw a specific order or topup
+	if len(argList) == 1 {
+		requestID := strings.ToUpper(argList[0])
+		switch {
+		case strings.HasPrefix(requestID, "ORD"):
+			h.withdrawOrder(message, requestID)
+		case strings.HasPrefix(requestID, "TOP"):
+			h.withdrawTopup(message, requestID)
+		default:
+			h.sendInvalidFormatMessage(message.Chat.ID, "/cancel ORDxxxx")
+		}
+		return
+	}
+
+	// Abort a topup that has not been paid yet, or an order started from /price
+	state, err := h.db.GetUserState(userID)
+	if err != nil {
+		log.Printf("Error loading user state: %v", err)
+		return
+	}
+
+	if state != nil && state.State != models.StateWaitingApproval {
+		if err := h.db.ClearUserState(userID); err != nil {
+			log.Printf("Error clearing user state: %v", err)
+			return
+		}
+		text := "✅ ***ငွေဖြည့်ခြင်း ပယ်ဖျက်ပါပြီ!***\n\n💡 ***ပြန်ဖြည့်ချင်ရင်*** /topup ***နှိပ်ပါ။***"
+		if state.State == models.StateAwaitingOrderAccount {
+			text = "✅ ***Order ပယ်ဖျက်ပါပြီ!***\n\n💡 ***ဈေးနှုန်းများ ပြန်ကြည့်ရန်*** /price ***နှိပ်ပါ။***"
+		}
+		utils.SendMessage(h.bot, message.Chat.ID, text, "Markdown")
+		return
+	}
+
+	// Otherwise withdraw the topup that is waiting for an admin
+	if state != nil && state.TopupID != "" {
+		h.withdrawTopup(message, state.TopupID)
+		return
+	}
+
+	pendingTopups, err := h.db.GetUserTopups(userID, "pending", 1)
+	if err != nil {
+		log.Printf("Error getting pending topups: %v", err)
+		return
+	}
+	if len(pendingTopups) > 0 {
+		h.withdrawTopup(message, pendingTopups[0].TopupID)
+		return
+	}
+
+	h.sendNothingToCancelMessage(message.Chat.ID)
+}
+
+// withdrawOrder cancels one of the user's own orders before an admin has
+// acted on it and refunds the price.
+func (h *UserHandler) withdrawOrder(message *tgbotapi.Message, orderID string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+	userName := utils.GetUserDisplayName(message.From)
+
+	order, err := h.db.GetOrder(orderID)
+	if err != nil {
+		log.Printf("Error getting order %s: %v", orderID, err)
+		return
+	}
+
+	if order == nil || order.UserID != userID {
+		h.sendOrderNotFoundMessage(message.Chat.ID, orderID)
+		return
+	}
+
+	if order.Status != models.OrderPending {
+		h.sendCannotCancelMessage(message.Chat.ID, orderID, orderStatusText(order.Status))
+		return
+	}
+
+	// Share the claim with the admin Confirm/Cancel buttons
+	actionKey := "order:" + orderID
+	claimed, _, err := h.db.ClaimCallback(actionKey, "order_withdraw", userID, userName)
+	if err != nil {
+		log.Printf("Error claiming order %s: %v", orderID, err)
+		return
+	}
+
+	if !claimed {
+		h.sendCannotCancelMessage(message.Chat.ID, orderID, "🔄 Admin လုပ်ဆောင်နေသည်")
+		return
+	}
+
+	order, err = h.db.CancelOrder(orderID, userName)
+	if err != nil {
+		log.Printf("Error withdrawing order %s: %v", orderID, err)
+		h.db.ReleaseCallback(actionKey)
+		h.sendCannotCancelMessage(message.Chat.ID, orderID, "⚠️ မအောင်မြင်ပါ")
+		return
+	}
+
+	adminText := fmt.Sprintf("🚫 ***User က အော်ဒါ ပယ်ဖျက်လိုက်ပါပြီ***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"🆔 ***User ID:*** `%s`\n"+
+		"💰 ***ငွေပြန်အမ်း:*** `%d MMK`",
+		orderID, userID, order.Price)
+	h.markAdminMessageWithdrawn(order.AdminChatID, order.AdminMessageID, false, adminText)
+
+	balanceText := ""
+	if userDoc, err := h.db.GetUser(userID); err == nil && userDoc != nil {
+		balanceText = fmt.Sprintf("\n💳 ***လက်ကျန်:*** `%d MMK`", userDoc.Balance)
+	}
+
+	text := fmt.Sprintf("✅ ***အော်ဒါ ပယ်ဖျက်ပါပြီ!***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"💰 ***ငွေပြန်အမ်း:*** `%d MMK`%s",
+		orderID, order.Price, balanceText)
+	utils.SendMessage(h.bot, message.Chat.ID, text, "Markdown")
+}
+
+// withdrawTopup cancels one of the user's own topups while it still waits for
+// an admin. Nothing was credited yet, so there is nothing to reverse.
+func (h *UserHandler) withdrawTopup(message *tgbotapi.Message, topupID string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+	userName := utils.GetUserDisplayName(message.From)
+
+	topup, err := h.db.GetTopup(topupID)
+	if err != nil {
+		log.Printf("Error getting topup %s: %v", topupID, err)
+		return
+	}
+
+	if topup == nil || topup.UserID != userID {
+		h.sendTopupNotFoundMessage(message.Chat.ID, topupID)
+		return
+	}
+
+	if topup.Status != "pending" {
+		h.sendCannotCancelMessage(message.Chat.ID, topupID, topup.Status)
+		return
+	}
+
+	// Share the claim with the admin Approve/Reject buttons
+	actionKey := "topup:" + topupID
+	claimed, _, err := h.db.ClaimCallback(actionKey, "topup_withdraw", userID, userName)
+	if err != nil {
+		log.Printf("Error claiming topup %s: %v", topupID, err)
+		return
+	}
+
+	if !claimed {
+		h.sendCannotCancelMessage(message.Chat.ID, topupID, "🔄 Admin လုပ်ဆောင်နေသည်")
+		return
+	}
+
+	updates := bson.M{
+		"status":       "cancelled",
+		"cancelled_by": userName,
+		"cancelled_at": time.Now(),
+	}
+
+	if _, err := h.db.FindAndUpdateTopup(topupID, updates); err != nil {
+		log.Printf("Error withdrawing topup %s: %v", topupID, err)
+		h.db.ReleaseCallback(actionKey)
+		h.sendCannotCancelMessage(message.Chat.ID, topupID, "⚠️ မအောင်မြင်ပါ")
+		return
+	}
+
+	if err := utils.ClearTopupState(h.db, userID, topupID); err != nil {
+		log.Printf("Error clearing user state: %v", err)
+	}
+
+	adminText := fmt.Sprintf("🚫 ***User က ငွေဖြည့်ခြင်း ပယ်ဖျက်လိုက်ပါပြီ***\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"🆔 ***User ID:*** `%s`\n"+
+		"💰 ***ပမာဏ:*** `%d MMK`",
+		topupID, userID, topup.Amount)
+	h.markAdminMessageWithdrawn(topup.AdminChatID, topup.AdminMessageID, true, adminText)
+
+	text := fmt.Sprintf("✅ ***ငွေဖြည့်ခြင်း ပယ်ဖျက်ပါပြီ!***\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"💰 ***ပမာဏ:*** `%d MMK`\n\n"+
+		"💡 ***ပြန်ဖြည့်ချင်ရင်*** /topup ***နှိပ်ပါ။***",
+		topupID, topup.Amount)
+	utils.SendMessage(h.bot, message.Chat.ID, text, "Markdown")
+}
+
+func (h *UserHandler) HandleAffiliate(message *tgbotapi.Message) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	// Authorization check
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return
+	}
+
+	if !authorizedUsers[userID] && userID != strconv.FormatInt(h.config.AdminID, 10) {
+		h.sendNotAuthorizedMessage(message.Chat.ID)
+		return
+	}
+
+	userDoc, err := h.db.GetUser(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		return
+	}
+
+	if userDoc == nil {
+		h.sendStartFirstMessage(message.Chat.ID)
+		return
+	}
+
+	// Last six months, counted from the first of the month
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month()-5, 1, 0, 0, 0, 0, time.UTC)
+	stats, err := h.db.GetReferralStats(userID, since, 5)
+	if err != nil {
+		log.Printf("Error getting referral stats: %v", err)
+		return
+	}
+
+	settings, err := utils.LoadSettings(h.db)
+	if err != nil {
+		log.Printf("Error loading settings: %v", err)
+	}
+	affiliateBlock, _ := settings["affiliate"].(map[string]interface{})
+	affiliate := models.ParseAffiliateSettings(affiliateBlock)
+
+	h.sendAffiliateInfo(message.Chat.ID, userDoc, stats, affiliate)
+}
+
+func (h *UserHandler) HandleOrder(message *tgbotapi.Message, args string) {
+	userID := strconv.FormatInt(message.From.ID, 10)
+	isAdmin := utils.HasPermission(h.db, h.config.AdminID, userID, models.PermOrders)
+
+	// Authorization check
+	authorizedUsers, err := h.db.LoadAuthorizedUsers()
+	if err != nil {
+		log.Printf("Error loading authorized users: %v", err)
+		return
+	}
+
+	if !authorizedUsers[userID] && !isAdmin {
+		h.sendNotAuthorizedMessage(message.Chat.ID)
+		return
+	}
+
+	argList := strings.Fields(args)
+	if len(argList) != 1 {
+		h.sendInvalidFormatMessage(message.Chat.ID, "/order ORDxxxx")
+		return
+	}
+
+	orderID := strings.ToUpper(argList[0])
+	order, err := h.db.GetOrder(orderID)
+	if err != nil {
+		log.Printf("Error getting order %s: %v", orderID, err)
+		return
+	}
+
+	// Users can only look up their own orders
+	if order == nil || (!isAdmin && order.UserID != userID) {
+		h.sendOrderNotFoundMessage(message.Chat.ID, orderID)
+		return
+	}
+
+	h.sendOrderStatus(message.Chat.ID, order, isAdmin)
+}
+
+// Message sending helper methods
+func (h *UserHandler) sendWelcomeMessage(chatID int64, userID string, name string) {
+	text := fmt.Sprintf("👋 ***မင်္ဂလာပါ*** [%s](tg://user?id=%s)!\\n\\n"+
+		"💎 ***SASUKE MLBB TOP UP BOT*** မှ ကြိုဆိုပါတယ်\\.\\n\\n"+
+		"***အသုံးပြုနိုင်တဲ့ command များ***:\\n"+
+		"➤ /mmb gameid serverid amount\\n"+
+		"➤ /pubg playerid 660uc \\- PUBG UC ဝယ်မယ်\\n"+
+		"➤ /balance \\- ဘယ်လောက်လက်ကျန်ရှိလဲ စစ်မယ်\\n"+
+		"➤ /topup amount \\- ငွေဖြည့်မယ် \\(screenshot တင်ပါ\\)\\n"+
+		"➤ /price \\- Diamond များရဲ့ ဈေးနှုန်းများ\\n"+
+		"➤ /history \\- အော်ဒါမှတ်တမ်းကြည့်မယ်\\n"+
+		"➤ /order ORDxxxx \\- အော်ဒါအခြေအနေ စစ်မယ်\\n"+
+		"➤ /cancel \\- ငွေဖြည့်ခြင်း/အော်ဒါ ပယ်ဖျက်မယ်\\n\\n"+
+		"***📌 ဥပမာ***:\\n"+
+		"`/mmb 123456789 12345 wp1`\\n\\n"+
+		"***လိုအပ်တာရှိရင် Owner ကို ဆက်သွယ်နိုင်ပါတယ်\\.***",
+		utils.EscapeMarkdown(name), userID)
+
+	utils.SendMessage(h.bot, chatID, text, "MarkdownV2")
+}
+
+func (h *UserHandler) sendNotAuthorizedMessage(chatID int64) {
+	keyboard := utils.CreateInlineKeyboard([][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonURL("👑 Contact Owner", 
+				fmt.Sprintf("tg://user?id=%d", h.config.AdminID)),
+		},
+	})
+
+	text := "🚫 အသုံးပြုခွင့် မရှိပါ!\\n\\nOwner ထံ bot အသုံးပြုခွင့် တောင်းဆိုပါ\\."
+	utils.SendMessageWithKeyboard(h.bot, chatID, text, "MarkdownV2", keyboard)
+}
+
+func (h *UserHandler) sendMaintenanceMessage(chatID int64, commandType string) {
+	var text string
+	
+	switch commandType {
+	case "orders":
+		text = "⏸️ ***Bot အော်ဒါတင်ခြင်းအား ခေတ္တ ယာယီပိတ်ထားပါသည်*** ⏸️\\n\\n" +
+			"***🔄 Admin မှ ပြန်လည်ဖွင့်ပေးမှ အသုံးပြုနိုင်ပါမည်\\.***"
+	case "topups":
+		text = "⏸️ ***Bot ငွေဖြည့်ခြင်းအား ခေတ္တ ယာယီပိတ်ထားပါသည်*** ⏸️\\n\\n" +
+			"***🔄 Admin မှ ပြန်လည်ဖွင့်ပေးမှ အသုံးပြုနိုင်ပါမည်\\.***"
+	default:
+		text = "⏸️ ***Bot အား ခေတ္တ ယာယီပိတ်ထားပါသည်*** ⏸️\\n\\n" +
+			"***🔄 Admin မှ ပြန်လည်ဖွင့်ပေးမှ အသုံးပြုနိုင်ပါမည်\\.***"
+	}
+	
+	utils.SendMessage(h.bot, chatID, text, "MarkdownV2")
+}
+
+func (h *UserHandler) sendOrderNotFoundMessage(chatID int64, orderID string) {
+	text := fmt.Sprintf("❌ ***Order မတွေ့ပါ!***\n\n📝 ***Order ID:*** `%s`\n\n💡 ***Order ID ကို ပြန်စစ်ပြီး ထပ်ကြိုးစားပါ။***",
+		orderID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendAffiliateInfo(chatID int64, user *models.User, stats *models.ReferralStats, affiliate models.AffiliateSettings) {
+	referralLink := fmt.Sprintf("https://t.me/%s?start=%s", h.config.BotUsername, user.UserID)
+
+	text := fmt.Sprintf("💸 ***Affiliate Program***\n\n"+
+		"ဒီ bot လေးကို သူငယ်ချင်းတွေဆီ မျှဝေပြီး commission ရယူလိုက်ပါ။\n\n"+
+		"***သင်၏ Referral Link:***\n"+
+		"`%s`\n\n",
+		referralLink)
+
+	if affiliate.Enabled {
+		text += fmt.Sprintf("🎁 ***Commission:*** ငွေဖြည့်တိုင်း `%g%%`", affiliate.Percentage)
+		if affiliate.MinTopup > 0 {
+			text += fmt.Sprintf(" (`%d MMK` နှင့်အထက်)", affiliate.MinTopup)
+		}
+		text += "\n\n"
+	} else {
+		text += "⏸️ ***Commission ကို ခေတ္တ ပိတ်ထားပါသည်***\n\n"
+	}
+
+	text += fmt.Sprintf("👥 ***ဖိတ်ခေါ်ထားသူ:*** `%d` ယောက်\n"+
+		"✅ ***ငွေဖြည့်ဖူးသူ:*** `%d` ယောက်\n"+
+		"💰 ***စုစုပေါင်း ရရှိငွေ:*** `%d MMK`\n",
+		stats.Signups, stats.Active, user.ReferralEarnings)
+
+	if len(stats.MonthlyCommission) > 0 {
+		text += "\n📅 ***လအလိုက် Commission:***\n"
+		for _, month := range stats.MonthlyCommission {
+			text += fmt.Sprintf("➤ %s: `%d MMK` (%d ကြိမ်)\n", month.Month, month.Amount, month.Count)
+		}
+	}
+
+	if len(stats.RecentCommissions) > 0 {
+		text += "\n🧾 ***နောက်ဆုံး Commission များ:***\n"
+		for _, entry := range stats.RecentCommissions {
+			text += fmt.Sprintf("➤ %s `%s` `%+d MMK`\n",
+				entry.CreatedAt.Format("2006-01-02"), entry.ReferenceID, entry.Change)
+		}
+	}
+
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendTopupNotFoundMessage(chatID int64, topupID string) {
+	text := fmt.Sprintf("❌ ***Topup မတွေ့ပါ!***\n\n📝 ***Topup ID:*** `%s`\n\n💡 ***Topup ID ကို ပြန်စစ်ပြီး ထပ်ကြိုးစားပါ။***",
+		topupID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendCannotCancelMessage(chatID int64, requestID string, status string) {
+	text := fmt.Sprintf("❌ ***ပယ်ဖျက်လို့ မရတော့ပါ!***\n\n"+
+		"📝 ***ID:*** `%s`\n"+
+		"📊 ***Status:*** %s\n\n"+
+		"💡 ***Admin က လုပ်ဆောင်ပြီးသား ဖြစ်ပါတယ်။ အကူအညီလိုရင် Owner ကို ဆက်သွယ်ပါ။***",
+		requestID, status)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendNothingToCancelMessage(chatID int64) {
+	text := "ℹ️ ***ပယ်ဖျက်စရာ မရှိပါ!***\n\n" +
+		"💡 ***အော်ဒါ ပယ်ဖျက်ရန်:*** `/cancel ORDxxxx`"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendOrderStatus(chatID int64, order *models.Order, isAdmin bool) {
+	status := orderStatusText(order.Status)
+
+	text := fmt.Sprintf("📦 ***Order အခြေအနေ***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"🎮 ***%s ID:*** `%s`\n"+
+		"💎 ***Amount:*** %s\n"+
+		"💰 ***Price:*** `%d MMK`\n"+
+		"📊 ***Status:*** %s\n"+
+		"🕒 ***Time:*** %s",
+		order.OrderID, models.GameName(order.GameCode()), order.AccountText(), order.Amount, order.Price,
+		status, order.Timestamp.Format("2006-01-02 15:04"))
+
+	if order.ConfirmedBy != "" {
+		text += fmt.Sprintf("\n👤 ***Confirmed by:*** %s", order.ConfirmedBy)
+	}
+
+	if isAdmin {
+		text += fmt.Sprintf("\n🆔 ***User ID:*** `%s`", order.UserID)
+	}
+
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendInvalidAccountIDMessage(chatID int64, game models.Game, field models.IDField) {
+	text := fmt.Sprintf("❌ ***%s %s မှားနေပါတယ်!***\n\n"+
+		"💡 ***%s သည် ဂဏန်း %d လုံးမှ %d လုံးအထိ ဖြစ်ရပါမယ်။***\n\n"+
+		"***ဥပမာ:*** `%s`",
+		game.Name, field.Label, field.Label, field.MinDigits, field.MaxDigits, game.Example)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendInvalidItemMessage(chatID int64, game models.Game, item string) {
+	text := fmt.Sprintf("❌ ***%s မှာ*** `%s` ***ကို လောလောဆယ် ဝယ်လို့ မရပါ!***\n\n"+
+		"💡 ***ဝယ်နိုင်သော item များနဲ့ ဈေးနှုန်းများ ကြည့်ရန်*** /price ***နှိပ်ပါ။***\n\n"+
+		"***ဥပမာ:*** `%s`",
+		game.Name, strings.ReplaceAll(item, "`", "'"), game.Example)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendWaitingApprovalMessage(chatID int64) {
+	text := "⏳ ***Screenshot ကို Admin က စစ်ဆေးနေဆဲ ဖြစ်ပါတယ်!***\n\n" +
+		"💡 ***Approve သို့မဟုတ် Reject လုပ်ပြီးမှ ဆက်လုပ်နိုင်ပါမယ်။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendNoTopupInProgressMessage(chatID int64) {
+	text := "❌ ***ငွေဖြည့်လုပ်ငန်းစဉ် မရှိပါ!***\n\n💡 ***အရင်ဆုံး*** `/topup amount` ***နှိပ်ပြီးမှ screenshot တင်ပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendChoosePaymentMethodMessage(chatID int64, amount int) {
+	methods, err := h.db.LoadPaymentMethods()
+	if err != nil {
+		log.Printf("Error loading payment methods: %v", err)
+		return
+	}
+
+	text := fmt.Sprintf("💳 ***Payment method ကို အရင်ရွေးပါ!***\n\n✅ ***ပမာဏ:*** `%d MMK`", amount)
+	utils.SendMessageWithKeyboard(h.bot, chatID, text, "Markdown", utils.CreatePaymentMethodsKeyboard(methods, amount))
+}
+
+func (h *UserHandler) sendPaymentMethodSelection(chatID int64, amount int, methods []models.PaymentMethod) {
+	text := fmt.Sprintf("💳 ***ငွေဖြည့်လုပ်ငန်းစဉ်***\n\n"+
+		"✅ ***ပမာဏ:*** `%d MMK`\n\n"+
+		"***အဆင့် 2: Payment method ရွေးပါ။***\n\n"+
+		"ℹ️ ***ပယ်ဖျက်ရန် /cancel နှိပ်ပါ***",
+		amount)
+	utils.SendMessageWithKeyboard(h.bot, chatID, text, "Markdown", utils.CreatePaymentMethodsKeyboard(methods, amount))
+}
+
+func (h *UserHandler) sendNoPaymentMethodMessage(chatID int64, amount int, methods []models.PaymentMethod) {
+	text := fmt.Sprintf("❌ ***`%d MMK` ကို လက်ခံနိုင်တဲ့ Payment method မရှိပါ!***\n", amount)
+
+	var limits []string
+	for _, method := range methods {
+		if !method.Enabled {
+			continue
+		}
+		if method.MaxAmount > 0 {
+			limits = append(limits, fmt.Sprintf("📱 %s: `%d - %d MMK`", method.Name, method.MinAmount, method.MaxAmount))
+		} else {
+			limits = append(limits, fmt.Sprintf("📱 %s: `%d MMK` အထက်", method.Name, method.MinAmount))
+		}
+	}
+	if len(limits) > 0 {
+		text += "\n" + strings.Join(limits, "\n")
+	}
+
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) notifyAdminsAboutNewTopup(topup models.Topup, user *tgbotapi.User, photoFileID string) {
+	username := user.UserName
+	if username == "" {
+		username = "-"
+	}
+	payerName := strings.ReplaceAll(topup.PayerName, "`", "'")
+	if payerName == "" {
+		payerName = "-"
+	}
+
+	caption := fmt.Sprintf("💳 ***ငွေဖြည့် တောင်းဆိုမှု***\n\n"+
+		"📝 ***Topup ID:*** `%s`\n"+
+		"👤 ***User:*** %s (@%s)\n"+
+		"🆔 ***User ID:*** `%s`\n"+
+		"💰 ***ပမာဏ:*** `%d MMK`\n"+
+		"💳 ***Payment:*** %s\n"+
+		"🧾 ***ငွေလွှဲသူအမည်:*** `%s`\n"+
+		"🕒 ***Time:*** %s\n\n"+
+		"📊 ***Status:*** ⏳ စောင့်ဆိုင်းနေသည်",
+		topup.TopupID, utils.GetUserDisplayName(user), username, topup.UserID,
+		topup.Amount, h.paymentMethodName(topup.PaymentMethod), payerName,
+		topup.Timestamp.Format("2006-01-02 15:04"))
+
+	photo := tgbotapi.NewPhoto(h.config.AdminGroupID, tgbotapi.FileID(photoFileID))
+	photo.Caption = caption
+	photo.ParseMode = "Markdown"
+	photo.ReplyMarkup = utils.CreateTopupActionKeyboard(topup.TopupID)
+
+	sent, err := h.bot.Send(photo)
+	if err != nil {
+		log.Printf("Error sending topup %s to admin group: %v", topup.TopupID, err)
+		return
+	}
+
+	// Remember the message so a withdrawal can update it
+	if err := h.db.SetTopupAdminMessage(topup.TopupID, sent.Chat.ID, sent.MessageID); err != nil {
+		log.Printf("Error saving admin message for topup %s: %v", topup.TopupID, err)
+	}
+}
+
+func (h *UserHandler) notifyAdminsAboutNewOrder(order models.Order, user *tgbotapi.User, newBalance int) {
+	username := user.UserName
+	if username == "" {
+		username = "-"
+	}
+
+	text := fmt.Sprintf("🛒 ***အော်ဒါအသစ်***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"👤 ***User:*** %s (@%s)\n"+
+		"🆔 ***User ID:*** `%s`\n"+
+		"🎮 ***%s ID:*** `%s`\n"+
+		"💎 ***Amount:*** %s\n"+
+		"💰 ***Price:*** `%d MMK`\n"+
+		"💳 ***လက်ကျန်:*** `%d MMK`\n"+
+		"🕒 ***Time:*** %s\n\n"+
+		"📊 ***Status:*** ⏳ စောင့်ဆိုင်းနေသည်",
+		order.OrderID, utils.GetUserDisplayName(user), username, order.UserID,
+		models.GameName(order.GameCode()), order.AccountText(), order.Amount, order.Price, newBalance,
+		order.Timestamp.Format("2006-01-02 15:04"))
+
+	msg := tgbotapi.NewMessage(h.config.AdminGroupID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = utils.CreateOrderActionKeyboard(order.OrderID, order.Status)
+
+	sent, err := h.bot.Send(msg)
+	if err != nil {
+		log.Printf("Error sending order %s to admin group: %v", order.OrderID, err)
+		return
+	}
+
+	// Remember the message so a withdrawal can update it
+	if err := h.db.SetOrderAdminMessage(order.OrderID, sent.Chat.ID, sent.MessageID); err != nil {
+		log.Printf("Error saving admin message for order %s: %v", order.OrderID, err)
+	}
+}
+
+// markAdminMessageWithdrawn replaces the admin group message of a request the
+// user withdrew and removes its buttons. Requests sent before admin messages
+// were recorded get a new message instead.
+func (h *UserHandler) markAdminMessageWithdrawn(chatID int64, messageID int, isPhoto bool, text string) {
+	if messageID == 0 {
+		utils.SendMessage(h.bot, h.config.AdminGroupID, text, "Markdown")
+		return
+	}
+
+	if isPhoto {
+		edit := tgbotapi.NewEditMessageCaption(chatID, messageID, text)
+		edit.ParseMode = "Markdown"
+		h.bot.Send(edit)
+	} else {
+		utils.EditMessageText(h.bot, chatID, messageID, text, "Markdown")
+	}
+
+	// Remove inline keyboard
+	editReplyMarkup := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, tgbotapi.InlineKeyboardMarkup{})
+	h.bot.Send(editReplyMarkup)
+}
+
+func (h *UserHandler) paymentMethodName(code string) string {
+	methods, err := h.db.LoadPaymentMethods()
+	if err != nil {
+		log.Printf("Error loading payment methods: %v", err)
+		return code
+	}
+	return models.PaymentMethodName(methods, code)
+}
+
+func acceptsAny(methods []models.PaymentMethod, amount int) bool {
+	for _, method := range methods {
+		if method.Accepts(amount) {
+			return true
+		}
+	}
+	return false
+}
+
+func orderStatusText(status models.OrderStatus) string {
+	statusText := map[models.OrderStatus]string{
+		models.OrderPending:    "⏳ စောင့်ဆိုင်းနေသည်",
+		models.OrderProcessing: "🔄 လုပ်ဆောင်နေသည်",
+		models.OrderCompleted:  "✅ လက်ခံပြီး",
+		models.OrderFailed:     "⚠️ မအောင်မြင်ပါ",
+		models.OrderCancelled:  "❌ ငြင်းပယ်ပြီး",
+		models.OrderRefunded:   "↩️ ငွေပြန်အမ်းပြီး",
+	}
+
+	if text, ok := statusText[status]; ok {
+		return text
+	}
+	return string(status)
+}
+
+func (h *UserHandler) sendStartFirstMessage(chatID int64) {
+	text := "❌ ***အရင်ဆုံး /start နှိပ်ပါ!***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendInvalidFormatMessage(chatID int64, usage string) {
+	text := fmt.Sprintf("❌ ***Format မှားနေပါတယ်!***\n\n💡 ***အသုံးပြုပုံ:*** `%s`", usage)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendPayerNameRequiredMessage(chatID int64) {
+	text := "🧾 ***ငွေလွှဲသူ အကောင့်နာမည် ထည့်ရန် လိုအပ်ပါတယ်!***\n\n" +
+		"💡 ***Screenshot ကို caption မှာ ငွေလွှဲသူ အကောင့်နာမည် ရေးပြီး ပြန်ပို့ပေးပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendInvalidAmountMessage(chatID int64) {
+	text := "❌ ***ပမာဏ မှားနေပါတယ်!***\n\n" +
+		"💡 ***ငွေဖြည့်ရန် အနည်းဆုံး*** `1000 MMK` ***ဖြစ်ရပါမယ်။***\n" +
+		"💎 ***ဝယ်လို့ရတဲ့ item များကို*** /price ***မှာ ကြည့်ပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendInsufficientBalanceMessage(chatID int64, price int, balance int) {
+	text := fmt.Sprintf("❌ ***လက်ကျန်ငွေ မလုံလောက်ပါ!***\n\n"+
+		"💰 ***ကျသင့်ငွေ:*** `%d MMK`\n"+
+		"💳 ***လက်ကျန်:*** `%d MMK`\n"+
+		"❗ ***လိုအပ်ငွေ:*** `%d MMK`\n\n"+
+		"💡 ***ငွေဖြည့်ရန်*** `/topup amount` ***နှိပ်ပါ။***",
+		price, balance, price-balance)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendPendingTopupWarning(chatID int64) {
+	text := "⏳ ***Admin approve မလုပ်ရသေးတဲ့ ငွေဖြည့်မှု ရှိနေပါတယ်!***\n\n" +
+		"💡 ***Approve ပြီးမှ ဆက်လုပ်နိုင်ပါမယ်။ ပယ်ဖျက်ချင်ရင်*** /cancel ***နှိပ်ပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendPendingTopupProcessMessage(chatID int64) {
+	text := "⏳ ***ငွေဖြည့်မှု တစ်ခု စစ်ဆေးနေဆဲ ဖြစ်ပါတယ်!***\n\n" +
+		"💡 ***အရင် ငွေဖြည့်မှု ပြီးမှ ထပ်ဖြည့်နိုင်ပါမယ်။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendBannedAccountMessage(chatID int64, gameID string) {
+	text := fmt.Sprintf("🚫 ***ဒီ account ကို order တင်ခွင့် မရှိပါ!***\n\n"+
+		"🎮 ***ID:*** `%s`\n\n"+
+		"📞 ***အကူအညီလိုရင် Owner ကို ဆက်သွယ်ပါ။***",
+		gameID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendOrderConfirmation(chatID int64, order models.Order, newBalance int) {
+	delivered := "Amount"
+	if game := models.FindGame(order.GameCode()); game != nil {
+		delivered = game.Name + " " + game.Unit
+	}
+
+	text := fmt.Sprintf("✅ ***အော်ဒါ တင်ပြီးပါပြီ!***\n\n"+
+		"📝 ***Order ID:*** `%s`\n"+
+		"🎮 ***%s ID:*** `%s`\n"+
+		"💎 ***%s:*** `%s`\n"+
+		"💰 ***Price:*** `%d MMK`\n"+
+		"💳 ***လက်ကျန်:*** `%d MMK`\n\n"+
+		"⏳ ***Admin က လုပ်ဆောင်ပေးတဲ့အထိ စောင့်ပါ။***",
+		order.OrderID, models.GameName(order.GameCode()), order.AccountText(), delivered, order.Amount,
+		order.Price, newBalance)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) sendBalanceInfo(chatID int64, user *models.User, pendingCount int, pendingAmount int) {
+	text := fmt.Sprintf("💳 ***သင့်အကောင့်***\n\n"+
+		"💰 ***လက်ကျန်ငွေ:*** `%d MMK`\n"+
+		"💸 ***Referral ရရှိငွေ:*** `%d MMK`",
+		user.Balance, user.ReferralEarnings)
+
+	if pendingCount > 0 {
+		text += fmt.Sprintf("\n⏳ ***စောင့်ဆိုင်းနေသော ငွေဖြည့်မှု:*** `%d` ခု (`%d MMK`)", pendingCount, pendingAmount)
+	}
+
+	text += "\n\n💡 ***ငွေဖြည့်ရန်*** `/topup amount` ***နှိပ်ပါ။***"
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) notifyReferrer(referrerID string, name string, userID string) {
+	chatID, err := strconv.ParseInt(referrerID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	text := fmt.Sprintf("🎉 ***သင့် Referral Link မှ user အသစ် ဝင်လာပါပြီ!***\n\n"+
+		"👤 ***Name:*** %s\n"+
+		"🆔 ***User ID:*** `%s`\n\n"+
+		"💸 ***သူ ငွေဖြည့်တိုင်း commission ရရှိပါမယ်။***",
+		strings.ReplaceAll(name, "*", ""), userID)
+	utils.SendMessage(h.bot, chatID, text, "Markdown")
+}
+
+func (h *UserHandler) notifyAdminsAboutBannedAccount(user *tgbotapi.User, gameID, serverID, amount string) {
+	username := user.UserName
+	if username == "" {
+		username = "-"
+	}
+
+	text := fmt.Sprintf("🚫 ***Ban ထားသော account ဖြင့် order တင်ရန် ကြိုးစားမှု***\n\n"+
+		"👤 ***User:*** %s (@%s)\n"+
+		"🆔 ***User ID:*** `%d`\n"+
+		"🎮 ***ID:*** `%s` (`%s`)\n"+
+		"💎 ***Amount:*** %s",
+		utils.GetUserDisplayName(user), username, user.ID, gameID, orNone(serverID), amount)
+	utils.SendMessage(h.bot, h.config.AdminGroupID, text, "Markdown")
+}
+
+// handleRegistrationRequest asks the admins to let a user in and tells the
+// user the request was sent.
+func (h *UserHandler) handleRegistrationRequest(user *tgbotapi.User) {
+	userID := strconv.FormatInt(user.ID, 10)
+	username := user.UserName
+	if username == "" {
+		username = "-"
+	}
+
+	adminText := fmt.Sprintf("📝 ***Registration တောင်းဆိုမှု***\n\n"+
+		"👤 ***User:*** %s (@%s)\n"+
+		"🆔 ***User ID:*** `%s`",
+		utils.GetUserDisplayName(user), username, userID)
+	keyboard := utils.CreateInlineKeyboard([][]tgbotapi.InlineKeyboardButton{
+		{
+			tgbotapi.NewInlineKeyboardButtonData("✅ Approve", "register_approve_"+userID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Reject", "register_reject_"+userID),
+		},
+	})
+	if err := utils.SendMessageWithKeyboard(h.bot, h.config.AdminGroupID, adminText, "Markdown", keyboard); err != nil {
+		log.Printf("Error sending registration request for %s: %v", userID, err)
+	}
+
+	text := fmt.Sprintf("✅ ***Registration တောင်းဆိုမှု ပို့ပြီးပါပြီ!***\n\n"+
+		"🆔 ***သင့် User ID:*** `%s`\n\n"+
+		"⏳ ***Owner က approve လုပ်တဲ့အထိ စောင့်ပါ။***",
+		userID)
+	utils.SendMessage(h.bot, user.ID, text, "Markdown")
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+type AdminRole string
+
+const (
+	RoleOwner   AdminRole = "owner"
+	RoleAdmin   AdminRole = "admin"
+	RoleSupport AdminRole = "support"
+	RoleFinance AdminRole = "finance"
+)
+
+type Permission string
+
+const (
+	PermTopups   Permission = "topups"   // approve and reject topups
+	PermOrders   Permission = "orders"   // confirm, cancel and look up orders
+	PermBalance  Permission = "balance"  // deduct balances, reverse topups
+	PermUsers    Permission = "users"    // ban and unban
+	PermPrices   Permission = "prices"   // change prices
+	PermSettings Permission = "settings" // maintenance and payment methods
+	PermReports  Permission = "reports"  // referral reports
+	PermAdmins   Permission = "admins"   // add and remove admins
+	PermAudit    Permission = "audit"    // read the audit log
+)
+
+// Owners can do everything; the other roles only get what is listed here.
+var rolePermissions = map[AdminRole][]Permission{
+	RoleAdmin:   {PermTopups, PermOrders, PermBalance, PermUsers, PermPrices, PermSettings, PermReports, PermAudit},
+	RoleSupport: {PermOrders, PermUsers},
+	RoleFinance: {PermTopups, PermBalance, PermReports},
+}
+
+// Roles in the order they are listed to admins.
+var AdminRoles = []AdminRole{RoleOwner, RoleAdmin, RoleSupport, RoleFinance}
+
+func (r AdminRole) Valid() bool {
+	for _, role := range AdminRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (r AdminRole) Can(perm Permission) bool {
+	if r == RoleOwner {
+		return true
+	}
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Admin is one entry in the admins collection. The owner from the config is
+// always treated as an owner, whether or not they have an entry.
+type Admin struct {
+	UserID  string    `bson:"user_id"`
+	Name    string    `bson:"name"`
+	Role    AdminRole `bson:"role"`
+	AddedBy string    `bson:"added_by"`
+	AddedAt time.Time `bson:"added_at"`
+}
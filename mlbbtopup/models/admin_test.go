@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestAdminRoleCan(t *testing.T) {
+	tests := []struct {
+		role AdminRole
+		perm Permission
+		want bool
+	}{
+		{RoleOwner, PermAdmins, true},
+		{RoleAdmin, PermPrices, true},
+		{RoleAdmin, PermAdmins, false},
+		{RoleSupport, PermOrders, true},
+		{RoleSupport, PermTopups, false},
+		{RoleFinance, PermTopups, true},
+		{RoleFinance, PermUsers, false},
+		{AdminRole("root"), PermOrders, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Can(tt.perm); got != tt.want {
+			t.Errorf("%s.Can(%s) = %v, want %v", tt.role, tt.perm, got, tt.want)
+		}
+	}
+	if AdminRole("root").Valid() {
+		t.Errorf("unknown role is valid")
+	}
+}
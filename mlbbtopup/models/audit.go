@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditTopupApprove    = "topup_approve"
+	AuditTopupReject     = "topup_reject"
+	AuditTopupReverse    = "topup_reverse"
+	AuditOrderProcess    = "order_process"
+	AuditOrderConfirm    = "order_confirm"
+	AuditOrderFail       = "order_fail"
+	AuditOrderCancel     = "order_cancel"
+	AuditOrderRefund     = "order_refund"
+	AuditDeduct          = "deduct"
+	AuditBan             = "ban"
+	AuditUnban           = "unban"
+	AuditRegisterApprove = "register_approve"
+	AuditRegisterReject  = "register_reject"
+	AuditSetPrice        = "set_price"
+	AuditMaintenance     = "maintenance"
+	AuditSetPayment      = "set_payment"
+	AuditAddAdmin        = "add_admin"
+	AuditRemoveAdmin     = "remove_admin"
+)
+
+// AuditEntry records one admin action. TargetUserID is the customer or admin
+// affected, if any; TargetID is the topup, order, price item or setting.
+type AuditEntry struct {
+	ActorID      string      `bson:"actor_id"`
+	ActorName    string      `bson:"actor_name"`
+	Action       string      `bson:"action"`
+	TargetUserID string      `bson:"target_user_id,omitempty"`
+	TargetID     string      `bson:"target_id,omitempty"`
+	Before       interface{} `bson:"before,omitempty"`
+	After        interface{} `bson:"after,omitempty"`
+	CreatedAt    time.Time   `bson:"created_at"`
+}
+
+// AuditFilter selects audit entries; empty fields match everything.
+type AuditFilter struct {
+	ActorID string
+	UserID  string
+	Action  string
+	Limit   int64
+}
@@ -5,4 +5,5 @@ type Config struct {
 	AdminID      int64
 	MongoURL     string
 	AdminGroupID int64
+	BotUsername  string
 }
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Games an order can be for. Orders placed before PUBG was added have no
+// game recorded and are MLBB orders.
+const (
+	GameMLBB = "mlbb"
+	GamePUBG = "pubg"
+)
+
+// IDField is one part of the player account an order is delivered to, such
+// as an MLBB game ID or server ID. IDs are digits only.
+type IDField struct {
+	Key       string // shown in usage, e.g. "gameid"
+	Label     string // shown in messages, e.g. "Game ID"
+	MinDigits int
+	MaxDigits int
+}
+
+func (f IDField) Valid(value string) bool {
+	if len(value) < f.MinDigits || len(value) > f.MaxDigits {
+		return false
+	}
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// SKU is one item of a game that can be ordered, with the price it is
+// added to the products collection at.
+type SKU struct {
+	Code         string
+	Name         string
+	Category     ProductCategory
+	DefaultPrice int
+}
+
+// Game describes a game the bot sells: the command customers order with,
+// the account IDs it needs and the items on sale. Adding a game only takes a
+// new entry in Games.
+type Game struct {
+	Code      string
+	Name      string
+	Unit      string // what orders deliver, e.g. "Diamonds"
+	Command   string
+	IDFields  []IDField
+	SKUs      []SKU
+	SKUSuffix string // appended to item codes typed without it, e.g. "uc"
+	Example   string
+
+	// PriceSections are the game's /price pages. A game without any gets
+	// one page listing all of its SKUs.
+	PriceSections []PriceSection
+}
+
+var Games = []Game{
+	{
+		Code:    GameMLBB,
+		Name:    "MLBB",
+		Unit:    "Diamonds",
+		Command: "mmb",
+		IDFields: []IDField{
+			{Key: "gameid", Label: "Game ID", MinDigits: 6, MaxDigits: 10},
+			{Key: "serverid", Label: "Server ID", MinDigits: 3, MaxDigits: 5},
+		},
+		SKUs: append([]SKU{
+			diamonds("11", 950), diamonds("22", 1900), diamonds("33", 2850),
+			diamonds("56", 4200), diamonds("86", 5100), diamonds("112", 8200),
+			diamonds("172", 10200), diamonds("257", 15300), diamonds("343", 20400),
+			diamonds("429", 25500), diamonds("514", 30600), diamonds("600", 35700),
+			diamonds("706", 40800), diamonds("878", 51000), diamonds("963", 56100),
+			diamonds("1049", 61200), diamonds("1135", 66300), diamonds("1412", 81600),
+			diamonds("2195", 122400), diamonds("3688", 204000), diamonds("5532", 306000),
+			diamonds("9288", 510000), diamonds("12976", 714000),
+			doubleDiamonds("55", 3500), doubleDiamonds("165", 10000),
+			doubleDiamonds("275", 16000), doubleDiamonds("565", 33000),
+		}, weeklyPassSKUs(10, 6000)...),
+		Example: "/mmb 123456789 12345 wp1",
+		PriceSections: []PriceSection{
+			{Key: "normal", Title: "💎 Normal Diamonds", Category: CategoryNormal},
+			{Key: "2x", Title: "🎁 2X First-Recharge", Category: CategoryDouble},
+			{Key: "wp", Title: "📅 Weekly Pass", Category: CategoryWeeklyPass},
+		},
+	},
+	{
+		Code:    GamePUBG,
+		Name:    "PUBG",
+		Unit:    "UC",
+		Command: "pubg",
+		IDFields: []IDField{
+			{Key: "playerid", Label: "Player ID", MinDigits: 7, MaxDigits: 11},
+		},
+		SKUs: []SKU{
+			uc("60", 1500), uc("325", 7500), uc("660", 15000),
+			uc("1800", 37500), uc("3850", 75000), uc("8100", 150000),
+		},
+		SKUSuffix: "uc",
+		Example:   "/pubg 5123456789 660uc",
+		PriceSections: []PriceSection{
+			{Key: "pubg", Title: "🔫 PUBG UC"},
+		},
+	},
+}
+
+func diamonds(amount string, price int) SKU {
+	return SKU{Code: amount, Name: amount + " Diamonds", Category: CategoryNormal, DefaultPrice: price}
+}
+
+func doubleDiamonds(amount string, price int) SKU {
+	return SKU{Code: amount, Name: amount + " Diamonds (2X)", Category: CategoryDouble, DefaultPrice: price}
+}
+
+func uc(amount string, price int) SKU {
+	return SKU{Code: amount + "uc", Name: amount + " UC", Category: CategoryNormal, DefaultPrice: price}
+}
+
+// weeklyPassSKUs builds wp1 to wpN, each week costing the same.
+func weeklyPassSKUs(weeks int, pricePerWeek int) []SKU {
+	skus := make([]SKU, 0, weeks)
+	for i := 1; i <= weeks; i++ {
+		skus = append(skus, SKU{
+			Code:         fmt.Sprintf("wp%d", i),
+			Name:         fmt.Sprintf("Weekly Pass %d", i),
+			Category:     CategoryWeeklyPass,
+			DefaultPrice: i * pricePerWeek,
+		})
+	}
+	return skus
+}
+
+func FindGame(code string) *Game {
+	for i := range Games {
+		if Games[i].Code == code {
+			return &Games[i]
+		}
+	}
+	return nil
+}
+
+func FindGameByCommand(command string) *Game {
+	for i := range Games {
+		if Games[i].Command == command {
+			return &Games[i]
+		}
+	}
+	return nil
+}
+
+func GameName(code string) string {
+	if game := FindGame(code); game != nil {
+		return game.Name
+	}
+	return code
+}
+
+// Usage is the command format, e.g. "/mmb gameid serverid amount".
+func (g Game) Usage() string {
+	parts := []string{"/" + g.Command}
+	for _, field := range g.IDFields {
+		parts = append(parts, field.Key)
+	}
+	return strings.Join(append(parts, "amount"), " ")
+}
+
+// ExampleIDs is the account part of Example, e.g. "123456789 12345".
+func (g Game) ExampleIDs() string {
+	parts := strings.Fields(g.Example)
+	if len(parts) < len(g.IDFields)+1 {
+		return ""
+	}
+	return strings.Join(parts[1:len(g.IDFields)+1], " ")
+}
+
+// NormalizeSKU turns what the customer typed into an item code.
+func (g Game) NormalizeSKU(input string) string {
+	code := strings.ToLower(strings.TrimSpace(input))
+	if g.SKUSuffix != "" && !strings.HasSuffix(code, g.SKUSuffix) {
+		code += g.SKUSuffix
+	}
+	return code
+}
+
+func (g Game) FindSKU(code string) *SKU {
+	for i := range g.SKUs {
+		if g.SKUs[i].Code == code {
+			return &g.SKUs[i]
+		}
+	}
+	return nil
+}
+
+// SKUsIn returns the game's SKUs in one category, in catalog order.
+func (g Game) SKUsIn(category ProductCategory) []SKU {
+	var skus []SKU
+	for _, sku := range g.SKUs {
+		if sku.Category == category {
+			skus = append(skus, sku)
+		}
+	}
+	return skus
+}
+
+func (o Order) GameCode() string {
+	if o.Game == "" {
+		return GameMLBB
+	}
+	return o.Game
+}
+
+// AccountText is the player account the order is delivered to.
+func (o Order) AccountText() string {
+	if o.ServerID == "" {
+		return o.GameID
+	}
+	return fmt.Sprintf("%s (%s)", o.GameID, o.ServerID)
+}
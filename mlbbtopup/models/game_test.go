@@ -0,0 +1,77 @@
+package models
+
+import "testing"
+
+func TestGameFindSKU(t *testing.T) {
+	mlbb := FindGameByCommand("mmb")
+	pubg := FindGameByCommand("pubg")
+	if mlbb == nil || pubg == nil || FindGameByCommand("ff") != nil {
+		t.Fatalf("FindGameByCommand: mmb %v, pubg %v", mlbb, pubg)
+	}
+
+	tests := []struct {
+		game  *Game
+		input string
+		want  string // empty if the game does not sell it
+	}{
+		{mlbb, "86", "86 Diamonds"},
+		{mlbb, "WP3", "Weekly Pass 3"},
+		{mlbb, "wp11", ""},
+		{pubg, "660", "660 UC"},
+		{pubg, "660UC", "660 UC"},
+		{pubg, "86", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if sku := tt.game.FindSKU(tt.game.NormalizeSKU(tt.input)); sku != nil {
+			got = sku.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s %q = %q, want %q", tt.game.Code, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultProducts(t *testing.T) {
+	products := DefaultProducts()
+
+	var mlbb, pubg int
+	for _, product := range products {
+		switch product.Game {
+		case GameMLBB:
+			mlbb++
+		case GamePUBG:
+			pubg++
+		}
+		if !product.Active || product.Price <= 0 || product.SortOrder <= 0 {
+			t.Errorf("product = %+v, want active with a price and sort order", product)
+		}
+	}
+	if mlbb != len(FindGame(GameMLBB).SKUs) || pubg != len(FindGame(GamePUBG).SKUs) {
+		t.Errorf("catalog has %d MLBB and %d PUBG products", mlbb, pubg)
+	}
+	if got := len(FindGame(GameMLBB).SKUsIn(CategoryWeeklyPass)); got != 10 {
+		t.Errorf("MLBB has %d weekly passes, want 10", got)
+	}
+}
+
+func TestIDFieldValid(t *testing.T) {
+	mlbb := FindGame(GameMLBB)
+	if got := mlbb.Usage(); got != "/mmb gameid serverid amount" {
+		t.Errorf("Usage = %q", got)
+	}
+
+	gameID := mlbb.IDFields[0]
+	for value, want := range map[string]bool{
+		"123456":      true,
+		"1234567890":  true,
+		"12345":       false,
+		"12345678901": false,
+		"12345a78":    false,
+	} {
+		if got := gameID.Valid(value); got != want {
+			t.Errorf("Game ID %q valid = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type HistoryKind string
+
+const (
+	HistoryAll    HistoryKind = "all"
+	HistoryOrders HistoryKind = "orders"
+	HistoryTopups HistoryKind = "topups"
+)
+
+// HistoryStatus groups order and topup statuses by outcome, so one filter
+// works for both.
+type HistoryStatus string
+
+const (
+	HistoryAnyStatus HistoryStatus = "any"
+	HistoryPending   HistoryStatus = "pending"
+	HistoryDone      HistoryStatus = "done"
+	HistoryFailed    HistoryStatus = "failed"
+)
+
+var historyOrderStatuses = map[HistoryStatus][]string{
+	HistoryPending: {string(OrderPending), string(OrderProcessing)},
+	HistoryDone:    {string(OrderCompleted)},
+	HistoryFailed:  {string(OrderFailed), string(OrderCancelled), string(OrderRefunded)},
+}
+
+var historyTopupStatuses = map[HistoryStatus][]string{
+	HistoryPending: {"pending"},
+	HistoryDone:    {"approved"},
+	HistoryFailed:  {"rejected", "cancelled", "reversed"},
+}
+
+// OrderStatuses returns the order statuses the filter matches, or nil for
+// all of them.
+func (s HistoryStatus) OrderStatuses() []string {
+	return historyOrderStatuses[s]
+}
+
+// TopupStatuses returns the topup statuses the filter matches, or nil for
+// all of them.
+func (s HistoryStatus) TopupStatuses() []string {
+	return historyTopupStatuses[s]
+}
+
+const HistoryPageSize = 5
+
+// HistoryFilter selects one page of a user's /history. Page starts at 0.
+type HistoryFilter struct {
+	UserID string
+	Kind   HistoryKind
+	Status HistoryStatus
+	Page   int
+}
+
+// CallbackData encodes the filter for a /history button, without the user;
+// buttons always show the history of whoever taps them.
+func (f HistoryFilter) CallbackData() string {
+	return fmt.Sprintf("history_%s_%s_%d", f.Kind, f.Status, f.Page)
+}
+
+// ParseHistoryFilter reads the filter back from history_<kind>_<status>_<page>.
+// Anything it does not recognise falls back to the first page of everything.
+func ParseHistoryFilter(userID, data string) HistoryFilter {
+	filter := HistoryFilter{UserID: userID, Kind: HistoryAll, Status: HistoryAnyStatus}
+
+	parts := strings.Split(strings.TrimPrefix(data, "history_"), "_")
+	if len(parts) != 3 {
+		return filter
+	}
+
+	switch kind := HistoryKind(parts[0]); kind {
+	case HistoryOrders, HistoryTopups:
+		filter.Kind = kind
+	}
+	switch status := HistoryStatus(parts[1]); status {
+	case HistoryPending, HistoryDone, HistoryFailed:
+		filter.Status = status
+	}
+	if page, err := strconv.Atoi(parts[2]); err == nil && page > 0 {
+		filter.Page = page
+	}
+	return filter
+}
+
+// HistoryEntry is an order or a topup in a user's history; exactly one of
+// the two is set.
+type HistoryEntry struct {
+	Order *Order
+	Topup *Topup
+}
+
+func (e HistoryEntry) Timestamp() time.Time {
+	if e.Order != nil {
+		return e.Order.Timestamp
+	}
+	return e.Topup.Timestamp
+}
+
+// NewHistory merges orders and topups, newest first.
+func NewHistory(orders []Order, topups []Topup) []HistoryEntry {
+	entries := make([]HistoryEntry, 0, len(orders)+len(topups))
+	for i := range orders {
+		entries = append(entries, HistoryEntry{Order: &orders[i]})
+	}
+	for i := range topups {
+		entries = append(entries, HistoryEntry{Topup: &topups[i]})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp().After(entries[j].Timestamp())
+	})
+	return entries
+}
+
+// PageOf returns the filter's page of entries, which must start at the
+// newest entry.
+func (f HistoryFilter) PageOf(entries []HistoryEntry) []HistoryEntry {
+	start := f.Page * HistoryPageSize
+	if start >= len(entries) {
+		return nil
+	}
+	end := start + HistoryPageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	return entries[start:end]
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHistoryFilterRoundTrip(t *testing.T) {
+	filter := HistoryFilter{UserID: "42", Kind: HistoryTopups, Status: HistoryFailed, Page: 2}
+	if got := ParseHistoryFilter("42", filter.CallbackData()); got != filter {
+		t.Errorf("round trip = %+v, want %+v", got, filter)
+	}
+
+	want := HistoryFilter{UserID: "42", Kind: HistoryAll, Status: HistoryAnyStatus}
+	for _, data := range []string{"history_x", "history_bogus_bogus_-1", "history_all_any_abc"} {
+		if got := ParseHistoryFilter("42", data); got != want {
+			t.Errorf("ParseHistoryFilter(%q) = %+v, want the first page of everything", data, got)
+		}
+	}
+}
+
+func TestHistoryPageOf(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var orders []Order
+	var topups []Topup
+	for i := 0; i < 6; i++ {
+		orders = append(orders, Order{OrderID: string(rune('A' + i)), Timestamp: start.Add(time.Duration(2*i) * time.Hour)})
+	}
+	for i := 0; i < 6; i++ {
+		topups = append(topups, Topup{TopupID: string(rune('a' + i)), Timestamp: start.Add(time.Duration(2*i+1) * time.Hour)})
+	}
+
+	entries := NewHistory(orders, topups)
+	if len(entries) != 12 || entries[0].Topup == nil || entries[0].Topup.TopupID != "f" {
+		t.Fatalf("newest entry = %+v, want topup f", entries[0])
+	}
+
+	tests := []struct {
+		page      int
+		wantLen   int
+		wantFirst time.Time
+	}{
+		{0, 5, start.Add(11 * time.Hour)},
+		{1, 5, start.Add(6 * time.Hour)},
+		{2, 2, start.Add(1 * time.Hour)},
+		{3, 0, time.Time{}},
+	}
+	for _, tt := range tests {
+		page := HistoryFilter{Page: tt.page}.PageOf(entries)
+		if len(page) != tt.wantLen {
+			t.Errorf("page %d has %d entries, want %d", tt.page, len(page), tt.wantLen)
+			continue
+		}
+		if len(page) > 0 && !page[0].Timestamp().Equal(tt.wantFirst) {
+			t.Errorf("page %d starts at %v, want %v", tt.page, page[0].Timestamp(), tt.wantFirst)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+)
+
+// Ledger reasons
+const (
+	LedgerReasonOpeningBalance     = "opening_balance"
+	LedgerReasonTopupApproval      = "topup_approval"
+	LedgerReasonOrderDebit         = "order_debit"
+	LedgerReasonOrderRefund        = "order_refund"
+	LedgerReasonAdminDeduct        = "admin_deduct"
+	LedgerReasonReferralCommission = "referral_commission"
+	LedgerReasonAdjustment         = "balance_adjustment"
+	LedgerReasonTopupReversal      = "topup_reversal"
+	LedgerReasonCommissionClawback = "commission_clawback"
+)
+
+// System accounts on the other side of every user wallet entry
+const (
+	AccountPayments    = "system:payments"
+	AccountSales       = "system:sales"
+	AccountReferrals   = "system:referrals"
+	AccountAdjustments = "system:adjustments"
+	AccountOpening     = "system:opening"
+)
+
+var ledgerCounterAccounts = map[string]string{
+	LedgerReasonOpeningBalance:     AccountOpening,
+	LedgerReasonTopupApproval:      AccountPayments,
+	LedgerReasonOrderDebit:         AccountSales,
+	LedgerReasonOrderRefund:        AccountSales,
+	LedgerReasonAdminDeduct:        AccountAdjustments,
+	LedgerReasonReferralCommission: AccountReferrals,
+	LedgerReasonAdjustment:         AccountAdjustments,
+	LedgerReasonTopupReversal:      AccountPayments,
+	LedgerReasonCommissionClawback: AccountReferrals,
+}
+
+// LedgerEntry is an immutable wallet movement. Amount is always positive and
+// moves from DebitAccount to CreditAccount; Change is the same movement seen
+// from the user's wallet (positive for credits, negative for debits).
+type LedgerEntry struct {
+	EntryID       string    `bson:"entry_id"`
+	UserID        string    `bson:"user_id"`
+	Reason        string    `bson:"reason"`
+	ReferenceID   string    `bson:"reference_id"`
+	DebitAccount  string    `bson:"debit_account"`
+	CreditAccount string    `bson:"credit_account"`
+	Amount        int       `bson:"amount"`
+	Change        int       `bson:"change"`
+	BalanceAfter  int       `bson:"balance_after"`
+	CreatedAt     time.Time `bson:"created_at"`
+}
+
+func UserAccount(userID string) string {
+	return "user:" + userID
+}
+
+func LedgerCounterAccount(reason string) string {
+	if account, ok := ledgerCounterAccounts[reason]; ok {
+		return account
+	}
+	return AccountAdjustments
+}
+
+// NewLedgerEntry builds the double-entry record for a change to a user's wallet.
+func NewLedgerEntry(entryID, userID string, change int, reason, referenceID string, balanceAfter int) LedgerEntry {
+	entry := LedgerEntry{
+		EntryID:      entryID,
+		UserID:       userID,
+		Reason:       reason,
+		ReferenceID:  referenceID,
+		Change:       change,
+		BalanceAfter: balanceAfter,
+		CreatedAt:    time.Now(),
+	}
+
+	if change >= 0 {
+		entry.Amount = change
+		entry.DebitAccount = LedgerCounterAccount(reason)
+		entry.CreditAccount = UserAccount(userID)
+	} else {
+		entry.Amount = -change
+		entry.DebitAccount = UserAccount(userID)
+		entry.CreditAccount = LedgerCounterAccount(reason)
+	}
+	return entry
+}
@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestNewLedgerEntrySides(t *testing.T) {
+	tests := []struct {
+		name          string
+		change        int
+		reason        string
+		wantAmount    int
+		wantDebit     string
+		wantCredit    string
+		wantBalanceTo int
+	}{
+		{"topup credits the wallet", 5000, LedgerReasonTopupApproval, 5000, AccountPayments, "user:42", 5000},
+		{"order debits the wallet", -1200, LedgerReasonOrderDebit, 1200, "user:42", AccountSales, 3800},
+		{"refund credits the wallet", 1200, LedgerReasonOrderRefund, 1200, AccountSales, "user:42", 5000},
+		{"deduct debits the wallet", -300, LedgerReasonAdminDeduct, 300, "user:42", AccountAdjustments, 4700},
+		{"unknown reason falls back to adjustments", -10, "mystery", 10, "user:42", AccountAdjustments, 4690},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := NewLedgerEntry("e1", "42", tt.change, tt.reason, "ref", tt.wantBalanceTo)
+
+			if entry.Amount != tt.wantAmount {
+				t.Errorf("Amount = %d, want %d", entry.Amount, tt.wantAmount)
+			}
+			if entry.Change != tt.change {
+				t.Errorf("Change = %d, want %d", entry.Change, tt.change)
+			}
+			if entry.DebitAccount != tt.wantDebit || entry.CreditAccount != tt.wantCredit {
+				t.Errorf("accounts = %s -> %s, want %s -> %s",
+					entry.DebitAccount, entry.CreditAccount, tt.wantDebit, tt.wantCredit)
+			}
+			if entry.BalanceAfter != tt.wantBalanceTo {
+				t.Errorf("BalanceAfter = %d, want %d", entry.BalanceAfter, tt.wantBalanceTo)
+			}
+		})
+	}
+}
@@ -9,25 +9,29 @@ type User struct {
 	Name             string    `bson:"name"`
 	Username         string    `bson:"username"`
 	Balance          int       `bson:"balance"`
-	Orders           []Order   `bson:"orders"`
-	Topups           []Topup   `bson:"topups"`
 	JoinedAt         time.Time `bson:"joined_at"`
 	ReferredBy       string    `bson:"referred_by,omitempty"`
 	ReferralEarnings int       `bson:"referral_earnings"`
 }
 
 type Order struct {
-	OrderID     string    `bson:"order_id"`
-	GameID      string    `bson:"game_id"`
-	ServerID    string    `bson:"server_id"`
-	Amount      string    `bson:"amount"`
-	Price       int       `bson:"price"`
-	Status      string    `bson:"status"`
-	Timestamp   time.Time `bson:"timestamp"`
-	UserID      string    `bson:"user_id"`
-	ChatID      int64     `bson:"chat_id"`
-	ConfirmedBy string    `bson:"confirmed_by,omitempty"`
-	ConfirmedAt time.Time `bson:"confirmed_at,omitempty"`
+	OrderID        string            `bson:"order_id"`
+	Game           string            `bson:"game,omitempty"`
+	GameID         string            `bson:"game_id"`
+	ServerID       string            `bson:"server_id"`
+	Amount         string            `bson:"amount"`
+	Price          int               `bson:"price"`
+	Status         OrderStatus       `bson:"status"`
+	Timestamp      time.Time         `bson:"timestamp"`
+	UserID         string            `bson:"user_id"`
+	ChatID         int64             `bson:"chat_id"`
+	ConfirmedBy    string            `bson:"confirmed_by,omitempty"`
+	ConfirmedAt    time.Time         `bson:"confirmed_at,omitempty"`
+	UpdatedBy      string            `bson:"updated_by,omitempty"`
+	UpdatedAt      time.Time         `bson:"updated_at,omitempty"`
+	History        []OrderTransition `bson:"history,omitempty"`
+	AdminChatID    int64             `bson:"admin_chat_id,omitempty"`
+	AdminMessageID int               `bson:"admin_message_id,omitempty"`
 }
 
 type Topup struct {
@@ -40,12 +44,29 @@ type Topup struct {
 	ChatID       int64     `bson:"chat_id"`
 	ApprovedBy   string    `bson:"approved_by,omitempty"`
 	ApprovedAt   time.Time `bson:"approved_at,omitempty"`
+	AdminChatID  int64     `bson:"admin_chat_id,omitempty"`
+	AdminMessageID int     `bson:"admin_message_id,omitempty"`
+	PayerName    string    `bson:"payer_name,omitempty"`
+	PayerKey     string    `bson:"payer_key,omitempty"`
+	ReversedBy   string    `bson:"reversed_by,omitempty"`
+	ReversedAt   time.Time `bson:"reversed_at,omitempty"`
+	ReversalReason string  `bson:"reversal_reason,omitempty"`
+}
+
+// TopupReversal is what reversing an approved topup took back: the amount
+// from its owner and, if one was paid, the commission from the referrer.
+type TopupReversal struct {
+	Topup           Topup
+	UserBalance     int
+	ReferrerID      string
+	Commission      int
+	ReferrerBalance int
 }
 
 type PendingTopup struct {
-	Amount       int       `json:"amount"`
-	Timestamp    time.Time `json:"timestamp"`
-	PaymentMethod string    `json:"payment_method"`
+	Amount       int       `json:"amount" bson:"amount"`
+	Timestamp    time.Time `json:"timestamp" bson:"timestamp"`
+	PaymentMethod string    `json:"payment_method" bson:"payment_method,omitempty"`
 }
 
 type Settings struct {
@@ -54,3 +75,13 @@ type Settings struct {
 	Affiliate    map[string]interface{} `bson:"affiliate"`
 	AutoDelete   map[string]interface{} `bson:"auto_delete"`
 }
+
+// ProcessedCallback marks an admin action (approve, reject, confirm, cancel)
+// as handled so that repeated button taps are ignored.
+type ProcessedCallback struct {
+	Key         string    `bson:"key"`
+	Action      string    `bson:"action"`
+	HandledByID string    `bson:"handled_by_id"`
+	HandledBy   string    `bson:"handled_by"`
+	HandledAt   time.Time `bson:"handled_at"`
+}
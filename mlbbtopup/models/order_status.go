@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type OrderStatus string
+
+// Order lifecycle: pending → processing → completed / failed / cancelled,
+// with completed and failed orders able to be refunded afterwards.
+const (
+	OrderPending    OrderStatus = "pending"
+	OrderProcessing OrderStatus = "processing"
+	OrderCompleted  OrderStatus = "completed"
+	OrderFailed     OrderStatus = "failed"
+	OrderCancelled  OrderStatus = "cancelled"
+	OrderRefunded   OrderStatus = "refunded"
+)
+
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:    {OrderProcessing, OrderCancelled},
+	OrderProcessing: {OrderCompleted, OrderFailed, OrderCancelled},
+	OrderCompleted:  {OrderRefunded},
+	OrderFailed:     {OrderRefunded},
+}
+
+type OrderTransition struct {
+	From OrderStatus `bson:"from"`
+	To   OrderStatus `bson:"to"`
+	By   string      `bson:"by"`
+	At   time.Time   `bson:"at"`
+}
+
+func CanTransitionOrder(from, to OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the order to a new status, recording who moved it and when.
+// It is the only place order statuses should change.
+func (o *Order) Transition(to OrderStatus, actor string, at time.Time) (OrderTransition, error) {
+	if !CanTransitionOrder(o.Status, to) {
+		return OrderTransition{}, fmt.Errorf("%w: %s → %s", ErrInvalidOrderTransition, o.Status, to)
+	}
+
+	transition := OrderTransition{From: o.Status, To: to, By: actor, At: at}
+	o.Status = to
+	o.UpdatedBy = actor
+	o.UpdatedAt = at
+	if to == OrderCompleted {
+		o.ConfirmedBy = actor
+		o.ConfirmedAt = at
+	}
+	o.History = append(o.History, transition)
+	return transition, nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		want     bool
+	}{
+		{OrderPending, OrderProcessing, true},
+		{OrderPending, OrderCancelled, true},
+		{OrderProcessing, OrderCompleted, true},
+		{OrderProcessing, OrderFailed, true},
+		{OrderCompleted, OrderRefunded, true},
+		{OrderFailed, OrderRefunded, true},
+		{OrderProcessing, OrderCancelled, true},
+		{OrderPending, OrderCompleted, false},
+		{OrderPending, OrderFailed, false},
+		{OrderPending, OrderRefunded, false},
+		{OrderProcessing, OrderRefunded, false},
+		{OrderFailed, OrderCompleted, false},
+		{OrderCompleted, OrderCancelled, false},
+		{OrderCancelled, OrderPending, false},
+		{OrderRefunded, OrderCompleted, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransitionOrder(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransitionOrder(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestOrderTransitionRecordsHistory(t *testing.T) {
+	order := Order{OrderID: "ORD00001", Status: OrderPending}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := order.Transition(OrderProcessing, "Admin", at); err != nil {
+		t.Fatalf("pending → processing: %v", err)
+	}
+	transition, err := order.Transition(OrderCompleted, "Admin", at.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("processing → completed: %v", err)
+	}
+
+	if transition.From != OrderProcessing || transition.To != OrderCompleted {
+		t.Errorf("transition = %+v, want processing → completed", transition)
+	}
+	if order.Status != OrderCompleted || order.ConfirmedBy != "Admin" || !order.ConfirmedAt.Equal(at.Add(time.Minute)) {
+		t.Errorf("order = %+v, want completed and confirmed by Admin", order)
+	}
+	if len(order.History) != 2 {
+		t.Errorf("history has %d transitions, want 2", len(order.History))
+	}
+}
+
+func TestOrderFailedThenRefunded(t *testing.T) {
+	order := Order{OrderID: "ORD00001", Status: OrderPending}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, to := range []OrderStatus{OrderProcessing, OrderFailed, OrderRefunded} {
+		if _, err := order.Transition(to, "Admin", at); err != nil {
+			t.Fatalf("%s → %s: %v", order.Status, to, err)
+		}
+	}
+
+	if order.Status != OrderRefunded || len(order.History) != 3 {
+		t.Errorf("order = %+v, want refunded after 3 transitions", order)
+	}
+	if order.ConfirmedBy != "" {
+		t.Errorf("failed order was marked confirmed by %q", order.ConfirmedBy)
+	}
+	if _, err := order.Transition(OrderRefunded, "Admin", at); !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Errorf("second refund: err = %v, want ErrInvalidOrderTransition", err)
+	}
+}
+
+func TestOrderTransitionRejectsInvalidMove(t *testing.T) {
+	order := Order{OrderID: "ORD00001", Status: OrderCancelled}
+
+	_, err := order.Transition(OrderCompleted, "Admin", time.Now())
+	if !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Fatalf("cancelled → completed: err = %v, want ErrInvalidOrderTransition", err)
+	}
+	if order.Status != OrderCancelled || len(order.History) != 0 {
+		t.Errorf("refused transition changed the order: %+v", order)
+	}
+}
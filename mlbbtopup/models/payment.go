@@ -0,0 +1,70 @@
+package models
+
+// PaymentMethod is one way customers can pay for a topup. The list lives in
+// the settings document under payment_methods.
+type PaymentMethod struct {
+	Code          string `bson:"code"`
+	Name          string `bson:"name"`
+	AccountNumber string `bson:"account_number"`
+	AccountName   string `bson:"account_name"`
+	QRFileID      string `bson:"qr_file_id,omitempty"`
+	MinAmount     int    `bson:"min_amount"`
+	MaxAmount     int    `bson:"max_amount"` // 0 means no upper limit
+	Enabled       bool   `bson:"enabled"`
+}
+
+// Accepts reports whether a topup of amount can be paid with this method.
+func (p PaymentMethod) Accepts(amount int) bool {
+	if !p.Enabled || amount < p.MinAmount {
+		return false
+	}
+	return p.MaxAmount == 0 || amount <= p.MaxAmount
+}
+
+func FindPaymentMethod(methods []PaymentMethod, code string) *PaymentMethod {
+	for i := range methods {
+		if methods[i].Code == code {
+			return &methods[i]
+		}
+	}
+	return nil
+}
+
+// PaymentMethodName returns the display name for code, or code itself if the
+// method has since been removed.
+func PaymentMethodName(methods []PaymentMethod, code string) string {
+	if method := FindPaymentMethod(methods, code); method != nil {
+		return method.Name
+	}
+	return code
+}
+
+// LegacyPaymentMethods builds the method list from the old payment_info
+// settings, which only knew KBZ Pay and Wave Money.
+func LegacyPaymentMethods(paymentInfo map[string]interface{}) []PaymentMethod {
+	str := func(key string) string {
+		value, _ := paymentInfo[key].(string)
+		return value
+	}
+
+	return []PaymentMethod{
+		{
+			Code:          "kpay",
+			Name:          "KBZ Pay",
+			AccountNumber: str("kpay_number"),
+			AccountName:   str("kpay_name"),
+			QRFileID:      str("kpay_image"),
+			MinAmount:     1000,
+			Enabled:       true,
+		},
+		{
+			Code:          "wave",
+			Name:          "Wave Money",
+			AccountNumber: str("wave_number"),
+			AccountName:   str("wave_name"),
+			QRFileID:      str("wave_image"),
+			MinAmount:     1000,
+			Enabled:       true,
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import "testing"
+
+func TestPaymentMethodAccepts(t *testing.T) {
+	wave := PaymentMethod{Code: "wave", MinAmount: 1000, MaxAmount: 50000, Enabled: true}
+	kpay := PaymentMethod{Code: "kpay", MinAmount: 1000, Enabled: true}
+	off := PaymentMethod{Code: "aya", MinAmount: 1000, Enabled: false}
+
+	tests := []struct {
+		method PaymentMethod
+		amount int
+		want   bool
+	}{
+		{wave, 999, false},
+		{wave, 1000, true},
+		{wave, 50000, true},
+		{wave, 50001, false},
+		{kpay, 1000000, true},
+		{off, 5000, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.method.Accepts(tt.amount); got != tt.want {
+			t.Errorf("%s.Accepts(%d) = %v, want %v", tt.method.Code, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyPaymentMethods(t *testing.T) {
+	methods := LegacyPaymentMethods(map[string]interface{}{
+		"kpay_number": "09123456789",
+		"wave_name":   "Daw Mya",
+	})
+
+	if got := PaymentMethodName(methods, "kpay"); got != "KBZ Pay" {
+		t.Errorf("PaymentMethodName(kpay) = %q, want KBZ Pay", got)
+	}
+	if got := PaymentMethodName(methods, "cb"); got != "cb" {
+		t.Errorf("PaymentMethodName(cb) = %q, want the code back", got)
+	}
+	if kpay := FindPaymentMethod(methods, "kpay"); kpay == nil || kpay.AccountNumber != "09123456789" {
+		t.Errorf("kpay = %+v, want the stored number", kpay)
+	}
+	if wave := FindPaymentMethod(methods, "wave"); wave == nil || wave.AccountName != "Daw Mya" || wave.AccountNumber != "" {
+		t.Errorf("wave = %+v, want the stored name and no number", wave)
+	}
+}
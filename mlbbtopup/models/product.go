@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+type ProductCategory string
+
+const (
+	CategoryNormal     ProductCategory = "normal"
+	CategoryDouble     ProductCategory = "2x"
+	CategoryWeeklyPass ProductCategory = "weekly_pass"
+)
+
+// Product is one item in the products collection. Game and SKU together
+// identify it; SKU is what customers type when ordering, e.g. "86" or "660uc".
+// Cost is what the item costs us and is only shown to admins.
+type Product struct {
+	Game      string          `bson:"game"`
+	SKU       string          `bson:"sku"`
+	Name      string          `bson:"name"`
+	Price     int             `bson:"price"`
+	Cost      int             `bson:"cost"`
+	Category  ProductCategory `bson:"category"`
+	SortOrder int             `bson:"sort_order"`
+	Active    bool            `bson:"active"`
+	UpdatedAt time.Time       `bson:"updated_at,omitempty"`
+}
+
+// Product builds the catalog entry for one of the game's SKUs at its default
+// price.
+func (g Game) Product(sku SKU, sortOrder int) Product {
+	return Product{
+		Game:      g.Code,
+		SKU:       sku.Code,
+		Name:      sku.Name,
+		Price:     sku.DefaultPrice,
+		Category:  sku.Category,
+		SortOrder: sortOrder,
+		Active:    true,
+	}
+}
+
+// DefaultProducts is the catalog the products collection is seeded with:
+// every SKU of every game in Games, in the order they are listed.
+func DefaultProducts() []Product {
+	var products []Product
+	for _, game := range Games {
+		for i, sku := range game.SKUs {
+			products = append(products, game.Product(sku, i+1))
+		}
+	}
+	return products
+}
+
+// PriceSection is one page of the /price list. An empty Category shows all
+// of the game's products.
+type PriceSection struct {
+	Key      string
+	Title    string
+	Game     string // set by PriceSections from the game listing it
+	Category ProductCategory
+}
+
+// PriceSections are the /price pages of every game in Games, in the order
+// their buttons are shown.
+func PriceSections() []PriceSection {
+	var sections []PriceSection
+	for _, game := range Games {
+		gameSections := game.PriceSections
+		if len(gameSections) == 0 {
+			gameSections = []PriceSection{{Key: game.Code, Title: game.Name + " " + game.Unit}}
+		}
+		for _, section := range gameSections {
+			section.Game = game.Code
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// FindPriceSection returns the section with the given key, or the first
+// section if there is none.
+func FindPriceSection(key string) PriceSection {
+	sections := PriceSections()
+	for _, section := range sections {
+		if section.Key == key {
+			return section
+		}
+	}
+	return sections[0]
+}
+
+// Includes reports whether a product is listed in the section.
+func (s PriceSection) Includes(product Product) bool {
+	return product.Game == s.Game && (s.Category == "" || product.Category == s.Category)
+}
@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestFindPriceSection(t *testing.T) {
+	if got := FindPriceSection("pubg"); got.Game != GamePUBG {
+		t.Errorf("FindPriceSection(pubg) = %+v", got)
+	}
+	if got := FindPriceSection("nope"); got.Key != PriceSections()[0].Key {
+		t.Errorf("unknown key gave %q, want the first section", got.Key)
+	}
+
+	wp := FindPriceSection("wp")
+	tests := []struct {
+		section PriceSection
+		product Product
+		want    bool
+	}{
+		{wp, Product{Game: GameMLBB, SKU: "wp1", Category: CategoryWeeklyPass}, true},
+		{wp, Product{Game: GameMLBB, SKU: "86", Category: CategoryNormal}, false},
+		{FindPriceSection("pubg"), Product{Game: GamePUBG, SKU: "660uc", Category: CategoryNormal}, true},
+		{FindPriceSection("normal"), Product{Game: GamePUBG, SKU: "660uc", Category: CategoryNormal}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.section.Includes(tt.product); got != tt.want {
+			t.Errorf("%s includes %s/%s = %v, want %v", tt.section.Key, tt.product.Game, tt.product.SKU, got, tt.want)
+		}
+	}
+}
+
+func TestGameExampleIDs(t *testing.T) {
+	if got := FindGame(GameMLBB).ExampleIDs(); got != "123456789 12345" {
+		t.Errorf("MLBB ExampleIDs = %q", got)
+	}
+	if got := FindGame(GamePUBG).ExampleIDs(); got != "5123456789" {
+		t.Errorf("PUBG ExampleIDs = %q", got)
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ReferralStats is what /affiliate shows a referrer.
+type ReferralStats struct {
+	Signups           int
+	Active            int // signups with at least one approved topup
+	MonthlyCommission []MonthlyCommission
+	RecentCommissions []LedgerEntry
+}
+
+type MonthlyCommission struct {
+	Month  string `bson:"_id"` // YYYY-MM
+	Amount int    `bson:"amount"`
+	Count  int    `bson:"count"`
+}
+
+// ReferrerRank is one row of the /topreferrers leaderboard.
+type ReferrerRank struct {
+	ReferrerID string
+	Signups    int
+	Active     int
+	Commission int
+}
+
+// ReferralFlag groups topups that look like one person farming commission
+// through several referred accounts, for an admin to review.
+type ReferralFlag struct {
+	Key        string    `bson:"key"`
+	ReferrerID string    `bson:"referrer_id"`
+	Reason     string    `bson:"reason"`
+	Amount     int       `bson:"amount"`
+	PayerName  string    `bson:"payer_name"`
+	UserIDs    []string  `bson:"user_ids"`
+	TopupIDs   []string  `bson:"topup_ids"`
+	CreatedAt  time.Time `bson:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
+
+const (
+	ReferralFlagSamePayer = "same_amount_same_payer"
+	ReferralFlagNoPayer   = "no_payer_name"
+)
+
+// NormalizePayerName makes payer names comparable across screenshots.
+func NormalizePayerName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
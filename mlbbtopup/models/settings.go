@@ -0,0 +1,77 @@
+package models
+
+// Defaults written to the settings document the first time it is loaded.
+
+func DefaultPaymentInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"kpay_number": "",
+		"kpay_name":   "",
+		"kpay_image":  "",
+		"wave_number": "",
+		"wave_name":   "",
+		"wave_image":  "",
+	}
+}
+
+func DefaultMaintenance() map[string]interface{} {
+	return map[string]interface{}{
+		"orders":  true,
+		"topups":  true,
+		"general": true,
+	}
+}
+
+func DefaultAffiliate() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":    true,
+		"percentage": 3.0,
+		"min_topup":  1000,
+	}
+}
+
+func DefaultAutoDelete() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled": false,
+		"hours":   24,
+	}
+}
+
+// AffiliateSettings is the typed form of the affiliate settings block.
+type AffiliateSettings struct {
+	Enabled    bool
+	Percentage float64
+	MinTopup   int
+}
+
+// Commission returns the referrer's share of a topup, or 0 if the topup does
+// not qualify.
+func (a AffiliateSettings) Commission(topupAmount int) int {
+	if !a.Enabled || a.Percentage <= 0 || topupAmount < a.MinTopup {
+		return 0
+	}
+	return int(float64(topupAmount) * a.Percentage / 100)
+}
+
+func ParseAffiliateSettings(affiliate map[string]interface{}) AffiliateSettings {
+	settings := AffiliateSettings{}
+	settings.Enabled, _ = affiliate["enabled"].(bool)
+	settings.Percentage = settingNumber(affiliate["percentage"])
+	settings.MinTopup = int(settingNumber(affiliate["min_topup"]))
+	return settings
+}
+
+// settingNumber reads a number from a settings map. Values written from Go
+// and from the mongo shell decode as different numeric types.
+func settingNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
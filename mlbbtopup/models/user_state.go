@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+type ConversationState string
+
+// Topup conversation: /topup → awaiting_payment_method → awaiting_screenshot
+// → waiting_approval, cleared when an admin approves or rejects the topup.
+const (
+	StateAwaitingPaymentMethod ConversationState = "awaiting_payment_method"
+	StateAwaitingScreenshot    ConversationState = "awaiting_screenshot"
+	StateWaitingApproval       ConversationState = "waiting_approval"
+)
+
+// Order conversation: an item button on /price → awaiting_order_account,
+// cleared when the user sends the account the item is for.
+const (
+	StateAwaitingOrderAccount ConversationState = "awaiting_order_account"
+)
+
+// How long each state is kept before the user has to start over.
+var stateTTLs = map[ConversationState]time.Duration{
+	StateAwaitingPaymentMethod: 30 * time.Minute,
+	StateAwaitingScreenshot:    2 * time.Hour,
+	StateWaitingApproval:       72 * time.Hour,
+	StateAwaitingOrderAccount:  10 * time.Minute,
+}
+
+// UserState is where a user is in a multi-step conversation. There is at
+// most one per user.
+type UserState struct {
+	UserID    string            `bson:"user_id"`
+	State     ConversationState `bson:"state"`
+	Topup     PendingTopup      `bson:"topup"`
+	TopupID   string            `bson:"topup_id,omitempty"`
+	Order     PendingOrder      `bson:"order,omitempty"`
+	UpdatedAt time.Time         `bson:"updated_at"`
+	ExpiresAt time.Time         `bson:"expires_at"`
+}
+
+// PendingOrder is the item picked from /price while the user is asked
+// for their game account.
+type PendingOrder struct {
+	Game string `bson:"game"`
+	SKU  string `bson:"sku"`
+}
+
+func StateTTL(state ConversationState) time.Duration {
+	if ttl, ok := stateTTLs[state]; ok {
+		return ttl
+	}
+	return 30 * time.Minute
+}
+
+// Advance moves the user to the next state and restarts its TTL.
+func (s *UserState) Advance(state ConversationState, now time.Time) {
+	s.State = state
+	s.UpdatedAt = now
+	s.ExpiresAt = now.Add(StateTTL(state))
+}
+
+func NewUserState(userID string, state ConversationState, topup PendingTopup, now time.Time) UserState {
+	userState := UserState{UserID: userID, Topup: topup}
+	userState.Advance(state, now)
+	return userState
+}
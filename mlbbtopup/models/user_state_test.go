@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserStateAdvanceRestartsTTL(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := NewUserState("42", StateAwaitingPaymentMethod, PendingTopup{Amount: 5000}, now)
+
+	if want := now.Add(30 * time.Minute); !state.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", state.ExpiresAt, want)
+	}
+
+	later := now.Add(10 * time.Minute)
+	state.Advance(StateWaitingApproval, later)
+	if state.State != StateWaitingApproval || !state.UpdatedAt.Equal(later) {
+		t.Errorf("state = %+v, want waiting_approval updated at %v", state, later)
+	}
+	if want := later.Add(72 * time.Hour); !state.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", state.ExpiresAt, want)
+	}
+}
@@ -0,0 +1,324 @@
+// Package telegramtest provides a local stand-in for api.telegram.org.
+//
+// A Server records every Bot API call made against it and hands out scripted
+// updates through getUpdates, so the bot can be driven end to end without
+// network access:
+//
+//	srv := telegramtest.NewServer()
+//	defer srv.Close()
+//	bot, _ := srv.NewBot("test-token")
+//	srv.PushCommand(user, "/mmb 123456789 12345 86")
+//	...
+//	calls := srv.CallsTo("sendMessage")
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Call is one Bot API request received by the server.
+type Call struct {
+	Method string
+	Params map[string]string
+	At     time.Time
+}
+
+// ChatID returns the chat_id parameter of the call, or 0 if it has none.
+func (c Call) ChatID() int64 {
+	chatID, _ := strconv.ParseInt(c.Params["chat_id"], 10, 64)
+	return chatID
+}
+
+type Server struct {
+	*httptest.Server
+
+	// Bot is the account returned by getMe.
+	Bot tgbotapi.User
+
+	mu            sync.Mutex
+	calls         []Call
+	updates       []tgbotapi.Update
+	nextUpdateID  int
+	nextMessageID int
+	updateReady   chan struct{}
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Bot:           tgbotapi.User{ID: 1000, IsBot: true, FirstName: "Test Bot", UserName: "test_bot"},
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		updateReady:   make(chan struct{}, 1),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint is the API endpoint format to pass to tgbotapi.NewBotAPIWithAPIEndpoint.
+func (s *Server) Endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// NewBot returns a real *tgbotapi.BotAPI that talks to this server.
+func (s *Server) NewBot(token string) (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithAPIEndpoint(token, s.Endpoint())
+}
+
+// Updates
+
+// PushUpdate queues an update for the next getUpdates call. The update ID is
+// assigned by the server.
+func (s *Server) PushUpdate(update tgbotapi.Update) tgbotapi.Update {
+	s.mu.Lock()
+	update.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	s.updates = append(s.updates, update)
+	s.mu.Unlock()
+
+	select {
+	case s.updateReady <- struct{}{}:
+	default:
+	}
+	return update
+}
+
+// PushMessage queues a private text message from user.
+func (s *Server) PushMessage(from tgbotapi.User, text string) tgbotapi.Update {
+	message := s.newIncomingMessage(from)
+	message.Text = text
+	if strings.HasPrefix(text, "/") {
+		command := strings.Fields(text)[0]
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	return s.PushUpdate(tgbotapi.Update{Message: message})
+}
+
+// PushCommand is PushMessage for text starting with a bot command.
+func (s *Server) PushCommand(from tgbotapi.User, command string) tgbotapi.Update {
+	return s.PushMessage(from, command)
+}
+
+// PushPhoto queues a private photo message, as sent for a payment screenshot.
+func (s *Server) PushPhoto(from tgbotapi.User, fileID string, caption string) tgbotapi.Update {
+	message := s.newIncomingMessage(from)
+	message.Caption = caption
+	message.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: fileID, Width: 1280, Height: 720}}
+	return s.PushUpdate(tgbotapi.Update{Message: message})
+}
+
+// PushCallback queues an inline button press on a message previously sent
+// by the bot to chatID.
+func (s *Server) PushCallback(from tgbotapi.User, chatID int64, messageID int, data string) tgbotapi.Update {
+	s.mu.Lock()
+	callbackID := strconv.Itoa(s.nextUpdateID)
+	s.mu.Unlock()
+
+	return s.PushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   callbackID,
+		From: &from,
+		Data: data,
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			Date:      int(time.Now().Unix()),
+			Chat:      &tgbotapi.Chat{ID: chatID},
+		},
+	}})
+}
+
+func (s *Server) newIncomingMessage(from tgbotapi.User) *tgbotapi.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messageID := s.nextMessageID
+	s.nextMessageID++
+	return &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &from,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: from.ID, Type: "private", FirstName: from.FirstName},
+	}
+}
+
+// Recorded calls
+
+// Calls returns every request received so far, getMe and getUpdates excluded.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+	return calls
+}
+
+// CallsTo returns the recorded requests for one Bot API method, e.g. "sendMessage".
+func (s *Server) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range s.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// WaitForCalls blocks until at least n calls to method were recorded or the
+// timeout passes, and returns what was recorded.
+func (s *Server) WaitForCalls(method string, n int, timeout time.Duration) []Call {
+	deadline := time.Now().Add(timeout)
+	for {
+		calls := s.CallsTo(method)
+		if len(calls) >= n || time.Now().After(deadline) {
+			return calls
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Reset forgets recorded calls and queued updates.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = nil
+	s.updates = nil
+}
+
+// HTTP handling
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	// Paths look like /bot<token>/<method>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	method := parts[1]
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := make(map[string]string)
+	for key, values := range r.Form {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	if r.MultipartForm != nil {
+		for key, files := range r.MultipartForm.File {
+			if len(files) > 0 {
+				params[key] = files[0].Filename
+			}
+		}
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, s.Bot)
+	case "getUpdates":
+		writeResult(w, s.takeUpdates(params))
+	default:
+		writeResult(w, s.record(method, params))
+	}
+}
+
+func (s *Server) takeUpdates(params map[string]string) []tgbotapi.Update {
+	offset, _ := strconv.Atoi(params["offset"])
+	timeout, _ := strconv.Atoi(params["timeout"])
+
+	// Long polling: wait briefly for an update instead of spinning
+	wait := time.Duration(timeout) * time.Second
+	if wait > time.Second {
+		wait = time.Second
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		s.mu.Lock()
+		var pending []tgbotapi.Update
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		s.updates = pending
+		s.mu.Unlock()
+
+		if len(pending) > 0 || time.Now().After(deadline) {
+			if pending == nil {
+				pending = []tgbotapi.Update{}
+			}
+			return pending
+		}
+
+		select {
+		case <-s.updateReady:
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+}
+
+// record stores the call and builds the result a real server would return:
+// a Message for send and edit methods, true for everything else.
+func (s *Server) record(method string, params map[string]string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, Call{Method: method, Params: params, At: time.Now()})
+
+	if !strings.HasPrefix(method, "send") && !strings.HasPrefix(method, "edit") && method != "forwardMessage" && method != "copyMessage" {
+		return true
+	}
+
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	messageID, _ := strconv.Atoi(params["message_id"])
+	if messageID == 0 {
+		messageID = s.nextMessageID
+		s.nextMessageID++
+	}
+
+	message := tgbotapi.Message{
+		MessageID: messageID,
+		From:      &s.Bot,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID},
+		Text:      params["text"],
+		Caption:   params["caption"],
+	}
+	if photo, ok := params["photo"]; ok {
+		message.Photo = []tgbotapi.PhotoSize{{FileID: photo, FileUniqueID: photo}}
+	}
+	return message
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{
+		Ok:          false,
+		ErrorCode:   code,
+		Description: fmt.Sprintf("telegramtest: %s", description),
+	})
+}
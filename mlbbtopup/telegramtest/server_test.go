@@ -0,0 +1,230 @@
+package telegramtest_test
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mlbbtopup/telegramtest"
+	"mlbbtopup/utils"
+)
+
+var customer = tgbotapi.User{ID: 42, FirstName: "Aung"}
+
+func newBot(t *testing.T) (*telegramtest.Server, *tgbotapi.BotAPI) {
+	t.Helper()
+
+	srv := telegramtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	bot, err := srv.NewBot("test-token")
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+	return srv, bot
+}
+
+func TestNewBotUsesGetMe(t *testing.T) {
+	srv, bot := newBot(t)
+
+	if bot.Self.UserName != srv.Bot.UserName || bot.Self.ID != srv.Bot.ID {
+		t.Errorf("bot.Self = %+v, want %+v", bot.Self, srv.Bot)
+	}
+	if calls := srv.Calls(); len(calls) != 0 {
+		t.Errorf("getMe was recorded: %+v", calls)
+	}
+}
+
+func TestScriptedUpdates(t *testing.T) {
+	srv, bot := newBot(t)
+
+	srv.PushCommand(customer, "/mmb 123456789 12345 86")
+	srv.PushPhoto(customer, "photo-1", "U Mya")
+	srv.PushCallback(customer, customer.ID, 7, "topup_pay_kpay_5000")
+
+	updates, err := bot.GetUpdates(tgbotapi.UpdateConfig{})
+	if err != nil {
+		t.Fatalf("GetUpdates: %v", err)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("got %d updates, want 3", len(updates))
+	}
+
+	command := updates[0].Message
+	if !command.IsCommand() || command.Command() != "mmb" || command.CommandArguments() != "123456789 12345 86" {
+		t.Errorf("command = %q %q, want mmb with its arguments", command.Command(), command.CommandArguments())
+	}
+	if command.From.ID != customer.ID || command.Chat.ID != customer.ID {
+		t.Errorf("command from %d in chat %d, want %d in a private chat", command.From.ID, command.Chat.ID, customer.ID)
+	}
+
+	photo := updates[1].Message
+	if len(photo.Photo) != 1 || photo.Photo[0].FileID != "photo-1" || photo.Caption != "U Mya" {
+		t.Errorf("photo = %+v, caption %q", photo.Photo, photo.Caption)
+	}
+
+	callback := updates[2].CallbackQuery
+	if callback == nil || callback.Data != "topup_pay_kpay_5000" || callback.Message.MessageID != 7 {
+		t.Errorf("callback = %+v", callback)
+	}
+
+	for i, update := range updates {
+		if update.UpdateID != i+1 {
+			t.Errorf("update %d has ID %d, want %d", i, update.UpdateID, i+1)
+		}
+	}
+}
+
+func TestGetUpdatesOffset(t *testing.T) {
+	srv, bot := newBot(t)
+
+	for _, text := range []string{"one", "two", "three"} {
+		srv.PushMessage(customer, text)
+	}
+
+	updates, err := bot.GetUpdates(tgbotapi.UpdateConfig{Offset: 3})
+	if err != nil {
+		t.Fatalf("GetUpdates: %v", err)
+	}
+	if len(updates) != 1 || updates[0].Message.Text != "three" {
+		t.Fatalf("offset 3 returned %d updates, want only the third", len(updates))
+	}
+
+	// Confirmed updates are gone, even for a lower offset
+	updates, err = bot.GetUpdates(tgbotapi.UpdateConfig{})
+	if err != nil {
+		t.Fatalf("GetUpdates: %v", err)
+	}
+	if len(updates) != 1 || updates[0].UpdateID != 3 {
+		t.Fatalf("after offset 3 got %d updates, want update 3 only", len(updates))
+	}
+
+	updates, err = bot.GetUpdates(tgbotapi.UpdateConfig{Offset: 4})
+	if err != nil {
+		t.Fatalf("GetUpdates: %v", err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("offset past the last update returned %d updates", len(updates))
+	}
+}
+
+func TestGetUpdatesChan(t *testing.T) {
+	srv, bot := newBot(t)
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 1
+	updates := bot.GetUpdatesChan(u)
+	t.Cleanup(bot.StopReceivingUpdates)
+
+	srv.PushCommand(customer, "/start")
+	srv.PushCommand(customer, "/balance")
+
+	for _, want := range []string{"start", "balance"} {
+		select {
+		case update := <-updates:
+			if got := update.Message.Command(); got != want {
+				t.Errorf("got /%s, want /%s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for /%s", want)
+		}
+	}
+}
+
+func TestRecordsCallsThroughSender(t *testing.T) {
+	srv, bot := newBot(t)
+
+	// The handlers only see the bot as a utils.Sender
+	var sender utils.Sender = bot
+
+	if err := utils.SendMessage(sender, customer.ID, "hello", "Markdown"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	sent, err := sender.Send(tgbotapi.NewMessage(customer.ID, "second"))
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if sent.MessageID == 0 || sent.Chat.ID != customer.ID || sent.Text != "second" {
+		t.Errorf("Send returned %+v, want a message in chat %d", sent, customer.ID)
+	}
+
+	if err := utils.EditMessageText(sender, customer.ID, sent.MessageID, "edited", ""); err != nil {
+		t.Fatalf("EditMessageText: %v", err)
+	}
+	if err := utils.SendPhoto(sender, -100, "qr-file", "scan me", "Markdown"); err != nil {
+		t.Fatalf("SendPhoto: %v", err)
+	}
+	if err := utils.AnswerCallback(sender, "cb-1", "done"); err != nil {
+		t.Fatalf("AnswerCallback: %v", err)
+	}
+
+	messages := srv.CallsTo("sendMessage")
+	if len(messages) != 2 {
+		t.Fatalf("recorded %d sendMessage calls, want 2", len(messages))
+	}
+	first := messages[0]
+	if first.ChatID() != customer.ID || first.Params["text"] != "hello" || first.Params["parse_mode"] != "Markdown" {
+		t.Errorf("first sendMessage = %+v", first.Params)
+	}
+
+	edits := srv.CallsTo("editMessageText")
+	if len(edits) != 1 || edits[0].Params["message_id"] != "2" || edits[0].Params["text"] != "edited" {
+		t.Errorf("editMessageText calls = %+v", edits)
+	}
+
+	photos := srv.CallsTo("sendPhoto")
+	if len(photos) != 1 || photos[0].ChatID() != -100 || photos[0].Params["photo"] != "qr-file" {
+		t.Errorf("sendPhoto calls = %+v", photos)
+	}
+
+	answers := srv.CallsTo("answerCallbackQuery")
+	if len(answers) != 1 || answers[0].Params["callback_query_id"] != "cb-1" {
+		t.Errorf("answerCallbackQuery calls = %+v", answers)
+	}
+
+	var methods []string
+	for _, call := range srv.Calls() {
+		methods = append(methods, call.Method)
+	}
+	want := []string{"sendMessage", "sendMessage", "editMessageText", "sendPhoto", "answerCallbackQuery"}
+	if len(methods) != len(want) {
+		t.Fatalf("calls = %v, want %v", methods, want)
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", methods, want)
+		}
+	}
+}
+
+func TestWaitForCallsAndReset(t *testing.T) {
+	srv, bot := newBot(t)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		utils.SendMessage(bot, customer.ID, "late", "")
+	}()
+
+	if calls := srv.WaitForCalls("sendMessage", 1, 5*time.Second); len(calls) != 1 {
+		t.Fatalf("WaitForCalls returned %d calls, want 1", len(calls))
+	}
+	if calls := srv.WaitForCalls("sendPhoto", 1, 50*time.Millisecond); len(calls) != 0 {
+		t.Errorf("WaitForCalls for a method never called returned %d calls", len(calls))
+	}
+
+	srv.PushMessage(customer, "queued")
+	srv.Reset()
+
+	if calls := srv.Calls(); len(calls) != 0 {
+		t.Errorf("Reset kept %d calls", len(calls))
+	}
+	updates, err := bot.GetUpdates(tgbotapi.UpdateConfig{})
+	if err != nil {
+		t.Fatalf("GetUpdates: %v", err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("Reset kept %d updates", len(updates))
+	}
+}
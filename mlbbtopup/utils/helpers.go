@@ -2,9 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
-	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,8 +17,22 @@ func FormatNumber(number int) string {
 	return fmt.Sprintf("%d", number)
 }
 
+// FormatCurrency formats an amount with thousands separators, e.g. 12,500 MMK.
 func FormatCurrency(amount int) string {
-	return fmt.Sprintf("%,d MMK", amount)
+	digits := strconv.Itoa(amount)
+	sign := ""
+	if amount < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return sign + grouped.String() + " MMK"
 }
 
 func EscapeMarkdown(text string) string {
@@ -40,6 +54,7 @@ func GetUserDisplayName(user *tgbotapi.User) string {
 func ConvertOrderToBSON(order models.Order) bson.M {
 	return bson.M{
 		"order_id":   order.OrderID,
+		"game":       order.Game,
 		"game_id":    order.GameID,
 		"server_id":  order.ServerID,
 		"amount":     order.Amount,
@@ -63,22 +78,60 @@ func ConvertTopupToBSON(topup models.Topup) bson.M {
 	}
 }
 
-func HasPendingTopup(db *database.DBManager, userID string) (bool, error) {
-	user, err := db.GetUser(userID)
+func HasPendingTopup(db database.TopupStore, userID string) (bool, error) {
+	topups, err := db.GetUserTopups(userID, "pending", 1)
 	if err != nil {
 		return false, err
 	}
-	
-	if user == nil {
-		return false, nil
+	return len(topups) > 0, nil
+}
+
+// HasPermission is the one place admin rights are checked. The owner from
+// the config can do everything; anyone else needs a role in the admins
+// collection that grants perm.
+func HasPermission(db database.AdminStore, ownerID int64, userID string, perm models.Permission) bool {
+	if userID == strconv.FormatInt(ownerID, 10) {
+		return true
+	}
+
+	admin, err := db.GetAdmin(userID)
+	if err != nil {
+		log.Printf("Error getting admin %s: %v", userID, err)
+		return false
 	}
-	
-	for _, topup := range user.Topups {
-		if topup.Status == "pending" {
-			return true, nil
-		}
+	return admin != nil && admin.Role.Can(perm)
+}
+
+func IsWaitingApproval(db database.StateStore, userID string) (bool, error) {
+	state, err := db.GetUserState(userID)
+	if err != nil {
+		return false, err
+	}
+	return state != nil && state.State == models.StateWaitingApproval, nil
+}
+
+// ClearTopupState ends the user's topup conversation once an admin has dealt
+// with the topup it was waiting on.
+func ClearTopupState(db database.StateStore, userID string, topupID string) error {
+	state, err := db.GetUserState(userID)
+	if err != nil || state == nil {
+		return err
+	}
+	if state.State == models.StateWaitingApproval && state.TopupID != topupID {
+		return nil
 	}
-	return false, nil
+	return db.ClearUserState(userID)
+}
+
+// LoadSettings loads the settings document, creating it with the defaults
+// from models if it does not exist yet.
+func LoadSettings(db database.SettingsStore) (map[string]interface{}, error) {
+	return db.LoadSettings(
+		models.DefaultPaymentInfo(),
+		models.DefaultMaintenance(),
+		models.DefaultAffiliate(),
+		models.DefaultAutoDelete(),
+	)
 }
 
 func SimpleReply(messageText string) string {
@@ -2,12 +2,22 @@ package utils
 
 import (
 	"fmt"
-	"strconv"
+	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mlbbtopup/models"
 )
 
-func SendMessage(bot *tgbotapi.BotAPI, chatID int64, text string, parseMode string) error {
+// Sender is the part of the Telegram Bot API the bot uses: sending and
+// editing messages and photos through Send, and answering callback queries
+// through Request. *tgbotapi.BotAPI satisfies it.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+func SendMessage(bot Sender, chatID int64, text string, parseMode string) error {
 	msg := tgbotapi.NewMessage(chatID, text)
 	if parseMode != "" {
 		msg.ParseMode = parseMode
@@ -16,7 +26,7 @@ func SendMessage(bot *tgbotapi.BotAPI, chatID int64, text string, parseMode stri
 	return err
 }
 
-func SendMessageWithKeyboard(bot *tgbotapi.BotAPI, chatID int64, text string, parseMode string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+func SendMessageWithKeyboard(bot Sender, chatID int64, text string, parseMode string, keyboard tgbotapi.InlineKeyboardMarkup) error {
 	msg := tgbotapi.NewMessage(chatID, text)
 	if parseMode != "" {
 		msg.ParseMode = parseMode
@@ -26,7 +36,7 @@ func SendMessageWithKeyboard(bot *tgbotapi.BotAPI, chatID int64, text string, pa
 	return err
 }
 
-func SendPhoto(bot *tgbotapi.BotAPI, chatID int64, photoFileID string, caption string, parseMode string) error {
+func SendPhoto(bot Sender, chatID int64, photoFileID string, caption string, parseMode string) error {
 	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(photoFileID))
 	if caption != "" {
 		photo.Caption = caption
@@ -38,7 +48,7 @@ func SendPhoto(bot *tgbotapi.BotAPI, chatID int64, photoFileID string, caption s
 	return err
 }
 
-func EditMessageText(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, parseMode string) error {
+func EditMessageText(bot Sender, chatID int64, messageID int, text string, parseMode string) error {
 	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
 	if parseMode != "" {
 		edit.ParseMode = parseMode
@@ -47,6 +57,11 @@ func EditMessageText(bot *tgbotapi.BotAPI, chatID int64, messageID int, text str
 	return err
 }
 
+func AnswerCallback(bot Sender, callbackID string, text string) error {
+	_, err := bot.Request(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
 func CreateInlineKeyboard(buttons [][]tgbotapi.InlineKeyboardButton) tgbotapi.InlineKeyboardMarkup {
 	var keyboard [][]tgbotapi.InlineKeyboardButton
 	for _, row := range buttons {
@@ -55,27 +70,184 @@ func CreateInlineKeyboard(buttons [][]tgbotapi.InlineKeyboardButton) tgbotapi.In
 	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
 }
 
-func CreatePaymentMethodsKeyboard(amount int) tgbotapi.InlineKeyboardMarkup {
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📱 KBZ Pay", fmt.Sprintf("topup_pay_kpay_%d", amount)),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📱 Wave Money", fmt.Sprintf("topup_pay_wave_%d", amount)),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("❌ ငြင်းပယ်မယ်", "topup_cancel"),
-		),
-	)
+// CreatePaymentMethodsKeyboard offers the enabled methods that accept amount.
+func CreatePaymentMethodsKeyboard(methods []models.PaymentMethod, amount int) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, method := range methods {
+		if !method.Accepts(amount) {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📱 "+method.Name, fmt.Sprintf("topup_pay_%s_%d", method.Code, amount)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ ငြင်းပယ်မယ်", "topup_cancel"),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
 
-func CreateOrderActionKeyboard(orderID string) tgbotapi.InlineKeyboardMarkup {
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
+// PaymentInstructions is the message customers get after choosing a
+// payment method. /setpayment previews it too.
+func PaymentInstructions(method models.PaymentMethod, amount int) string {
+	return fmt.Sprintf("💳 ***ငွေဖြည့်လုပ်ငန်းစဉ်***\n\n"+
+		"✅ ***ပမာဏ:*** `%d MMK`\n"+
+		"✅ ***Payment:*** %s\n\n"+
+		"***အဆင့် 3: ငွေလွှဲပြီး Screenshot တင်ပါ။***\n\n"+
+		"📱 %s\n"+
+		"📞 ***နံပါတ်:*** `%s`\n"+
+		"👤 ***အမည်:*** %s\n\n"+
+		"⚠️ ***အရေးကြီးသော သတိပေးချက်:***\n"+
+		"***ငွေလွှဲ note/remark မှာ သင့်ရဲ့ %s အကောင့်နာမည်ကို ရေးပေးပါ။***\n\n"+
+		"💡 ***ငွေလွှဲပြီးရင် screenshot ကို ဒီမှာ တင်ပေးပါ။***\n"+
+		"🧾 ***Screenshot caption မှာ ငွေလွှဲသူ အကောင့်နာမည်ကို ရေးပေးပါ။***\n"+
+		"ℹ️ ***ပယ်ဖျက်ရန် /cancel နှိပ်ပါ***",
+		amount, method.Name, method.Name, method.AccountNumber, method.AccountName, method.Name)
+}
+
+func PaymentQRCaption(method models.PaymentMethod) string {
+	return fmt.Sprintf("📱 **%s QR Code**\n📞 နံပါတ်: `%s`\n👤 နာမည်: %s",
+		method.Name, method.AccountNumber, method.AccountName)
+}
+
+// PriceListText is one section of /price. products are the section's
+// active products in catalog order.
+func PriceListText(section models.PriceSection, products []models.Product) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "***%s ဈေးနှုန်းများ***\n\n", section.Title)
+
+	if len(products) == 0 {
+		b.WriteString("❌ ***လောလောဆယ် ရောင်းချနေသော item မရှိပါ။***\n")
+	}
+	for _, product := range products {
+		fmt.Fprintf(&b, "▫️ %s ➜ `%d MMK`\n", product.Name, product.Price)
+	}
+
+	if game := models.FindGame(section.Game); game != nil {
+		fmt.Fprintf(&b, "\n💡 ***ဝယ်ချင်တဲ့ item ကို နှိပ်ပါ သို့မဟုတ်*** `%s` ***ပို့ပါ။***", game.Usage())
+	}
+	return b.String()
+}
+
+// CreatePriceListKeyboard has a button per section to switch the list and
+// a button per item to order it.
+func CreatePriceListKeyboard(section models.PriceSection, products []models.Product) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	var tabs []tgbotapi.InlineKeyboardButton
+	for _, s := range models.PriceSections() {
+		title := s.Title
+		if s.Key == section.Key {
+			title = "✅ " + title
+		}
+		tabs = append(tabs, tgbotapi.NewInlineKeyboardButtonData(title, "price_"+s.Key))
+		if len(tabs) == 2 {
+			rows = append(rows, tabs)
+			tabs = nil
+		}
+	}
+	if len(tabs) > 0 {
+		rows = append(rows, tabs)
+	}
+
+	var items []tgbotapi.InlineKeyboardButton
+	for _, product := range products {
+		label := fmt.Sprintf("🛒 %s", product.Name)
+		items = append(items, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("price_buy_%s_%s", product.Game, product.SKU)))
+		if len(items) == 2 {
+			rows = append(rows, items)
+			items = nil
+		}
+	}
+	if len(items) > 0 {
+		rows = append(rows, items)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// CreateHistoryKeyboard has the /history filters and, when there is more
+// than one page, ◀️/▶️ to move between pages. Changing a filter goes back to
+// the first page.
+func CreateHistoryKeyboard(filter models.HistoryFilter, total int) tgbotapi.InlineKeyboardMarkup {
+	button := func(label string, selected bool, target models.HistoryFilter) tgbotapi.InlineKeyboardButton {
+		if selected {
+			label = "✅ " + label
+		}
+		return tgbotapi.NewInlineKeyboardButtonData(label, target.CallbackData())
+	}
+
+	var kinds []tgbotapi.InlineKeyboardButton
+	for _, kind := range []struct {
+		kind  models.HistoryKind
+		label string
+	}{
+		{models.HistoryAll, "📋 All"},
+		{models.HistoryOrders, "🛒 Orders"},
+		{models.HistoryTopups, "💳 Topups"},
+	} {
+		target := models.HistoryFilter{Kind: kind.kind, Status: filter.Status}
+		kinds = append(kinds, button(kind.label, filter.Kind == kind.kind, target))
+	}
+
+	var statuses []tgbotapi.InlineKeyboardButton
+	for _, status := range []struct {
+		status models.HistoryStatus
+		label  string
+	}{
+		{models.HistoryAnyStatus, "🔄 All"},
+		{models.HistoryPending, "⏳ Pending"},
+		{models.HistoryDone, "👍 Done"},
+		{models.HistoryFailed, "❌ Failed"},
+	} {
+		target := models.HistoryFilter{Kind: filter.Kind, Status: status.status}
+		statuses = append(statuses, button(status.label, filter.Status == status.status, target))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{kinds, statuses}
+
+	var pages []tgbotapi.InlineKeyboardButton
+	if filter.Page > 0 {
+		previous := filter
+		previous.Page--
+		pages = append(pages, tgbotapi.NewInlineKeyboardButtonData("◀️", previous.CallbackData()))
+	}
+	if (filter.Page+1)*models.HistoryPageSize < total {
+		next := filter
+		next.Page++
+		pages = append(pages, tgbotapi.NewInlineKeyboardButtonData("▶️", next.CallbackData()))
+	}
+	if len(pages) > 0 {
+		rows = append(rows, pages)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// CreateOrderActionKeyboard returns the admin buttons for the moves an order
+// can make from its current status. Finished orders get no buttons.
+func CreateOrderActionKeyboard(orderID string, status models.OrderStatus) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	switch status {
+	case models.OrderPending:
+		row = tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Process", fmt.Sprintf("order_process_%s", orderID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", fmt.Sprintf("order_cancel_%s", orderID)),
+		)
+	case models.OrderProcessing:
+		row = tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("✅ Confirm", fmt.Sprintf("order_confirm_%s", orderID)),
+			tgbotapi.NewInlineKeyboardButtonData("⚠️ Failed", fmt.Sprintf("order_fail_%s", orderID)),
 			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", fmt.Sprintf("order_cancel_%s", orderID)),
-		),
-	)
+		)
+	case models.OrderCompleted, models.OrderFailed:
+		row = tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ Refund", fmt.Sprintf("order_refund_%s", orderID)),
+		)
+	default:
+		return tgbotapi.InlineKeyboardMarkup{}
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
 }
 
 func CreateTopupActionKeyboard(topupID string) tgbotapi.InlineKeyboardMarkup {
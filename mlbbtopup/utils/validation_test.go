@@ -0,0 +1,19 @@
+package utils
+
+import "testing"
+
+func TestGenerateIDsFromSequence(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{GenerateOrderID(1), "ORD00001"},
+		{GenerateOrderID(123456), "ORD123456"},
+		{GenerateTopupID(42), "TOP00042"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}